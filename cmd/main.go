@@ -1,33 +1,176 @@
 package main
 
 import (
+	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"syscall"
 
+	lnkerrors "github.com/LxrdShadow/linker/internal/errors"
+	"github.com/LxrdShadow/linker/pkg/bench"
+	"github.com/LxrdShadow/linker/pkg/color"
+	"github.com/LxrdShadow/linker/pkg/event"
+	"github.com/LxrdShadow/linker/pkg/history"
 	"github.com/LxrdShadow/linker/pkg/log"
+	"github.com/LxrdShadow/linker/pkg/metrics"
+	"github.com/LxrdShadow/linker/pkg/progress"
 	"github.com/LxrdShadow/linker/pkg/transfer"
+	"github.com/LxrdShadow/linker/pkg/tui"
 	"github.com/LxrdShadow/linker/pkg/util"
 )
 
 func main() {
 	flagConfig, err := util.ParseFlags(os.Args)
 	if err != nil {
-		log.Error(err.Error())
-		return
+		exit(lnkerrors.Wrap(lnkerrors.Usage, err))
+	}
+
+	if err := setupLogging(flagConfig); err != nil {
+		exit(err)
+	}
+	if flagConfig.Faults != nil {
+		log.Warningf("injecting faults in the connections: %s\n", flagConfig.Faults)
+	}
+
+	var events, recorder event.Sink
+	if flagConfig.JSON && flagConfig.Mode != util.HISTORY_COMMAND {
+		events = event.NewJSONWriter(os.NewFile(uintptr(flagConfig.EventsFD), "events"))
+	}
+	if !flagConfig.NoHistory && flagConfig.Mode != util.HISTORY_COMMAND {
+		recorder = newRecorder()
+	}
+	registry, err := serveMetrics(flagConfig)
+	if err != nil {
+		exit(err)
+	}
+	if registry != nil {
+		events = event.Tee(events, recorder, registry)
+	} else {
+		events = event.Tee(events, recorder)
 	}
 
 	switch flagConfig.Mode {
 	case "send":
 		sender := transfer.NewSender(flagConfig)
-		err := sender.Listen()
-		if err != nil {
-			log.Error(err.Error())
+		sender.Events = events
+		if registry != nil {
+			sender.OnReject = registry.Reject
+			sender.OnChunk = registry.ObserveChunk(event.SENDER)
 		}
+		onInterrupt(func() {
+			log.Warningf("shutting down, waiting up to %s for the files in progress (interrupt again to quit now)\n", transfer.SHUTDOWN_TIMEOUT)
+			sender.Shutdown(transfer.SHUTDOWN_TIMEOUT)
+		})
+		exit(sender.Listen())
 
 	case "receive":
 		receiver := transfer.NewReceiver(flagConfig)
-		err := receiver.Connect()
+		receiver.Events = events
+		if registry != nil {
+			receiver.OnChunk = registry.ObserveChunk(event.RECEIVER)
+		}
+		onInterrupt(func() {
+			log.Warning("canceling the transfer (interrupt again to quit now)\n")
+			receiver.Cancel()
+		})
+		exit(receiver.Connect())
+
+	case "tui":
+		exit(tui.Run(flagConfig, recorder))
+
+	case "history":
+		exit(history.Run(flagConfig, os.Stdout))
+
+	case "bench":
+		exit(bench.Run(flagConfig, os.Stdout))
+	}
+}
+
+// Quit with the exit status of the kind of the error, after logging it
+func exit(err error) {
+	if err != nil {
+		log.Error(err.Error())
+	}
+
+	os.Exit(lnkerrors.ExitCode(err))
+}
+
+// Keep the sessions in the history, a transfer goes on without it
+func newRecorder() event.Sink {
+	store, err := history.DefaultStore()
+	if err != nil {
+		log.Warningf("the sessions won't be kept in the history: %s\n", err.Error())
+		return nil
+	}
+
+	return history.NewRecorder(store)
+}
+
+// Serve the metrics of the transfers when -metrics-addr is given, nil otherwise
+func serveMetrics(flagConfig *util.FlagConfig) (*metrics.Registry, error) {
+	if flagConfig.MetricsAddr == "" {
+		return nil, nil
+	}
+
+	role := event.SENDER
+	if flagConfig.Mode == util.CONNECT_COMMAND {
+		role = event.RECEIVER
+	}
+
+	registry := metrics.NewRegistry(role)
+	if err := registry.Serve(flagConfig.MetricsAddr); err != nil {
+		return nil, err
+	}
+	log.Infof("serving the metrics on http://%s/metrics\n", flagConfig.MetricsAddr)
+
+	return registry, nil
+}
+
+// Call stop on the first SIGINT or SIGTERM, a second one exits right away
+func onInterrupt(stop func()) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-signals
+		stop()
+
+		<-signals
+		log.Error("interrupted, quitting without waiting\n")
+		os.Exit(lnkerrors.EXIT_CANCELED)
+	}()
+}
+
+// Set the level and the destinations of the logs and progress bars
+func setupLogging(flagConfig *util.FlagConfig) error {
+	// Keep stdout for the received data or the events
+	output := os.Stdout
+	if flagConfig.Stdout || flagConfig.EventsFD == 1 {
+		output = os.Stderr
+	}
+	log.SetOutput(output)
+	progress.SetOutput(output)
+
+	// Errors always go to stderr
+	if err := color.SetMode(flagConfig.Color, output, os.Stderr); err != nil {
+		return err
+	}
+
+	if flagConfig.Verbose {
+		log.SetLevel(log.DEBUG)
+	} else if flagConfig.Quiet {
+		log.SetLevel(log.ERROR)
+		progress.SetOutput(io.Discard)
+	}
+
+	if flagConfig.LogFile != "" {
+		file, err := os.OpenFile(flagConfig.LogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
 		if err != nil {
-			log.Error(err.Error())
+			return fmt.Errorf("failed to open the log file: %w", err)
 		}
+		log.SetLogFile(file)
 	}
+
+	return nil
 }
@@ -1,19 +1,87 @@
 package config
 
+import "time"
+
 const (
 	RECEIVE_DIRECTORY = "./received/"
+	STDIN_ENTRY       = "-"
+	STREAM_NAME       = "stdin"
+)
+
+const (
+	PROTOCOL_VERSION       = 11
+	CHUNK_MIN_SIZE         = 4 + 8                                      // 4 bytes for SequenceNumber, 8 bytes for DataLength
+	CHUNK_SIZE             = 65536                                      // 64 KB, proposed by default
+	CHUNK_SIZE_LOWER_BOUND = 4096                                       // 4 KB, smallest chunk size that can be negotiated
+	CHUNK_SIZE_UPPER_BOUND = 16777216                                   // 16 MB, largest chunk size that can be negotiated
+	UNKNOWN_REPS           = 0xFFFFFFFF                                 // Chunk count of a stream, which ends with an empty chunk
+	UNKNOWN_SIZE           = 0xFFFFFFFFFFFFFFFF                         // Total size of a transfer including a stream
+	HEARTBEAT              = 0xFF                                       // Sent instead of the transfer header while the receiver waits
+	HEARTBEAT_SEQUENCE     = 0xFFFFFFFF                                 // Sequence number of the empty chunks keeping a quiet stream alive
+	FAILURE_SEQUENCE       = 0xFFFFFFFE                                 // Sequence number of the chunk ending a file the sender can't read, with the reason as data
+	TRANSFER_HEADER_SIZE   = 1 + 1 + 4 + 8 + 8                          // Version + Status + ChunkSize + TotalFiles + TotalBytes
+	TRANSFER_ACK_SIZE      = 4                                          // Negotiated ChunkSize
+	ENTRY_HEADER_SIZE      = 1                                          // Type
+	FILE_ACK_SIZE          = 1 + 8                                      // Status + Offset
+	MAX_FILENAME_LENGTH    = 4096                                       // Longest relative path (PATH_MAX on Linux)
+	MAX_NAME_LENGTH        = 255                                        // Longest path component (NAME_MAX on Linux)
+	FILE_HEADER_MIN_SIZE   = 4 + 4 + 8 + 2                              // 18 bytes without filename
+	FILE_HEADER_MAX_SIZE   = FILE_HEADER_MIN_SIZE + MAX_FILENAME_LENGTH // 4114 bytes
+	RECEIPT_ENTRY_MIN_SIZE = 1 + 8 + 32 + 2 + 2                         // Status + Bytes + SHA-256 + name and reason lengths
+	MAX_REASON_LENGTH      = 1024                                       // Longest reason given for a file that failed
+	SKIP_HEADER_MIN_SIZE   = 8 + 2 + 2                                  // FileSize + name and reason lengths
+	NAME_ELLIPSIS          = "..."                                      // Replaces the start of a name too long for a skip header
+	BEACON_MAGIC           = "LNKR"                                     // Starts every beacon, the other datagrams are ignored
+	BEACON_MIN_SIZE        = 4 + 1 + 2 + 2 + 8 + 8 + 1                  // Magic + Version + SharePort + PreviewPort + TotalFiles + TotalBytes + name length
+	LISTING_ENTRY_MIN_SIZE = 8 + 2                                      // Size + name length
+)
+
+// Status of a share sent to the receiver in the transfer header
+const (
+	SHARE_OPEN   = 0
+	SHARE_CLOSED = 1
+)
+
+// Answer of the receiver to a file header
+const (
+	FILE_ACCEPTED = 1
+)
+
+// Status of a file in the receipt sent by the receiver at the end of a session
+const (
+	RECEIPT_OK      = 0 // Received and written
+	RECEIPT_SKIPPED = 1 // Not written, the session went on
+	RECEIPT_FAILED  = 2
+	RECEIPT_END     = 3 // No more files, closes the receipt
+)
+
+// Type of the next entry in the manifest
+const (
+	ENTRY_FILE  = 0
+	ENTRY_END   = 1
+	ENTRY_ABORT = 2 // The sender is shutting down, the rest of the manifest won't come
+	ENTRY_SKIP  = 3 // The sender can't read an entry, a skip header tells which one and why
+)
+
+// Defaults of the connection settings, 0 disables a timeout
+const (
+	HANDSHAKE_TIMEOUT  = 10 * time.Second // Connecting and agreeing on the session settings
+	IDLE_TIMEOUT       = 60 * time.Second // Waiting for the peer once the transfer started
+	KEEPALIVE_INTERVAL = 15 * time.Second // TCP keepalive probes
+	HEARTBEAT_INTERVAL = 5 * time.Second  // Heartbeats sent during long pauses, shorter than any timeout
+)
+
+// Discovery of the senders on the local network
+const (
+	DISCOVERY_ADDR    = "239.255.76.75:9091" // Multicast group the senders announce themselves to
+	ANNOUNCE_INTERVAL = 2 * time.Second
+	DISCOVERY_TTL     = 3 * ANNOUNCE_INTERVAL // A sender not heard of for that long is gone
+	PREVIEW_MAX_FILES = 10000                 // Files of a manifest listed in a preview, the rest are counted
 )
 
+// Defaults of the receiver attempts after a lost connection
 const (
-	PROTOCOL_VERSION         = 1
-	CHUNK_MIN_SIZE           = 4 + 8 // 4 bytes for SequenceNumber, 8 bytes for DataLength
-	CHUNK_SIZE               = 65536 // 64 KB
-	MAX_ENTRY_COUNT          = 65536
-	DATA_MAX_SIZE            = CHUNK_SIZE - CHUNK_MIN_SIZE
-	DIR_HEADER_SIZE          = 4
-	TRANSFER_HEADER_MIN_SIZE = 1 + 2 // Version + Reps
-	TRANSFER_HEADER_MAX_SIZE = TRANSFER_HEADER_MIN_SIZE + MAX_ENTRY_COUNT
-	MAX_FILENAME_LENGTH      = 255
-	FILE_HEADER_MIN_SIZE     = 4 + 4 + 8 + 2                              // 18 bytes without filename
-	FILE_HEADER_MAX_SIZE     = FILE_HEADER_MIN_SIZE + MAX_FILENAME_LENGTH // 274 bytes
+	RETRIES         = 3
+	RETRY_DELAY     = 1 * time.Second  // Before the first retry, doubled after each one
+	RETRY_MAX_DELAY = 30 * time.Second // Longest wait between two attempts
 )
@@ -1,10 +1,199 @@
 package errors
 
 import (
+	"context"
 	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"syscall"
 )
 
+// Category of a failure, errors.Is(err, Network) tells if an error of this package,
+// or one given to Classify, belongs to one
+type Kind int
+
+const (
+	Unknown    Kind = iota
+	Usage           // Invalid flags or configuration
+	Network         // The peer can't be reached or the connection was lost
+	Protocol        // The peer sent something that can't be understood
+	Auth            // The peer refused the transfer
+	Integrity       // Files missing or different at the other end
+	Filesystem      // A file can't be read or written
+	Canceled        // Stopped by the user, on either side
+)
+
+// Exit status of the program for each kind of failure
+const (
+	EXIT_OK         = 0
+	EXIT_FAILURE    = 1 // Any other failure
+	EXIT_USAGE      = 2
+	EXIT_NETWORK    = 3
+	EXIT_PROTOCOL   = 4
+	EXIT_AUTH       = 5
+	EXIT_INTEGRITY  = 6
+	EXIT_FILESYSTEM = 7
+	EXIT_CANCELED   = 130 // As a shell reports an interrupted command
+)
+
+var kindNames = map[Kind]string{
+	Unknown:    "unknown error",
+	Usage:      "usage error",
+	Network:    "network error",
+	Protocol:   "protocol error",
+	Auth:       "transfer refused",
+	Integrity:  "integrity error",
+	Filesystem: "filesystem error",
+	Canceled:   "canceled",
+}
+
+var exitCodes = map[Kind]int{
+	Unknown:    EXIT_FAILURE,
+	Usage:      EXIT_USAGE,
+	Network:    EXIT_NETWORK,
+	Protocol:   EXIT_PROTOCOL,
+	Auth:       EXIT_AUTH,
+	Integrity:  EXIT_INTEGRITY,
+	Filesystem: EXIT_FILESYSTEM,
+	Canceled:   EXIT_CANCELED,
+}
+
+func (k Kind) Error() string {
+	return kindNames[k]
+}
+
+// Short name of the kind, as found in the JSON events
+func (k Kind) String() string {
+	switch k {
+	case Usage:
+		return "usage"
+	case Network:
+		return "network"
+	case Protocol:
+		return "protocol"
+	case Auth:
+		return "auth"
+	case Integrity:
+		return "integrity"
+	case Filesystem:
+		return "filesystem"
+	case Canceled:
+		return "canceled"
+	}
+
+	return "unknown"
+}
+
+// Get the kind named by String, Unknown for any other name
+func ParseKind(name string) Kind {
+	for kind := range kindNames {
+		if kind.String() == name {
+			return kind
+		}
+	}
+
+	return Unknown
+}
+
+// An error of a known kind
+type Error struct {
+	Kind Kind
+	msg  string
+	err  error
+}
+
+func New(kind Kind, msg string) *Error {
+	return &Error{Kind: kind, msg: msg}
+}
+
+// Give a kind to an error, its message is unchanged
+func Wrap(kind Kind, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &Error{Kind: kind, msg: err.Error(), err: err}
+}
+
+func (e *Error) Error() string {
+	return e.msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// An error matches its kind
+func (e *Error) Is(target error) bool {
+	kind, ok := target.(Kind)
+	return ok && kind == e.Kind
+}
+
 var (
-	InvalidHeaderSize             = errors.New("invalid header size")
-	InvalidChunkSize              = errors.New("invalid chunk size")
+	InvalidUsage         = New(Usage, "invalid usage")
+	InvalidHeaderSize    = New(Protocol, "invalid header size")
+	InvalidChunkSize     = New(Protocol, "invalid chunk size")
+	Malformed            = New(Protocol, "malformed message")
+	UnsupportedVersion   = New(Protocol, "protocol version mismatch")
+	ShareClosed          = New(Auth, "the share is closed")
+	PathNotRepresentable = New(Filesystem, "path can't be represented on this filesystem")
+	PathTooLong          = New(Filesystem, "path too long to be sent")
+	SenderFailed         = New(Filesystem, "the sender couldn't read the file")
+	TransferAborted      = New(Canceled, "the sender aborted the transfer")
+	TransferCanceled     = New(Canceled, "the transfer was canceled")
+	Timeout              = New(Network, "connection timed out")
+	StreamInterrupted    = New(Network, "the stream was interrupted, it can't be resumed")
+	TransferIncomplete   = New(Integrity, "some files were not delivered")
+	VerificationFailed   = New(Integrity, "the data received differs from the data sent")
 )
+
+// Get the kind of an error. The errors of this package carry their kind, the ones
+// of the standard library are recognized
+func KindOf(err error) Kind {
+	if err == nil {
+		return Unknown
+	}
+
+	var known *Error
+	if errors.As(err, &known) {
+		return known.Kind
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return Canceled
+	}
+
+	// A file error holds an errno, which passes for a network error
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) || errors.Is(err, fs.ErrPermission) || errors.Is(err, fs.ErrNotExist) {
+		return Filesystem
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET) {
+		return Network
+	}
+
+	return Unknown
+}
+
+// Give its kind to an error that doesn't carry one yet, so that errors.Is can tell it
+func Classify(err error) error {
+	var known *Error
+	if err == nil || errors.As(err, &known) {
+		return err
+	}
+
+	return Wrap(KindOf(err), err)
+}
+
+// Exit status of the program for an error, EXIT_OK for nil
+func ExitCode(err error) int {
+	if err == nil {
+		return EXIT_OK
+	}
+
+	return exitCodes[KindOf(err)]
+}
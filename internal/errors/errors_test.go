@@ -0,0 +1,77 @@
+package errors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestKindOf(t *testing.T) {
+	_, pathErr := os.Open("/nonexistent/lnkr")
+	_, dialErr := net.Dial("tcp", "127.0.0.1:1")
+
+	tests := []struct {
+		err  error
+		kind Kind
+	}{
+		{fmt.Errorf("%s: %w", "192.168.1.10:9090", ShareClosed), Auth},
+		{fmt.Errorf("failed to deserialize header: %w", InvalidHeaderSize), Protocol},
+		{Wrap(Protocol, io.ErrUnexpectedEOF), Protocol},
+		{fmt.Errorf("3 file(s) not received: %w", TransferIncomplete), Integrity},
+		{fmt.Errorf("%w", TransferCanceled), Canceled},
+		{context.Canceled, Canceled},
+		{fmt.Errorf("failed to dial the server: %w", dialErr), Network},
+		{fmt.Errorf("failed to read header: %w", io.EOF), Network},
+		{fmt.Errorf("failed to create file: %w", pathErr), Filesystem},
+		{&os.PathError{Op: "write", Path: "/dev/stdout", Err: syscall.EPIPE}, Filesystem},
+		{errors.New("something else"), Unknown},
+	}
+
+	for _, test := range tests {
+		if got := KindOf(test.err); got != test.kind {
+			t.Errorf("%v: got kind %s, want %s", test.err, got, test.kind)
+		}
+		if err := Classify(test.err); test.kind != Unknown && !errors.Is(err, test.kind) {
+			t.Errorf("%v: expected errors.Is to match %s", test.err, test.kind)
+		}
+	}
+
+	// The sentinels still match themselves only
+	if errors.Is(fmt.Errorf("%w", ShareClosed), TransferIncomplete) {
+		t.Error("ShareClosed shouldn't match TransferIncomplete")
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		code int
+	}{
+		{nil, EXIT_OK},
+		{errors.New("something else"), EXIT_FAILURE},
+		{Wrap(Usage, errors.New("invalid flag")), EXIT_USAGE},
+		{Timeout, EXIT_NETWORK},
+		{UnsupportedVersion, EXIT_PROTOCOL},
+		{ShareClosed, EXIT_AUTH},
+		{VerificationFailed, EXIT_INTEGRITY},
+		{PathNotRepresentable, EXIT_FILESYSTEM},
+		{TransferCanceled, EXIT_CANCELED},
+	}
+
+	for _, test := range tests {
+		if got := ExitCode(test.err); got != test.code {
+			t.Errorf("%v: got exit code %d, want %d", test.err, got, test.code)
+		}
+	}
+
+	for kind := range kindNames {
+		if ParseKind(kind.String()) != kind {
+			t.Errorf("%s doesn't parse back to itself", kind)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/LxrdShadow/linker/internal/config"
+	"github.com/LxrdShadow/linker/internal/errors"
+)
+
+// Datagram a sender announces itself with on the local network. The receivers reach the
+// share and its preview on the ports given, at the address the beacon came from
+type Beacon struct {
+	Version     byte
+	SharePort   uint16
+	PreviewPort uint16
+	TotalFiles  uint64
+	TotalBytes  uint64 // UNKNOWN_SIZE when one of the entries is a stream
+	Name        string // Of the machine, the long names are cut
+}
+
+// Prepare the beacon of a share
+func PrepareBeacon(name string, sharePort, previewPort uint16, totalFiles, totalBytes uint64) *Beacon {
+	return &Beacon{
+		Version:     config.PROTOCOL_VERSION,
+		SharePort:   sharePort,
+		PreviewPort: previewPort,
+		TotalFiles:  totalFiles,
+		TotalBytes:  totalBytes,
+		Name:        name[:min(len(name), config.MAX_NAME_LENGTH)],
+	}
+}
+
+// Encode the beacon to byte representation
+func (b *Beacon) Serialize() ([]byte, error) {
+	if len(b.Name) > config.MAX_NAME_LENGTH {
+		return nil, fmt.Errorf("name exceeds maximum length of %d bytes", config.MAX_NAME_LENGTH)
+	}
+
+	buff := new(bytes.Buffer)
+	buff.WriteString(config.BEACON_MAGIC)
+
+	fields := []any{b.Version, b.SharePort, b.PreviewPort, b.TotalFiles, b.TotalBytes, uint8(len(b.Name))}
+	for _, field := range fields {
+		if err := binary.Write(buff, binary.BigEndian, field); err != nil {
+			return nil, fmt.Errorf("failed to write beacon: %w", err)
+		}
+	}
+
+	buff.WriteString(b.Name)
+
+	return buff.Bytes(), nil
+}
+
+// Decode a byte representation of a beacon to a Beacon struct, the beacons of
+// other protocol versions are refused
+func DeserializeBeacon(data []byte) (*Beacon, error) {
+	if len(data) < config.BEACON_MIN_SIZE {
+		return nil, errors.InvalidHeaderSize
+	}
+	if string(data[:len(config.BEACON_MAGIC)]) != config.BEACON_MAGIC {
+		return nil, fmt.Errorf("not a beacon: %w", errors.Malformed)
+	}
+
+	reader := bytes.NewReader(data[len(config.BEACON_MAGIC):])
+	var beacon Beacon
+	var nameLength uint8
+
+	fields := []any{&beacon.Version, &beacon.SharePort, &beacon.PreviewPort, &beacon.TotalFiles, &beacon.TotalBytes, &nameLength}
+	for _, field := range fields {
+		if err := binary.Read(reader, binary.BigEndian, field); err != nil {
+			return nil, fmt.Errorf("failed to read beacon: %w", err)
+		}
+	}
+
+	if beacon.Version != config.PROTOCOL_VERSION {
+		return nil, fmt.Errorf("%w: got v%d protocol while using v%d protocol", errors.UnsupportedVersion, beacon.Version, config.PROTOCOL_VERSION)
+	}
+	if reader.Len() != int(nameLength) {
+		return nil, errors.InvalidHeaderSize
+	}
+
+	name := make([]byte, nameLength)
+	if _, err := io.ReadFull(reader, name); err != nil {
+		return nil, fmt.Errorf("failed to read beacon: %w", err)
+	}
+	beacon.Name = string(name)
+
+	return &beacon, nil
+}
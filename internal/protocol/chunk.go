@@ -16,55 +16,84 @@ type Chunk struct {
 	Data           []byte
 }
 
+// Prepare an empty chunk telling the receiver that the stream goes on,
+// padded like every chunk to the negotiated size
+func PrepareHeartbeatChunk(chunkSize uint32) *Chunk {
+	return &Chunk{
+		SequenceNumber: config.HEARTBEAT_SEQUENCE,
+		Data:           make([]byte, chunkSize-config.CHUNK_MIN_SIZE),
+	}
+}
+
+// Check if the chunk only keeps the connection alive
+func (ch *Chunk) IsHeartbeat() bool {
+	return ch.SequenceNumber == config.HEARTBEAT_SEQUENCE && ch.DataLength == 0
+}
+
+// Prepare the chunk telling the receiver that the rest of a file won't come,
+// the reason is its data
+func PrepareFailureChunk(chunkSize uint32, reason string) *Chunk {
+	data := make([]byte, chunkSize-config.CHUNK_MIN_SIZE)
+	n := copy(data, reason[:min(len(reason), config.MAX_REASON_LENGTH)])
+
+	return &Chunk{
+		SequenceNumber: config.FAILURE_SEQUENCE,
+		DataLength:     uint64(n),
+		Data:           data,
+	}
+}
+
+// Check if the chunk ends a file that the sender couldn't read
+func (ch *Chunk) IsFailure() bool {
+	return ch.SequenceNumber == config.FAILURE_SEQUENCE
+}
+
 // Encode the chunk to byte representation
 func (ch *Chunk) Serialize() ([]byte, error) {
 	buff := new(bytes.Buffer)
 	if err := binary.Write(buff, binary.BigEndian, ch.SequenceNumber); err != nil {
-		return nil, fmt.Errorf("failed to write chunk sequence number: %w\n", err)
+		return nil, fmt.Errorf("failed to write chunk sequence number: %w", err)
 	}
 
 	if err := binary.Write(buff, binary.BigEndian, ch.DataLength); err != nil {
-		return nil, fmt.Errorf("failed to write chunk data length: %w\n", err)
+		return nil, fmt.Errorf("failed to write chunk data length: %w", err)
 	}
 
 	if _, err := buff.Write(ch.Data); err != nil {
-		return nil, fmt.Errorf("failed to write chunk data: %w\n", err)
+		return nil, fmt.Errorf("failed to write chunk data: %w", err)
 	}
 
 	return buff.Bytes(), nil
 }
 
-// Decode a byte representation of a header to a Header struct
+// Decode a byte representation of a chunk to a Chunk struct
 func DeserializeChunk(data []byte) (*Chunk, error) {
 	if len(data) < config.CHUNK_MIN_SIZE {
 		return nil, errors.InvalidChunkSize
 	}
 
-	// fmt.Println(binary.BigEndian.Uint64(data[4:12]))
-
 	reader := bytes.NewReader(data)
 	var chunk Chunk
 
 	// Sequence Number
 	if err := binary.Read(reader, binary.BigEndian, &chunk.SequenceNumber); err != nil {
-		return nil, fmt.Errorf("failed to read chunk sequence number: %w\n", err)
+		return nil, fmt.Errorf("failed to read chunk sequence number: %w", err)
 	}
 
 	// Data Length
 	if err := binary.Read(reader, binary.BigEndian, &chunk.DataLength); err != nil {
-		return nil, fmt.Errorf("failed to read chunk data length: %w\n", err)
+		return nil, fmt.Errorf("failed to read chunk data length: %w", err)
 	}
-	// fmt.Println("length:", chunk.DataLength)
-	// fmt.Println("data:", len(chunk.Data))
 
-	// Data
-	if uint64(len(data)) < uint64(chunk.DataLength+config.CHUNK_MIN_SIZE) {
-		return nil, fmt.Errorf("not enough data to read the chunk data: got %d want %d", len(data), chunk.DataLength+config.CHUNK_MIN_SIZE)
+	// The length comes from the peer, it can't go past the data received
+	if chunk.DataLength > uint64(reader.Len()) {
+		return nil, fmt.Errorf("not enough data to read the chunk data: got %d want %d: %w", reader.Len(), chunk.DataLength, errors.InvalidChunkSize)
 	}
-	chunk.Data = make([]byte, chunk.DataLength)
 
-	if err := binary.Read(reader, binary.BigEndian, &chunk.Data); err != nil && err != io.EOF {
-		return nil, fmt.Errorf("failed to read chunk data: %w\n", err)
+	// Data
+	chunk.Data = make([]byte, chunk.DataLength)
+	if _, err := io.ReadFull(reader, chunk.Data); err != nil {
+		return nil, fmt.Errorf("failed to read chunk data: %w", err)
 	}
 
 	return &chunk, nil
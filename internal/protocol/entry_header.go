@@ -0,0 +1,68 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/LxrdShadow/linker/internal/config"
+	"github.com/LxrdShadow/linker/internal/errors"
+)
+
+// Announces what comes next in the manifest, which is streamed one entry at a time
+type EntryHeader struct {
+	Type byte
+}
+
+// Prepare the header announcing a file (a file header and its chunks follow)
+func PrepareFileEntryHeader() *EntryHeader {
+	return &EntryHeader{Type: config.ENTRY_FILE}
+}
+
+// Prepare the header marking the end of the manifest
+func PrepareEndEntryHeader() *EntryHeader {
+	return &EntryHeader{Type: config.ENTRY_END}
+}
+
+// Prepare the header telling the receiver that the sender stops before the end of the manifest
+func PrepareAbortEntryHeader() *EntryHeader {
+	return &EntryHeader{Type: config.ENTRY_ABORT}
+}
+
+// Prepare the header announcing an entry the sender can't read (a skip header follows)
+func PrepareSkipEntryHeader() *EntryHeader {
+	return &EntryHeader{Type: config.ENTRY_SKIP}
+}
+
+// Encode the header to byte representation
+func (eh *EntryHeader) Serialize() ([]byte, error) {
+	buff := new(bytes.Buffer)
+
+	// Type of the entry
+	if err := binary.Write(buff, binary.BigEndian, eh.Type); err != nil {
+		return nil, fmt.Errorf("failed to write entry type: %w", err)
+	}
+
+	return buff.Bytes(), nil
+}
+
+// Decode a byte representation of a header to an EntryHeader struct
+func DeserializeEntryHeader(data []byte) (*EntryHeader, error) {
+	if len(data) < config.ENTRY_HEADER_SIZE {
+		return nil, errors.InvalidHeaderSize
+	}
+
+	reader := bytes.NewReader(data)
+	var header EntryHeader
+
+	// Type of the entry
+	if err := binary.Read(reader, binary.BigEndian, &header.Type); err != nil {
+		return nil, fmt.Errorf("failed to read entry type: %w", err)
+	}
+
+	if header.Type > config.ENTRY_SKIP {
+		return nil, fmt.Errorf("unknown entry type: %d", header.Type)
+	}
+
+	return &header, nil
+}
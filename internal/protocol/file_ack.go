@@ -0,0 +1,64 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/LxrdShadow/linker/internal/config"
+	"github.com/LxrdShadow/linker/internal/errors"
+)
+
+// Answer of the receiver to a file header
+type FileAck struct {
+	Status byte
+	Offset uint64 // Bytes of the file the receiver already has, the chunks before it are not sent
+}
+
+// Prepare the answer accepting a file, from the given offset
+func PrepareFileAck(offset uint64) *FileAck {
+	return &FileAck{Status: config.FILE_ACCEPTED, Offset: offset}
+}
+
+// Encode the acknowledgment to byte representation
+func (fa *FileAck) Serialize() ([]byte, error) {
+	buff := new(bytes.Buffer)
+
+	// Status
+	if err := binary.Write(buff, binary.BigEndian, fa.Status); err != nil {
+		return nil, fmt.Errorf("failed to write file status: %w", err)
+	}
+
+	// Offset
+	if err := binary.Write(buff, binary.BigEndian, fa.Offset); err != nil {
+		return nil, fmt.Errorf("failed to write file offset: %w", err)
+	}
+
+	return buff.Bytes(), nil
+}
+
+// Decode a byte representation of an acknowledgment to a FileAck struct
+func DeserializeFileAck(data []byte) (*FileAck, error) {
+	if len(data) < config.FILE_ACK_SIZE {
+		return nil, errors.InvalidHeaderSize
+	}
+
+	reader := bytes.NewReader(data)
+	var ack FileAck
+
+	// Status
+	if err := binary.Read(reader, binary.BigEndian, &ack.Status); err != nil {
+		return nil, fmt.Errorf("failed to read file status: %w", err)
+	}
+
+	if ack.Status != config.FILE_ACCEPTED {
+		return nil, fmt.Errorf("unknown file status: %d", ack.Status)
+	}
+
+	// Offset
+	if err := binary.Read(reader, binary.BigEndian, &ack.Offset); err != nil {
+		return nil, fmt.Errorf("failed to read file offset: %w", err)
+	}
+
+	return &ack, nil
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 
@@ -20,10 +21,10 @@ type FileHeader struct {
 }
 
 // Prepare the header with the informations about the file
-func PrepareFileHeader(file *os.File, baseDir string) (*FileHeader, error) {
+func PrepareFileHeader(file *os.File, baseDir string, chunkSize uint32) (*FileHeader, error) {
 	fileInfo, err := file.Stat()
 	if err != nil {
-		return nil, fmt.Errorf("Failed to get file info: %w\n", err)
+		return nil, fmt.Errorf("Failed to get file info: %w", err)
 	}
 	size := fileInfo.Size()
 	var name string
@@ -33,57 +34,134 @@ func PrepareFileHeader(file *os.File, baseDir string) (*FileHeader, error) {
 	} else {
 		name, err = filepath.Rel(baseDir, file.Name())
 		if err != nil {
-			return nil, fmt.Errorf("Failed to get file relative path: %w\n", err)
+			return nil, fmt.Errorf("Failed to get file relative path: %w", err)
 		}
 	}
 
+	dataSize := int64(chunkSize - config.CHUNK_MIN_SIZE)
+
 	header := &FileHeader{
-		ChunkSize:      config.CHUNK_SIZE,
-		Reps:           uint32(size/config.CHUNK_SIZE) + 1,
+		ChunkSize:      chunkSize,
+		Reps:           uint32(size/dataSize) + 1,
 		FileSize:       uint64(size),
 		FileNameLength: uint16(len(name)),
 		FileName:       name,
 	}
+	if err := header.CheckName(); err != nil {
+		return nil, err
+	}
 
 	return header, nil
 }
 
+// Prepare the header for a stream whose size is unknown until it ends
+func PrepareStreamHeader(name string, chunkSize uint32) *FileHeader {
+	return &FileHeader{
+		ChunkSize:      chunkSize,
+		Reps:           config.UNKNOWN_REPS,
+		FileSize:       0,
+		FileNameLength: uint16(len(name)),
+		FileName:       name,
+	}
+}
+
+// Check if the entry is a stream ended by an empty chunk
+func (h *FileHeader) IsStream() bool {
+	return h.Reps == config.UNKNOWN_REPS
+}
+
+// Index of the first chunk to send for a file acknowledged at the given offset,
+// the offset is rounded down to a chunk boundary
+func (h *FileHeader) FirstChunk(offset uint64) uint32 {
+	if h.IsStream() || h.ChunkSize <= config.CHUNK_MIN_SIZE {
+		return 0
+	}
+	dataSize := uint64(h.ChunkSize - config.CHUNK_MIN_SIZE)
+
+	if offset >= h.FileSize {
+		return h.Reps
+	}
+
+	return uint32(offset / dataSize)
+}
+
+// Check that the chunk count announced by the peer matches the size of the file,
+// so that no more than the size is ever written
+func (h *FileHeader) CheckReps() error {
+	if h.IsStream() {
+		return nil
+	}
+	if h.ChunkSize <= config.CHUNK_MIN_SIZE {
+		return errors.InvalidChunkSize
+	}
+
+	dataSize := uint64(h.ChunkSize - config.CHUNK_MIN_SIZE)
+	if want := h.FileSize/dataSize + 1; uint64(h.Reps) != want {
+		return fmt.Errorf("%s: got %d chunks for %d bytes instead of %d: %w", h.FileName, h.Reps, h.FileSize, want, errors.InvalidHeaderSize)
+	}
+
+	return nil
+}
+
+// Check that the name fits in the header, before anything about the file is sent
+func (h *FileHeader) CheckName() error {
+	if len(h.FileName) > config.MAX_FILENAME_LENGTH {
+		return fmt.Errorf("filename of %d bytes exceeds maximum length of %d bytes: %w", len(h.FileName), config.MAX_FILENAME_LENGTH, errors.PathTooLong)
+	}
+
+	return nil
+}
+
 // Encode the header to byte representation
 func (h *FileHeader) Serialize() ([]byte, error) {
-	if len(h.FileName) > config.MAX_FILENAME_LENGTH {
-		return nil, fmt.Errorf("filename exceeds maximum length of %d bytes\n", config.MAX_FILENAME_LENGTH)
+	if err := h.CheckName(); err != nil {
+		return nil, err
 	}
 
 	buff := new(bytes.Buffer)
 
 	// Chunk size
 	if err := binary.Write(buff, binary.BigEndian, h.ChunkSize); err != nil {
-		return nil, fmt.Errorf("failed to write chunk size: %w\n", err)
+		return nil, fmt.Errorf("failed to write chunk size: %w", err)
 	}
 
 	// Chunk count (repetitions)
 	if err := binary.Write(buff, binary.BigEndian, h.Reps); err != nil {
-		return nil, fmt.Errorf("failed to write reps: %w\n", err)
+		return nil, fmt.Errorf("failed to write reps: %w", err)
 	}
 
 	// File size
 	if err := binary.Write(buff, binary.BigEndian, h.FileSize); err != nil {
-		return nil, fmt.Errorf("failed to write file size: %w\n", err)
+		return nil, fmt.Errorf("failed to write file size: %w", err)
 	}
 
 	// Length of the file name
 	if err := binary.Write(buff, binary.BigEndian, h.FileNameLength); err != nil {
-		return nil, fmt.Errorf("failed to write filename length: %w\n", err)
+		return nil, fmt.Errorf("failed to write filename length: %w", err)
 	}
 
 	// The actual name of the file
 	if _, err := buff.WriteString(h.FileName); err != nil {
-		return nil, fmt.Errorf("failed to write filename: %w\n", err)
+		return nil, fmt.Errorf("failed to write filename: %w", err)
 	}
 
 	return buff.Bytes(), nil
 }
 
+// Get the size of the encoded header from its fixed-size part
+func FileHeaderSize(data []byte) (int, error) {
+	if len(data) < config.FILE_HEADER_MIN_SIZE {
+		return 0, errors.InvalidHeaderSize
+	}
+
+	nameLength := binary.BigEndian.Uint16(data[config.FILE_HEADER_MIN_SIZE-2:])
+	if nameLength > config.MAX_FILENAME_LENGTH {
+		return 0, fmt.Errorf("filename exceeds maximum length of %d bytes", config.MAX_FILENAME_LENGTH)
+	}
+
+	return config.FILE_HEADER_MIN_SIZE + int(nameLength), nil
+}
+
 // Decode a byte representation of a header to a Header struct
 func DeserializeHeader(data []byte) (*FileHeader, error) {
 	if len(data) < config.FILE_HEADER_MIN_SIZE || len(data) > config.FILE_HEADER_MAX_SIZE {
@@ -95,32 +173,32 @@ func DeserializeHeader(data []byte) (*FileHeader, error) {
 
 	// Chunk size
 	if err := binary.Read(reader, binary.BigEndian, &header.ChunkSize); err != nil {
-		return nil, fmt.Errorf("failed to read chunk size: %w\n", err)
+		return nil, fmt.Errorf("failed to read chunk size: %w", err)
 	}
 
 	// Chunk count (repetitions)
 	if err := binary.Read(reader, binary.BigEndian, &header.Reps); err != nil {
-		return nil, fmt.Errorf("failed to read reps: %w\n", err)
+		return nil, fmt.Errorf("failed to read reps: %w", err)
 	}
 
 	// File size
 	if err := binary.Read(reader, binary.BigEndian, &header.FileSize); err != nil {
-		return nil, fmt.Errorf("failed to read file size: %w\n", err)
+		return nil, fmt.Errorf("failed to read file size: %w", err)
 	}
 
 	// Length of the file name
 	if err := binary.Read(reader, binary.BigEndian, &header.FileNameLength); err != nil {
-		return nil, fmt.Errorf("failed to read filename length: %w\n", err)
+		return nil, fmt.Errorf("failed to read filename length: %w", err)
 	}
 
 	if header.FileNameLength > config.MAX_FILENAME_LENGTH {
-		return nil, fmt.Errorf("filename exceeds maximum length of %d bytes\n", config.MAX_FILENAME_LENGTH)
+		return nil, fmt.Errorf("filename exceeds maximum length of %d bytes", config.MAX_FILENAME_LENGTH)
 	}
 
 	// The actual name of the file
 	fileNameBytes := make([]byte, header.FileNameLength)
-	if _, err := reader.Read(fileNameBytes); err != nil {
-		return nil, fmt.Errorf("failed to read filename: %w\n", err)
+	if _, err := io.ReadFull(reader, fileNameBytes); err != nil {
+		return nil, fmt.Errorf("failed to read filename: %w", err)
 	}
 	header.FileName = string(fileNameBytes)
 
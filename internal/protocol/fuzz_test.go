@@ -0,0 +1,203 @@
+package protocol
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/LxrdShadow/linker/internal/config"
+)
+
+// The decoders read what an untrusted peer sends: whatever the bytes, they return an error
+// or a packet that encodes back to the same bytes. Run one with go test -fuzz=FuzzDeserializeChunk
+
+// Check that a decoded packet encodes back to the bytes it was decoded from
+func assertRoundTrip(t *testing.T, packet Packet, data []byte) {
+	t.Helper()
+
+	buff, err := packet.Serialize()
+	if err != nil {
+		t.Fatalf("failed to serialize the decoded %+v: %v", packet, err)
+	}
+	if !bytes.Equal(buff, data) {
+		t.Fatalf("%+v encodes to %x instead of %x", packet, buff, data)
+	}
+}
+
+func FuzzDeserializeTransferHeader(f *testing.F) {
+	for _, header := range []*TransferHeader{PrepareTransferHeader(config.CHUNK_SIZE, 3, 1<<20), PrepareClosedTransferHeader()} {
+		buff, _ := header.Serialize()
+		f.Add(buff)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		header, err := DeserializeTransferHeader(data)
+		if err != nil {
+			return
+		}
+		assertRoundTrip(t, header, data[:config.TRANSFER_HEADER_SIZE])
+	})
+}
+
+func FuzzDeserializeTransferAck(f *testing.F) {
+	buff, _ := (&TransferAck{ChunkSize: config.CHUNK_SIZE}).Serialize()
+	f.Add(buff)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ack, err := DeserializeTransferAck(data)
+		if err != nil {
+			return
+		}
+		if !ValidChunkSize(ack.ChunkSize) {
+			t.Fatalf("accepted the chunk size %d", ack.ChunkSize)
+		}
+		assertRoundTrip(t, ack, data[:config.TRANSFER_ACK_SIZE])
+	})
+}
+
+func FuzzDeserializeEntryHeader(f *testing.F) {
+	for _, header := range []*EntryHeader{PrepareFileEntryHeader(), PrepareEndEntryHeader(), PrepareAbortEntryHeader(), PrepareSkipEntryHeader()} {
+		buff, _ := header.Serialize()
+		f.Add(buff)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		header, err := DeserializeEntryHeader(data)
+		if err != nil {
+			return
+		}
+		assertRoundTrip(t, header, data[:config.ENTRY_HEADER_SIZE])
+	})
+}
+
+func FuzzDeserializeHeader(f *testing.F) {
+	for _, header := range []*FileHeader{
+		{ChunkSize: config.CHUNK_SIZE, Reps: 1, FileSize: 12, FileNameLength: 9, FileName: "hello.txt"},
+		PrepareStreamHeader("backup.tar", config.CHUNK_SIZE),
+	} {
+		buff, _ := header.Serialize()
+		f.Add(buff)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// The receiver reads the size first, then the rest of the header
+		size, err := FileHeaderSize(data)
+		if err != nil || size > len(data) {
+			return
+		}
+
+		header, err := DeserializeHeader(data[:size])
+		if err != nil {
+			return
+		}
+		if int(header.FileNameLength) != len(header.FileName) {
+			t.Fatalf("the name %q doesn't have the length %d", header.FileName, header.FileNameLength)
+		}
+		assertRoundTrip(t, header, data[:size])
+
+		// Whatever the chunk count, an accepted header never resumes past its last chunk
+		if header.CheckReps() == nil && header.FirstChunk(header.FileSize) > header.Reps {
+			t.Fatalf("%+v resumes past its last chunk", header)
+		}
+	})
+}
+
+func FuzzDeserializeFileAck(f *testing.F) {
+	buff, _ := PrepareFileAck(1 << 30).Serialize()
+	f.Add(buff)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ack, err := DeserializeFileAck(data)
+		if err != nil {
+			return
+		}
+		assertRoundTrip(t, ack, data[:config.FILE_ACK_SIZE])
+	})
+}
+
+func FuzzDeserializeChunk(f *testing.F) {
+	for _, chunk := range []*Chunk{
+		{SequenceNumber: 3, DataLength: 5, Data: []byte("hello")},
+		PrepareHeartbeatChunk(config.CHUNK_SIZE_LOWER_BOUND),
+		PrepareFailureChunk(config.CHUNK_SIZE_LOWER_BOUND, "failed to read the file"),
+	} {
+		buff, _ := chunk.Serialize()
+		f.Add(buff)
+	}
+	// A length that overflows once the size of the fixed part is added
+	f.Add([]byte{0, 0, 0, 1, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 'x'})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		chunk, err := DeserializeChunk(data)
+		if err != nil {
+			return
+		}
+		if chunk.DataLength != uint64(len(chunk.Data)) || len(chunk.Data) > len(data)-config.CHUNK_MIN_SIZE {
+			t.Fatalf("decoded %d bytes of data with a length of %d out of %d bytes", len(chunk.Data), chunk.DataLength, len(data))
+		}
+		assertRoundTrip(t, chunk, data[:config.CHUNK_MIN_SIZE+len(chunk.Data)])
+	})
+}
+
+func FuzzDeserializeSkipHeader(f *testing.F) {
+	buff, _ := PrepareSkipHeader("dir/secret.txt", 42, "failed to open file: permission denied").Serialize()
+	f.Add(buff)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		header, err := DeserializeSkipHeader(data)
+		if err != nil {
+			return
+		}
+		size, _ := SkipHeaderSize(data)
+		assertRoundTrip(t, header, data[:size])
+	})
+}
+
+func FuzzDeserializeReceiptEntry(f *testing.F) {
+	entries := []*ReceiptEntry{
+		{Status: config.RECEIPT_OK, Bytes: 12, Hash: [32]byte{1, 2, 3}, Name: "dir/hello.txt"},
+		{Status: config.RECEIPT_SKIPPED, Name: "too/long", Reason: "path can't be represented on this filesystem"},
+		PrepareReceiptEnd(),
+	}
+	for _, entry := range entries {
+		buff, _ := entry.Serialize()
+		f.Add(buff)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		entry, err := DeserializeReceiptEntry(data)
+		if err != nil {
+			return
+		}
+		size, _ := ReceiptEntrySize(data)
+		assertRoundTrip(t, entry, data[:size])
+	})
+}
+
+func FuzzDeserializeBeacon(f *testing.F) {
+	buff, _ := PrepareBeacon("laptop", 9090, 41234, 3, 1<<20).Serialize()
+	f.Add(buff)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		beacon, err := DeserializeBeacon(data)
+		if err != nil {
+			return
+		}
+		assertRoundTrip(t, beacon, data)
+	})
+}
+
+func FuzzDeserializeListingEntry(f *testing.F) {
+	for _, entry := range []*ListingEntry{{Size: 12, Name: "dir/hello.txt"}, PrepareListingEnd()} {
+		buff, _ := entry.Serialize()
+		f.Add(buff)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		entry, err := DeserializeListingEntry(data)
+		if err != nil {
+			return
+		}
+		size, _ := ListingEntrySize(data)
+		assertRoundTrip(t, entry, data[:size])
+	})
+}
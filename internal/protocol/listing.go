@@ -0,0 +1,92 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/LxrdShadow/linker/internal/config"
+	"github.com/LxrdShadow/linker/internal/errors"
+)
+
+// A file of the manifest, as listed to a receiver previewing a share. The preview is a
+// transfer header followed by the entries, closed by an entry without a name
+type ListingEntry struct {
+	Size uint64 // UNKNOWN_SIZE for a stream, 0 when the sender can't read the file
+	Name string
+}
+
+// Prepare the entry closing the listing
+func PrepareListingEnd() *ListingEntry {
+	return &ListingEntry{}
+}
+
+// Check if the entry closes the listing
+func (e *ListingEntry) IsEnd() bool {
+	return e.Name == ""
+}
+
+// Encode the entry to byte representation
+func (e *ListingEntry) Serialize() ([]byte, error) {
+	if len(e.Name) > config.MAX_FILENAME_LENGTH {
+		return nil, fmt.Errorf("filename exceeds maximum length of %d bytes", config.MAX_FILENAME_LENGTH)
+	}
+
+	buff := new(bytes.Buffer)
+
+	fields := []any{e.Size, uint16(len(e.Name))}
+	for _, field := range fields {
+		if err := binary.Write(buff, binary.BigEndian, field); err != nil {
+			return nil, fmt.Errorf("failed to write listing entry: %w", err)
+		}
+	}
+
+	buff.WriteString(e.Name)
+
+	return buff.Bytes(), nil
+}
+
+// Get the size of the encoded entry from its fixed-size part
+func ListingEntrySize(data []byte) (int, error) {
+	if len(data) < config.LISTING_ENTRY_MIN_SIZE {
+		return 0, errors.InvalidHeaderSize
+	}
+
+	nameLength := binary.BigEndian.Uint16(data[8:])
+	if nameLength > config.MAX_FILENAME_LENGTH {
+		return 0, fmt.Errorf("listing entry too long: %w", errors.InvalidHeaderSize)
+	}
+
+	return config.LISTING_ENTRY_MIN_SIZE + int(nameLength), nil
+}
+
+// Decode a byte representation of an entry to a ListingEntry struct
+func DeserializeListingEntry(data []byte) (*ListingEntry, error) {
+	size, err := ListingEntrySize(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < size {
+		return nil, errors.InvalidHeaderSize
+	}
+
+	reader := bytes.NewReader(data[:size])
+	var entry ListingEntry
+	var nameLength uint16
+
+	fields := []any{&entry.Size, &nameLength}
+	for _, field := range fields {
+		if err := binary.Read(reader, binary.BigEndian, field); err != nil {
+			return nil, fmt.Errorf("failed to read listing entry: %w", err)
+		}
+	}
+
+	name := make([]byte, nameLength)
+	if _, err := io.ReadFull(reader, name); err != nil {
+		return nil, fmt.Errorf("failed to read listing entry: %w", err)
+	}
+	entry.Name = string(name)
+
+	return &entry, nil
+}
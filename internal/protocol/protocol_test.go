@@ -1,14 +1,18 @@
 package protocol
 
 import (
+	"bytes"
+	"errors"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/LxrdShadow/linker/internal/config"
+	lnkerrors "github.com/LxrdShadow/linker/internal/errors"
 )
 
-// Guys, I have no idea how to test this T_T
+// The messages are tested one by one here, the exchange of a whole transfer in pkg/transfer
 
 func TestPrepareFileHeader(t *testing.T) {
 	filename := "hello.txt"
@@ -18,7 +22,7 @@ func TestPrepareFileHeader(t *testing.T) {
 	defer os.Remove(filename)
 
 	t.Run("prepare the headers for a test file", func(t *testing.T) {
-		header, _ := PrepareFileHeader(file, "")
+		header, _ := PrepareFileHeader(file, "", config.CHUNK_SIZE)
 
 		if header.FileNameLength != 9 {
 			t.Errorf("Wrong length: got %d want %d", header.FileNameLength, 9)
@@ -58,6 +62,102 @@ func TestSerializeHeader(t *testing.T) {
 	assertEqual(t, got, header)
 }
 
+func TestSerializeLongPathHeader(t *testing.T) {
+	name := strings.Repeat("directory/", 300) + "hello.txt"
+	header := &FileHeader{
+		ChunkSize:      1024,
+		Reps:           1,
+		FileSize:       12,
+		FileNameLength: uint16(len(name)),
+		FileName:       name,
+	}
+
+	buff, err := header.Serialize()
+	if err != nil {
+		t.Fatalf("failed to serialize: %v", err)
+	}
+
+	size, _ := FileHeaderSize(buff[:config.FILE_HEADER_MIN_SIZE])
+	if size != len(buff) {
+		t.Errorf("Wrong header size: got %d want %d", size, len(buff))
+	}
+
+	got, _ := DeserializeHeader(buff)
+	assertEqual(t, got, header)
+}
+
+func TestSerializeStreamHeader(t *testing.T) {
+	header := PrepareStreamHeader("backup.tar", config.CHUNK_SIZE)
+
+	buff, _ := header.Serialize()
+	got, _ := DeserializeHeader(buff)
+
+	assertEqual(t, got, header)
+
+	if !got.IsStream() {
+		t.Errorf("expected %+v to be a stream", got)
+	}
+}
+
+func TestSerializeTransferHeader(t *testing.T) {
+	header := PrepareTransferHeader(config.CHUNK_SIZE, 5000, 1<<40)
+
+	buff, _ := header.Serialize()
+	got, _ := DeserializeTransferHeader(buff)
+
+	assertEqual(t, got, header)
+}
+
+func TestSerializeClosedTransferHeader(t *testing.T) {
+	header := PrepareClosedTransferHeader()
+
+	buff, _ := header.Serialize()
+	got, err := DeserializeTransferHeader(buff)
+	if err != nil {
+		t.Fatalf("failed to deserialize: %v", err)
+	}
+
+	if got.Status != config.SHARE_CLOSED {
+		t.Errorf("Wrong status: got %d want %d", got.Status, config.SHARE_CLOSED)
+	}
+}
+
+func TestSerializeEntryHeader(t *testing.T) {
+	for _, header := range []*EntryHeader{PrepareFileEntryHeader(), PrepareEndEntryHeader(), PrepareAbortEntryHeader()} {
+		buff, _ := header.Serialize()
+		got, _ := DeserializeEntryHeader(buff)
+
+		assertEqual(t, got, header)
+	}
+
+	if _, err := DeserializeEntryHeader([]byte{42}); err == nil {
+		t.Errorf("expected an error for an unknown entry type")
+	}
+}
+
+func TestNegotiateChunkSize(t *testing.T) {
+	cases := []struct {
+		proposed, accepted, want uint32
+	}{
+		{proposed: 65536, accepted: 1 << 20, want: 65536},
+		{proposed: 1 << 20, accepted: 65536, want: 65536},
+		{proposed: 1 << 30, accepted: 1 << 30, want: config.CHUNK_SIZE_UPPER_BOUND},
+		{proposed: 16, accepted: 65536, want: config.CHUNK_SIZE_LOWER_BOUND},
+	}
+
+	for _, test := range cases {
+		got := NegotiateChunkSize(test.proposed, test.accepted)
+		if got != test.want {
+			t.Errorf("Wrong chunk size for %d/%d: got %d want %d", test.proposed, test.accepted, got, test.want)
+		}
+	}
+
+	buff, _ := (&TransferAck{ChunkSize: 1 << 30}).Serialize()
+	if _, err := DeserializeTransferAck(buff); err == nil {
+		t.Errorf("expected an error for an out of bounds chunk size")
+	}
+}
+
 func TestSerializeChunk(t *testing.T) {
 	chunk := &Chunk{
 		SequenceNumber: 2,
@@ -77,3 +177,223 @@ func assertEqual(t *testing.T, got any, want any) {
 		t.Errorf("value mismatch: got %+v, want %+v", got, want)
 	}
 }
+
+func TestHeartbeatChunk(t *testing.T) {
+	buff, _ := PrepareHeartbeatChunk(config.CHUNK_SIZE_LOWER_BOUND).Serialize()
+	if len(buff) != config.CHUNK_SIZE_LOWER_BOUND {
+		t.Fatalf("a heartbeat should be padded like any chunk: got %d bytes want %d", len(buff), config.CHUNK_SIZE_LOWER_BOUND)
+	}
+
+	got, _ := DeserializeChunk(buff)
+	if !got.IsHeartbeat() {
+		t.Errorf("expected a heartbeat, got %+v", got)
+	}
+
+	if (&Chunk{SequenceNumber: 3}).IsHeartbeat() {
+		t.Error("an empty chunk ending a stream is not a heartbeat")
+	}
+}
+
+func TestSerializeFileAck(t *testing.T) {
+	ack := PrepareFileAck(123456)
+
+	buff, _ := ack.Serialize()
+	if len(buff) != config.FILE_ACK_SIZE {
+		t.Fatalf("size mismatch: got %d want %d", len(buff), config.FILE_ACK_SIZE)
+	}
+
+	got, _ := DeserializeFileAck(buff)
+	assertEqual(t, got, ack)
+
+	if _, err := DeserializeFileAck([]byte{42, 0, 0, 0, 0, 0, 0, 0, 0}); err == nil {
+		t.Errorf("expected an error for an unknown status")
+	}
+}
+
+func TestFirstChunk(t *testing.T) {
+	// 100 bytes of data per chunk, 3 chunks for 250 bytes
+	header := &FileHeader{ChunkSize: 100 + config.CHUNK_MIN_SIZE, FileSize: 250, Reps: 3}
+
+	cases := map[uint64]uint32{
+		0:   0,
+		99:  0, // Rounded down to the start of the chunk
+		100: 1,
+		200: 2,
+		250: 3, // Complete, nothing to send
+		400: 3,
+	}
+
+	for offset, want := range cases {
+		if got := header.FirstChunk(offset); got != want {
+			t.Errorf("first chunk mismatch at offset %d: got %d want %d", offset, got, want)
+		}
+	}
+}
+
+func TestSerializeReceipt(t *testing.T) {
+	entries := []*ReceiptEntry{
+		{Status: config.RECEIPT_OK, Bytes: 12, Hash: [32]byte{1, 2, 3}, Name: "dir/hello.txt"},
+		{Status: config.RECEIPT_SKIPPED, Name: "too/long", Reason: "path can't be represented on this filesystem"},
+		PrepareReceiptEnd(),
+	}
+
+	for _, entry := range entries {
+		buff, err := entry.Serialize()
+		if err != nil {
+			t.Fatalf("failed to serialize: %v", err)
+		}
+
+		size, err := ReceiptEntrySize(buff[:config.RECEIPT_ENTRY_MIN_SIZE])
+		if err != nil || size != len(buff) {
+			t.Errorf("Wrong receipt entry size: got %d (%v) want %d", size, err, len(buff))
+		}
+
+		got, err := DeserializeReceiptEntry(buff)
+		if err != nil {
+			t.Fatalf("failed to deserialize: %v", err)
+		}
+		assertEqual(t, got, entry)
+	}
+
+	if !entries[2].IsEnd() || entries[0].IsEnd() {
+		t.Error("only the last entry should close the receipt")
+	}
+
+	// The reasons are cut to a reasonable length
+	long := &ReceiptEntry{Status: config.RECEIPT_FAILED, Name: "x", Reason: strings.Repeat("why", 1000)}
+	buff, _ := long.Serialize()
+	got, _ := DeserializeReceiptEntry(buff)
+	if len(got.Reason) != config.MAX_REASON_LENGTH {
+		t.Errorf("Wrong reason length: got %d want %d", len(got.Reason), config.MAX_REASON_LENGTH)
+	}
+
+	// A status that doesn't exist
+	buff, _ = PrepareReceiptEnd().Serialize()
+	buff[0] = 200
+	if _, err := DeserializeReceiptEntry(buff); err == nil {
+		t.Error("expected an error for an unknown status")
+	}
+
+	if _, err := DeserializeReceiptEntry(buff[:config.RECEIPT_ENTRY_MIN_SIZE-1]); err == nil {
+		t.Error("expected an error for a truncated receipt entry")
+	}
+}
+
+func TestSerializeSkipHeader(t *testing.T) {
+	header := PrepareSkipHeader("dir/secret.txt", 42, "failed to open file: permission denied")
+
+	buff, err := header.Serialize()
+	if err != nil {
+		t.Fatalf("failed to serialize: %v", err)
+	}
+
+	size, err := SkipHeaderSize(buff[:config.SKIP_HEADER_MIN_SIZE])
+	if err != nil || size != len(buff) {
+		t.Errorf("Wrong skip header size: got %d (%v) want %d", size, err, len(buff))
+	}
+
+	got, err := DeserializeSkipHeader(buff)
+	if err != nil {
+		t.Fatalf("failed to deserialize: %v", err)
+	}
+	assertEqual(t, got, header)
+
+	if long := PrepareSkipHeader("x", 0, strings.Repeat("why", 1000)); len(long.Reason) != config.MAX_REASON_LENGTH {
+		t.Errorf("Wrong reason length: got %d want %d", len(long.Reason), config.MAX_REASON_LENGTH)
+	}
+
+	// A deep path keeps its end
+	deep := strings.Repeat("directory/", 500) + "file.txt"
+	long := PrepareSkipHeader(deep, 0, "failed to open file: file name too long")
+	if len(long.FileName) != config.MAX_FILENAME_LENGTH || !strings.HasSuffix(long.FileName, "directory/file.txt") {
+		t.Errorf("Wrong long name: got %d bytes ending in %q", len(long.FileName), long.FileName[len(long.FileName)-20:])
+	}
+	if _, err := long.Serialize(); err != nil {
+		t.Errorf("failed to serialize a long name: %v", err)
+	}
+
+	if _, err := DeserializeSkipHeader(buff[:len(buff)-1]); err == nil {
+		t.Error("expected an error for a truncated skip header")
+	}
+}
+
+func TestFailureChunk(t *testing.T) {
+	chunk := PrepareFailureChunk(4096, "failed to read the file: input/output error")
+
+	buff, err := chunk.Serialize()
+	if err != nil {
+		t.Fatalf("failed to serialize: %v", err)
+	}
+	if len(buff) != 4096 {
+		t.Errorf("Wrong failure chunk size: got %d want %d", len(buff), 4096)
+	}
+
+	got, err := DeserializeChunk(buff)
+	if err != nil {
+		t.Fatalf("failed to deserialize: %v", err)
+	}
+	if !got.IsFailure() || got.IsHeartbeat() || string(got.Data) != "failed to read the file: input/output error" {
+		t.Errorf("unexpected failure chunk: %d %q", got.SequenceNumber, got.Data)
+	}
+}
+
+func TestSerializeBeacon(t *testing.T) {
+	beacon := PrepareBeacon("laptop", 9090, 41234, 3, 1<<20)
+
+	buff, err := beacon.Serialize()
+	if err != nil {
+		t.Fatalf("failed to serialize: %v", err)
+	}
+	if len(buff) != config.BEACON_MIN_SIZE+len("laptop") {
+		t.Errorf("Wrong beacon size: got %d want %d", len(buff), config.BEACON_MIN_SIZE+len("laptop"))
+	}
+
+	got, err := DeserializeBeacon(buff)
+	if err != nil {
+		t.Fatalf("failed to deserialize: %v", err)
+	}
+	assertEqual(t, got, beacon)
+
+	if long := PrepareBeacon(strings.Repeat("x", 1000), 0, 0, 0, 0); len(long.Name) != config.MAX_NAME_LENGTH {
+		t.Errorf("Wrong name length: got %d want %d", len(long.Name), config.MAX_NAME_LENGTH)
+	}
+
+	// Datagrams of other programs and of other versions
+	other := bytes.Clone(buff)
+	other[0] = 'X'
+	if _, err := DeserializeBeacon(other); err == nil {
+		t.Error("expected an error without the magic")
+	}
+	other = bytes.Clone(buff)
+	other[len(config.BEACON_MAGIC)] = config.PROTOCOL_VERSION - 1
+	if _, err := DeserializeBeacon(other); !errors.Is(err, lnkerrors.UnsupportedVersion) {
+		t.Errorf("got %v, want %v", err, lnkerrors.UnsupportedVersion)
+	}
+	if _, err := DeserializeBeacon(buff[:len(buff)-1]); err == nil {
+		t.Error("expected an error for a truncated beacon")
+	}
+}
+
+func TestSerializeListingEntry(t *testing.T) {
+	for _, entry := range []*ListingEntry{{Size: 12, Name: "dir/hello.txt"}, {Size: config.UNKNOWN_SIZE, Name: "stdin"}, PrepareListingEnd()} {
+		buff, err := entry.Serialize()
+		if err != nil {
+			t.Fatalf("failed to serialize: %v", err)
+		}
+
+		size, err := ListingEntrySize(buff[:config.LISTING_ENTRY_MIN_SIZE])
+		if err != nil || size != len(buff) {
+			t.Errorf("Wrong listing entry size: got %d (%v) want %d", size, err, len(buff))
+		}
+
+		got, err := DeserializeListingEntry(buff)
+		if err != nil {
+			t.Fatalf("failed to deserialize: %v", err)
+		}
+		assertEqual(t, got, entry)
+	}
+
+	if !PrepareListingEnd().IsEnd() {
+		t.Error("the end entry should close the listing")
+	}
+}
@@ -0,0 +1,103 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/LxrdShadow/linker/internal/config"
+	"github.com/LxrdShadow/linker/internal/errors"
+)
+
+// What the receiver did with a file. The receipt is streamed at the end of a session, after
+// the end of the manifest: one entry per file, closed by an entry with the RECEIPT_END status
+type ReceiptEntry struct {
+	Status byte
+	Bytes  uint64   // Written by the receiver
+	Hash   [32]byte // SHA-256 of the data received, zero when the file was not received
+	Name   string
+	Reason string // Why the file was skipped or failed
+}
+
+// Prepare the entry closing the receipt
+func PrepareReceiptEnd() *ReceiptEntry {
+	return &ReceiptEntry{Status: config.RECEIPT_END}
+}
+
+// Check if the entry closes the receipt
+func (e *ReceiptEntry) IsEnd() bool {
+	return e.Status == config.RECEIPT_END
+}
+
+// Encode the entry to byte representation, the long reasons are cut
+func (e *ReceiptEntry) Serialize() ([]byte, error) {
+	if len(e.Name) > config.MAX_FILENAME_LENGTH {
+		return nil, fmt.Errorf("filename exceeds maximum length of %d bytes", config.MAX_FILENAME_LENGTH)
+	}
+	reason := e.Reason[:min(len(e.Reason), config.MAX_REASON_LENGTH)]
+
+	buff := new(bytes.Buffer)
+
+	fields := []any{e.Status, e.Bytes, e.Hash, uint16(len(e.Name)), uint16(len(reason))}
+	for _, field := range fields {
+		if err := binary.Write(buff, binary.BigEndian, field); err != nil {
+			return nil, fmt.Errorf("failed to write receipt entry: %w", err)
+		}
+	}
+
+	buff.WriteString(e.Name)
+	buff.WriteString(reason)
+
+	return buff.Bytes(), nil
+}
+
+// Get the size of the encoded entry from its fixed-size part
+func ReceiptEntrySize(data []byte) (int, error) {
+	if len(data) < config.RECEIPT_ENTRY_MIN_SIZE {
+		return 0, errors.InvalidHeaderSize
+	}
+
+	nameLength := binary.BigEndian.Uint16(data[config.RECEIPT_ENTRY_MIN_SIZE-4:])
+	reasonLength := binary.BigEndian.Uint16(data[config.RECEIPT_ENTRY_MIN_SIZE-2:])
+	if nameLength > config.MAX_FILENAME_LENGTH || reasonLength > config.MAX_REASON_LENGTH {
+		return 0, fmt.Errorf("receipt entry too long: %w", errors.InvalidHeaderSize)
+	}
+
+	return config.RECEIPT_ENTRY_MIN_SIZE + int(nameLength) + int(reasonLength), nil
+}
+
+// Decode a byte representation of an entry to a ReceiptEntry struct
+func DeserializeReceiptEntry(data []byte) (*ReceiptEntry, error) {
+	size, err := ReceiptEntrySize(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < size {
+		return nil, errors.InvalidHeaderSize
+	}
+
+	reader := bytes.NewReader(data[:size])
+	var entry ReceiptEntry
+	var nameLength, reasonLength uint16
+
+	fields := []any{&entry.Status, &entry.Bytes, &entry.Hash, &nameLength, &reasonLength}
+	for _, field := range fields {
+		if err := binary.Read(reader, binary.BigEndian, field); err != nil {
+			return nil, fmt.Errorf("failed to read receipt entry: %w", err)
+		}
+	}
+
+	if entry.Status > config.RECEIPT_FAILED && entry.Status != config.RECEIPT_END {
+		return nil, fmt.Errorf("unknown receipt status: %d: %w", entry.Status, errors.Malformed)
+	}
+
+	text := make([]byte, int(nameLength)+int(reasonLength))
+	if _, err := io.ReadFull(reader, text); err != nil {
+		return nil, fmt.Errorf("failed to read receipt entry: %w", err)
+	}
+	entry.Name = string(text[:nameLength])
+	entry.Reason = string(text[nameLength:])
+
+	return &entry, nil
+}
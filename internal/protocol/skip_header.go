@@ -0,0 +1,107 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"github.com/LxrdShadow/linker/internal/config"
+	"github.com/LxrdShadow/linker/internal/errors"
+)
+
+// Follows a skip entry: the sender can't read a file or a directory, the manifest goes on
+type SkipHeader struct {
+	FileSize uint64 // As counted in the transfer header, 0 when unknown
+	FileName string
+	Reason   string
+}
+
+// Prepare the header of an entry that can't be sent, the long reasons are cut and the long
+// names keep their end, the receiver only reports them
+func PrepareSkipHeader(name string, size uint64, reason string) *SkipHeader {
+	if len(name) > config.MAX_FILENAME_LENGTH {
+		start := len(name) - config.MAX_FILENAME_LENGTH + len(config.NAME_ELLIPSIS)
+		for start < len(name) && !utf8.RuneStart(name[start]) {
+			start++
+		}
+		name = config.NAME_ELLIPSIS + name[start:]
+	}
+
+	return &SkipHeader{
+		FileSize: size,
+		FileName: name,
+		Reason:   reason[:min(len(reason), config.MAX_REASON_LENGTH)],
+	}
+}
+
+// Encode the header to byte representation
+func (h *SkipHeader) Serialize() ([]byte, error) {
+	if len(h.FileName) > config.MAX_FILENAME_LENGTH {
+		return nil, fmt.Errorf("filename exceeds maximum length of %d bytes", config.MAX_FILENAME_LENGTH)
+	}
+	if len(h.Reason) > config.MAX_REASON_LENGTH {
+		return nil, fmt.Errorf("reason exceeds maximum length of %d bytes", config.MAX_REASON_LENGTH)
+	}
+
+	buff := new(bytes.Buffer)
+
+	fields := []any{h.FileSize, uint16(len(h.FileName)), uint16(len(h.Reason))}
+	for _, field := range fields {
+		if err := binary.Write(buff, binary.BigEndian, field); err != nil {
+			return nil, fmt.Errorf("failed to write skip header: %w", err)
+		}
+	}
+
+	buff.WriteString(h.FileName)
+	buff.WriteString(h.Reason)
+
+	return buff.Bytes(), nil
+}
+
+// Get the size of the encoded header from its fixed-size part
+func SkipHeaderSize(data []byte) (int, error) {
+	if len(data) < config.SKIP_HEADER_MIN_SIZE {
+		return 0, errors.InvalidHeaderSize
+	}
+
+	nameLength := binary.BigEndian.Uint16(data[8:])
+	reasonLength := binary.BigEndian.Uint16(data[10:])
+	if nameLength > config.MAX_FILENAME_LENGTH || reasonLength > config.MAX_REASON_LENGTH {
+		return 0, fmt.Errorf("skip header too long: %w", errors.InvalidHeaderSize)
+	}
+
+	return config.SKIP_HEADER_MIN_SIZE + int(nameLength) + int(reasonLength), nil
+}
+
+// Decode a byte representation of a header to a SkipHeader struct
+func DeserializeSkipHeader(data []byte) (*SkipHeader, error) {
+	size, err := SkipHeaderSize(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < size {
+		return nil, errors.InvalidHeaderSize
+	}
+
+	reader := bytes.NewReader(data[:size])
+	var header SkipHeader
+	var nameLength, reasonLength uint16
+
+	fields := []any{&header.FileSize, &nameLength, &reasonLength}
+	for _, field := range fields {
+		if err := binary.Read(reader, binary.BigEndian, field); err != nil {
+			return nil, fmt.Errorf("failed to read skip header: %w", err)
+		}
+	}
+
+	text := make([]byte, int(nameLength)+int(reasonLength))
+	if _, err := io.ReadFull(reader, text); err != nil {
+		return nil, fmt.Errorf("failed to read skip header: %w", err)
+	}
+	header.FileName = string(text[:nameLength])
+	header.Reason = string(text[nameLength:])
+
+	return &header, nil
+}
@@ -0,0 +1,60 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/LxrdShadow/linker/internal/config"
+	"github.com/LxrdShadow/linker/internal/errors"
+)
+
+// Answer of the receiver to the transfer header
+type TransferAck struct {
+	ChunkSize uint32 // Chunk size used for the rest of the session
+}
+
+// Agree on a chunk size, never going above the largest size the receiver accepts
+func NegotiateChunkSize(proposed, accepted uint32) uint32 {
+	size := min(proposed, accepted)
+
+	return max(min(size, config.CHUNK_SIZE_UPPER_BOUND), config.CHUNK_SIZE_LOWER_BOUND)
+}
+
+// Check that a chunk size is within the bounds of the protocol
+func ValidChunkSize(size uint32) bool {
+	return size >= config.CHUNK_SIZE_LOWER_BOUND && size <= config.CHUNK_SIZE_UPPER_BOUND
+}
+
+// Encode the acknowledgment to byte representation
+func (ta *TransferAck) Serialize() ([]byte, error) {
+	buff := new(bytes.Buffer)
+
+	// Negotiated chunk size
+	if err := binary.Write(buff, binary.BigEndian, ta.ChunkSize); err != nil {
+		return nil, fmt.Errorf("failed to write chunk size: %w", err)
+	}
+
+	return buff.Bytes(), nil
+}
+
+// Decode a byte representation of an acknowledgment to a TransferAck struct
+func DeserializeTransferAck(data []byte) (*TransferAck, error) {
+	if len(data) < config.TRANSFER_ACK_SIZE {
+		return nil, errors.InvalidHeaderSize
+	}
+
+	reader := bytes.NewReader(data)
+	var ack TransferAck
+
+	// Negotiated chunk size
+	if err := binary.Read(reader, binary.BigEndian, &ack.ChunkSize); err != nil {
+		return nil, fmt.Errorf("failed to read chunk size: %w", err)
+	}
+
+	if !ValidChunkSize(ack.ChunkSize) {
+		return nil, errors.InvalidChunkSize
+	}
+
+	return &ack, nil
+}
@@ -4,42 +4,39 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
-	"os"
 
 	"github.com/LxrdShadow/linker/internal/config"
 	"github.com/LxrdShadow/linker/internal/errors"
 )
 
+// First packet of a session, the entries follow it one by one
 type TransferHeader struct {
-	Version byte
-	Reps    uint16
-	IsDir   []bool
+	Version    byte
+	Status     byte
+	ChunkSize  uint32 // Proposed by the sender, the receiver answers with a TransferAck
+	TotalFiles uint64
+	TotalBytes uint64 // UNKNOWN_SIZE when one of the entries is a stream
 }
 
-// Prepare the header with the informations about the file and the protocol
-func PrepareTransferHeader(entries []string) (*TransferHeader, error) {
-	isDir := make([]bool, len(entries))
-
-	for i, entry := range entries {
-		info, err := os.Stat(entry)
-		if err != nil {
-			return nil, err
-		}
-
-		if info.IsDir() {
-			isDir[i] = true
-		} else {
-			isDir[i] = false
-		}
+// Prepare the header with the informations about the protocol and the totals of the manifest
+func PrepareTransferHeader(chunkSize uint32, totalFiles, totalBytes uint64) *TransferHeader {
+	header := &TransferHeader{
+		Version:    config.PROTOCOL_VERSION,
+		Status:     config.SHARE_OPEN,
+		ChunkSize:  chunkSize,
+		TotalFiles: totalFiles,
+		TotalBytes: totalBytes,
 	}
 
-	header := &TransferHeader{
+	return header
+}
+
+// Prepare the header telling a late receiver that the share is closed
+func PrepareClosedTransferHeader() *TransferHeader {
+	return &TransferHeader{
 		Version: config.PROTOCOL_VERSION,
-		Reps:    uint16(len(entries)),
-		IsDir:   isDir,
+		Status:  config.SHARE_CLOSED,
 	}
-
-	return header, nil
 }
 
 // Encode the header to byte representation
@@ -48,24 +45,34 @@ func (th *TransferHeader) Serialize() ([]byte, error) {
 
 	// Version
 	if err := binary.Write(buff, binary.BigEndian, th.Version); err != nil {
-		return nil, fmt.Errorf("failed to write version: %w\n", err)
+		return nil, fmt.Errorf("failed to write version: %w", err)
+	}
+
+	// Status of the share
+	if err := binary.Write(buff, binary.BigEndian, th.Status); err != nil {
+		return nil, fmt.Errorf("failed to write status: %w", err)
+	}
+
+	// Proposed chunk size
+	if err := binary.Write(buff, binary.BigEndian, th.ChunkSize); err != nil {
+		return nil, fmt.Errorf("failed to write chunk size: %w", err)
 	}
 
-	// Number of entries to process
-	if err := binary.Write(buff, binary.BigEndian, th.Reps); err != nil {
-		return nil, fmt.Errorf("failed to write reps: %w\n", err)
+	// Totals of the manifest
+	if err := binary.Write(buff, binary.BigEndian, th.TotalFiles); err != nil {
+		return nil, fmt.Errorf("failed to write total files: %w", err)
 	}
 
-	// To check wether an entry is a directory or not
-	isDirBytes := encodeBooleans(th.IsDir)
-	buff.Write(isDirBytes)
+	if err := binary.Write(buff, binary.BigEndian, th.TotalBytes); err != nil {
+		return nil, fmt.Errorf("failed to write total bytes: %w", err)
+	}
 
 	return buff.Bytes(), nil
 }
 
 // Decode a byte representation of a header to a TransferHeader struct
 func DeserializeTransferHeader(data []byte) (*TransferHeader, error) {
-	if len(data) < config.FILE_HEADER_MIN_SIZE {
+	if len(data) < config.TRANSFER_HEADER_SIZE {
 		return nil, errors.InvalidHeaderSize
 	}
 
@@ -74,58 +81,35 @@ func DeserializeTransferHeader(data []byte) (*TransferHeader, error) {
 
 	// Version
 	if err := binary.Read(reader, binary.BigEndian, &header.Version); err != nil {
-		return nil, fmt.Errorf("failed to read version: %w\n", err)
+		return nil, fmt.Errorf("failed to read version: %w", err)
 	}
 
 	if header.Version != config.PROTOCOL_VERSION {
-		return nil, fmt.Errorf("protocol version mismatch: got v%d protocol while using v%d protocol\n", header.Version, config.PROTOCOL_VERSION)
+		return nil, fmt.Errorf("%w: got v%d protocol while using v%d protocol", errors.UnsupportedVersion, header.Version, config.PROTOCOL_VERSION)
 	}
 
-	// Number of entries to process
-	if err := binary.Read(reader, binary.BigEndian, &header.Reps); err != nil {
-		return nil, fmt.Errorf("failed to read reps: %w\n", err)
+	// Status of the share
+	if err := binary.Read(reader, binary.BigEndian, &header.Status); err != nil {
+		return nil, fmt.Errorf("failed to read status: %w", err)
 	}
 
-	// To check wether an entry is a directory or not
-	byteCount := (header.Reps + 7) / 8
-	tmp := make([]byte, byteCount)
-	reader.Read(tmp)
-	// if err := binary.Read(reader, binary.BigEndian, &header.IsDir); err != nil {
-	// 	return nil, fmt.Errorf("failed to read IsDir confirmations: %w\n", err)
-	// }
-	header.IsDir = decodeBooleans(tmp, int(header.Reps))
-
-	if len(header.IsDir) != int(header.Reps) {
-		return nil, fmt.Errorf("malformed transfer header\n")
+	if header.Status != config.SHARE_OPEN && header.Status != config.SHARE_CLOSED {
+		return nil, fmt.Errorf("unknown share status: %d", header.Status)
 	}
 
-	return &header, nil
-}
-
-// Encode an array of bools to binary
-func encodeBooleans(booleans []bool) []byte {
-	// Pack 8 booleans into one byte
-	byteCount := (len(booleans) + 7) / 8
-	encoded := make([]byte, byteCount)
-
-	for i, bool := range booleans {
-		if bool {
-			encoded[i/8] |= 1 << (7 - (i % 8))
-		}
+	// Proposed chunk size
+	if err := binary.Read(reader, binary.BigEndian, &header.ChunkSize); err != nil {
+		return nil, fmt.Errorf("failed to read chunk size: %w", err)
 	}
 
-	return encoded
-}
-
-// Decode binary to get an array of bools
-func decodeBooleans(encoded []byte, length int) []bool {
-	booleans := make([]bool, length)
+	// Totals of the manifest
+	if err := binary.Read(reader, binary.BigEndian, &header.TotalFiles); err != nil {
+		return nil, fmt.Errorf("failed to read total files: %w", err)
+	}
 
-	for i := 0; i < length; i++ {
-		byteIndex := i / 8
-		bitIndex := 7 - (i % 8)
-		booleans[i] = (encoded[byteIndex] & (1 << bitIndex)) != 0
+	if err := binary.Read(reader, binary.BigEndian, &header.TotalBytes); err != nil {
+		return nil, fmt.Errorf("failed to read total bytes: %w", err)
 	}
 
-	return booleans
+	return &header, nil
 }
@@ -0,0 +1,229 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/LxrdShadow/linker/internal/config"
+	"github.com/LxrdShadow/linker/pkg/event"
+	"github.com/LxrdShadow/linker/pkg/log"
+	"github.com/LxrdShadow/linker/pkg/transfer"
+	"github.com/LxrdShadow/linker/pkg/util"
+)
+
+const (
+	STREAM_NAME = "bench"
+
+	// A peer serving the benchmark accepts a receiver again shortly after each run
+	CONNECT_ATTEMPTS = 20
+	CONNECT_DELAY    = 100 * time.Millisecond
+)
+
+// Run the bench command: transfer synthetic data once per chunk size and print the measures,
+// or serve the data to the benchmarks of other peers
+func Run(conf *util.FlagConfig, w io.Writer) error {
+	// A remote peer has the data, the local one only receives it
+	var data *dataset
+	if conf.BenchServe || conf.Addr == "" {
+		var err error
+		data, err = newDataset(conf.BenchSize, conf.BenchFiles, conf.BenchDisk)
+		if err != nil {
+			return err
+		}
+		defer data.remove()
+	}
+
+	if conf.BenchServe {
+		return serve(conf.Addr, data, w)
+	}
+
+	fmt.Fprintln(w, describe(conf))
+
+	var results []*Result
+	for _, chunkSize := range conf.BenchChunkSizes {
+		result, err := runOnce(conf.Addr, data, chunkSize, conf.BenchDisk)
+		if err != nil {
+			return fmt.Errorf("failed to run the benchmark with %s chunks: %w", formatChunkSize(chunkSize), err)
+		}
+		results = append(results, result)
+	}
+
+	fmt.Fprintln(w)
+	List(w, results)
+
+	return nil
+}
+
+// Tell where the data comes from and where it goes
+func describe(conf *util.FlagConfig) string {
+	destination := "memory"
+	if conf.BenchDisk {
+		destination = "disk"
+	}
+
+	if conf.Addr != "" {
+		return fmt.Sprintf("Receiving the data of %s to %s", conf.Addr, destination)
+	}
+
+	return fmt.Sprintf("Transferring %s in %d file(s) from %s to %s over the loopback interface",
+		formatBytes(conf.BenchSize), conf.BenchFiles, destination, destination)
+}
+
+// Transfer the data once with a chunk size, from a local sender or from the peer at addr
+func runOnce(addr string, data *dataset, chunkSize uint32, disk bool) (*Result, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var shared <-chan error
+	if addr == "" {
+		var err error
+		addr, shared, err = startSender(ctx, data, chunkSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var dir string
+	if disk {
+		var err error
+		dir, err = os.MkdirTemp("", "lnkr-bench-received-")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the directory of the received data: %w", err)
+		}
+		defer os.RemoveAll(dir)
+	}
+
+	var result *Result
+	var err error
+	for attempt := 1; ; attempt++ {
+		result, err = receive(addr, dir, chunkSize)
+		// The peer may still be closing the share of the previous run, a session that
+		// didn't start is tried again
+		started := result.ChunkSize != 0
+		if err == nil || started || shared != nil || attempt == CONNECT_ATTEMPTS {
+			break
+		}
+		time.Sleep(CONNECT_DELAY)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if shared != nil {
+		if err := <-shared; err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// Receive the data in dir, or discard it when dir is empty, and measure the transfer.
+// The result tells how far a failed transfer went
+func receive(addr, dir string, chunkSize uint32) (*Result, error) {
+	result := &Result{}
+	receiver := &transfer.Receiver{
+		Connection: newConnection(addr),
+		ReceiveDir: dir,
+		ChunkSize:  chunkSize,
+		Events:     event.SinkFunc(result.record),
+		Logger:     newLogger(),
+		OnChunk:    result.addRTT,
+	}
+	if dir == "" {
+		receiver.Stdout = io.Discard
+	}
+
+	cpu, knownCPU := cpuTime()
+	start := time.Now()
+	err := receiver.Connect()
+	result.Duration = time.Since(start)
+	if err != nil {
+		return result, err
+	}
+
+	end, _ := cpuTime()
+	result.CPU = end - cpu
+	result.KnownCPU = knownCPU
+
+	return result, nil
+}
+
+// Share the data with a single receiver over the loopback interface, returns the address of
+// the share and the outcome of the transfer
+func startSender(ctx context.Context, data *dataset, chunkSize uint32) (string, <-chan error, error) {
+	sender := newSender("127.0.0.1:0", data, chunkSize)
+	listening := make(chan string, 1)
+	sender.OnListen = func(addr string) { listening <- addr }
+
+	result := make(chan error, 1)
+	go func() {
+		result <- sender.ListenContext(ctx)
+	}()
+
+	select {
+	case addr := <-listening:
+		return addr, result, nil
+	case err := <-result:
+		return "", nil, err
+	}
+}
+
+// Share the data with one benchmark after the other, until the program is stopped
+func serve(addr string, data *dataset, w io.Writer) error {
+	fmt.Fprintf(w, "Serving %s in %d file(s) on %s\n", formatBytes(data.size), data.files, addr)
+
+	for {
+		listening := false
+		sender := newSender(addr, data, config.CHUNK_SIZE_UPPER_BOUND)
+		sender.OnListen = func(string) { listening = true }
+		sender.Events = event.SinkFunc(func(ev event.Event) {
+			if ev.Type == event.SUMMARY {
+				fmt.Fprintf(w, "Sent %s to %s in %s\n", formatBytes(ev.Bytes), ev.Peer, formatDuration(time.Duration(ev.Duration*float64(time.Second))))
+			}
+		})
+
+		err := sender.Listen()
+		if !listening {
+			return err
+		}
+		if err != nil {
+			log.Errorf("%s\n", err.Error())
+		}
+	}
+}
+
+// A sender for a single receiver, whose chunk size caps the one proposed
+func newSender(addr string, data *dataset, chunkSize uint32) *transfer.Sender {
+	return &transfer.Sender{
+		Connection:   newConnection(addr),
+		Entries:      data.entries(),
+		MaxDownloads: 1,
+		StreamName:   STREAM_NAME,
+		Stdin:        data.reader(),
+		ChunkSize:    chunkSize,
+		Logger:       newLogger(),
+	}
+}
+
+func newConnection(addr string) *transfer.Connection {
+	return &transfer.Connection{
+		Network:          "tcp",
+		Addr:             addr,
+		HandshakeTimeout: config.HANDSHAKE_TIMEOUT,
+		IdleTimeout:      config.IDLE_TIMEOUT,
+		KeepAlive:        config.KEEPALIVE_INTERVAL,
+	}
+}
+
+// Only the errors are printed, along with the debug messages with -v
+func newLogger() *log.Logger {
+	if log.Enabled(log.DEBUG) {
+		return log.New(os.Stderr, nil)
+	}
+
+	return log.New(io.Discard, nil)
+}
@@ -0,0 +1,111 @@
+package bench
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LxrdShadow/linker/internal/config"
+	"github.com/LxrdShadow/linker/pkg/util"
+)
+
+func TestSynthetic(t *testing.T) {
+	size := uint64(2*BLOCK_SIZE + 123)
+
+	data, err := io.ReadAll(newSynthetic(size))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if uint64(len(data)) != size {
+		t.Fatalf("got %d bytes, want %d", len(data), size)
+	}
+	if !bytes.Equal(data[:BLOCK_SIZE], data[BLOCK_SIZE:2*BLOCK_SIZE]) {
+		t.Error("the block isn't repeated")
+	}
+	if bytes.Equal(data[:BLOCK_SIZE/2], data[BLOCK_SIZE/2:BLOCK_SIZE]) {
+		t.Error("the block isn't random")
+	}
+}
+
+func TestResult(t *testing.T) {
+	result := &Result{Bytes: 2_000_000_000, Duration: 4 * time.Second, CPU: 3 * time.Second}
+	for i := 100; i >= 1; i-- {
+		result.addRTT(time.Duration(i) * time.Millisecond)
+	}
+
+	if result.Throughput() != 500_000_000 {
+		t.Errorf("throughput mismatch: got %f", result.Throughput())
+	}
+	if result.CPUPerGB() != 1500*time.Millisecond {
+		t.Errorf("CPU per GB mismatch: got %s", result.CPUPerGB())
+	}
+
+	percentiles := map[float64]time.Duration{0: time.Millisecond, 50: 51 * time.Millisecond, 99: 100 * time.Millisecond, 100: 100 * time.Millisecond}
+	for p, want := range percentiles {
+		if got := result.Percentile(p); got != want {
+			t.Errorf("percentile %g: got %s, want %s", p, got, want)
+		}
+	}
+
+	if (&Result{}).Percentile(50) != 0 {
+		t.Error("expected 0 without round trips")
+	}
+}
+
+func TestFormat(t *testing.T) {
+	durations := map[time.Duration]string{
+		123456 * time.Nanosecond:  "123µs",
+		1234567 * time.Nanosecond: "1.23ms",
+		1234567890:                "1.23s",
+		0:                         "0s",
+	}
+	for d, want := range durations {
+		if got := formatDuration(d); got != want {
+			t.Errorf("%d: got %s, want %s", d, got, want)
+		}
+	}
+
+	sizes := map[uint32]string{4 << 10: "4KB", 16 << 20: "16MB", 1536 << 10: "1536KB", 1000: "1000B"}
+	for size, want := range sizes {
+		if got := formatChunkSize(size); got != want {
+			t.Errorf("%d: got %s, want %s", size, got, want)
+		}
+	}
+}
+
+func TestRunOverLoopback(t *testing.T) {
+	for _, disk := range []bool{false, true} {
+		files := 1
+		if disk {
+			files = 3
+		}
+
+		conf := &util.FlagConfig{
+			BenchSize:       1<<20 + 5,
+			BenchFiles:      files,
+			BenchDisk:       disk,
+			BenchChunkSizes: []uint32{config.CHUNK_SIZE_LOWER_BOUND, 64 << 10},
+		}
+
+		var out bytes.Buffer
+		if err := Run(conf, &out); err != nil {
+			t.Fatalf("disk %t: failed to run: %v", disk, err)
+		}
+
+		// The description, a blank line, the header and one line per chunk size
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		if len(lines) != 5 {
+			t.Fatalf("disk %t: got %d lines, want 5:\n%s", disk, len(lines), out.String())
+		}
+		for i, chunk := range []string{"4KB", "64KB"} {
+			fields := strings.Fields(lines[3+i])
+			if fields[0] != chunk || fields[1] != strconv.Itoa(files) || fields[2] != "1.05MB" {
+				t.Errorf("disk %t: unexpected line %q", disk, lines[3+i])
+			}
+		}
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package bench
+
+import "time"
+
+// The CPU time is not measured on this platform
+func cpuTime() (time.Duration, bool) {
+	return 0, false
+}
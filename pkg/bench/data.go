@@ -0,0 +1,114 @@
+package bench
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/LxrdShadow/linker/internal/config"
+)
+
+// Size of the random block repeated by the synthetic data
+const BLOCK_SIZE = 1 << 20
+
+// The synthetic data shared by the benchmark
+type dataset struct {
+	size  uint64
+	files int
+	dir   string // Holds the files on disk, empty when the data is generated in memory
+}
+
+// Generate the data in memory, or write it in files of a temporary directory
+func newDataset(size uint64, files int, disk bool) (*dataset, error) {
+	data := &dataset{size: size, files: files}
+	if !disk {
+		return data, nil
+	}
+
+	dir, err := os.MkdirTemp("", "lnkr-bench-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the directory of the data: %w", err)
+	}
+	data.dir = dir
+
+	for i := range files {
+		// The last file gets what is left of the division
+		fileSize := size / uint64(files)
+		if i == files-1 {
+			fileSize += size % uint64(files)
+		}
+
+		if err := writeFile(filepath.Join(dir, fmt.Sprintf("file-%04d", i+1)), fileSize); err != nil {
+			data.remove()
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+func writeFile(path string, size uint64) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create the data: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, newSynthetic(size)); err != nil {
+		return fmt.Errorf("failed to write the data: %w", err)
+	}
+
+	return file.Close()
+}
+
+// Entries to give to the sender
+func (d *dataset) entries() []string {
+	if d.dir == "" {
+		return []string{config.STDIN_ENTRY}
+	}
+
+	return []string{d.dir}
+}
+
+// Stream of the data in memory, nil when it is on disk
+func (d *dataset) reader() io.Reader {
+	if d.dir != "" {
+		return nil
+	}
+
+	return newSynthetic(d.size)
+}
+
+func (d *dataset) remove() {
+	if d.dir != "" {
+		os.RemoveAll(d.dir)
+	}
+}
+
+// Random data repeating a block, as incompressible as real files without the cost of generating it
+type synthetic struct {
+	block     []byte
+	offset    int
+	remaining uint64
+}
+
+func newSynthetic(size uint64) *synthetic {
+	block := make([]byte, BLOCK_SIZE)
+	rand.Read(block)
+
+	return &synthetic{block: block, remaining: size}
+}
+
+func (s *synthetic) Read(p []byte) (int, error) {
+	if s.remaining == 0 {
+		return 0, io.EOF
+	}
+
+	n := copy(p[:min(uint64(len(p)), s.remaining)], s.block[s.offset:])
+	s.offset = (s.offset + n) % len(s.block)
+	s.remaining -= uint64(n)
+
+	return n, nil
+}
@@ -0,0 +1,134 @@
+package bench
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/LxrdShadow/linker/pkg/event"
+	"github.com/LxrdShadow/linker/pkg/util"
+)
+
+// Measures of one transfer of the data
+type Result struct {
+	ChunkSize uint32 // As negotiated with the sender
+	Files     uint64
+	Bytes     uint64
+	Duration  time.Duration
+
+	// Round trips of the chunks, from the acknowledgment of a chunk to the arrival of the next one
+	RTTs []time.Duration
+
+	// CPU time of the whole process, both ends are counted when they run here
+	CPU      time.Duration
+	KnownCPU bool
+}
+
+// Keep what the receiver reports about the session
+func (r *Result) record(ev event.Event) {
+	switch ev.Type {
+	case event.SESSION_START:
+		r.ChunkSize = ev.ChunkSize
+	case event.SUMMARY:
+		r.Files = ev.Files
+		r.Bytes = ev.Bytes
+	}
+}
+
+func (r *Result) addRTT(rtt time.Duration) {
+	r.RTTs = append(r.RTTs, rtt)
+}
+
+// Bytes per second
+func (r *Result) Throughput() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+
+	return float64(r.Bytes) / r.Duration.Seconds()
+}
+
+// Round trip that p percent of the chunks didn't exceed, 0 without chunks
+func (r *Result) Percentile(p float64) time.Duration {
+	if len(r.RTTs) == 0 {
+		return 0
+	}
+
+	sorted := slices.Clone(r.RTTs)
+	slices.Sort(sorted)
+
+	// Nearest rank
+	rank := int(p / 100 * float64(len(sorted)))
+	return sorted[min(rank, len(sorted)-1)]
+}
+
+// CPU time spent for each gigabyte (10^9 bytes) transferred
+func (r *Result) CPUPerGB() time.Duration {
+	if r.Bytes == 0 {
+		return 0
+	}
+
+	return time.Duration(float64(r.CPU) * 1e9 / float64(r.Bytes))
+}
+
+// Print one line per result
+func List(w io.Writer, results []*Result) {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "CHUNK\tFILES\tSIZE\tTIME\tTHROUGHPUT\tRTT P50\tRTT P90\tRTT P99\tCPU/GB")
+
+	for _, result := range results {
+		// Files of a single chunk have no round trip
+		rtts := []string{"-", "-", "-"}
+		if len(result.RTTs) > 0 {
+			for i, p := range []float64{50, 90, 99} {
+				rtts[i] = formatDuration(result.Percentile(p))
+			}
+		}
+
+		cpu := "-"
+		if result.KnownCPU {
+			cpu = formatDuration(result.CPUPerGB())
+		}
+
+		fmt.Fprintf(table, "%s\t%d\t%s\t%s\t%s/s\t%s\t%s\t%s\t%s\n",
+			formatChunkSize(result.ChunkSize),
+			result.Files,
+			formatBytes(result.Bytes),
+			formatDuration(result.Duration),
+			formatBytes(uint64(result.Throughput())),
+			rtts[0], rtts[1], rtts[2],
+			cpu,
+		)
+	}
+
+	table.Flush()
+}
+
+func formatBytes(bytes uint64) string {
+	unit, denom := util.ByteDecodeUnit(bytes)
+	return fmt.Sprintf("%.2f%s", float64(bytes)/float64(denom), unit)
+}
+
+// Chunk sizes are given in binary units, as to -chunk-size
+func formatChunkSize(size uint32) string {
+	if size%(1<<20) == 0 {
+		return fmt.Sprintf("%dMB", size>>20)
+	}
+	if size%(1<<10) == 0 {
+		return fmt.Sprintf("%dKB", size>>10)
+	}
+
+	return fmt.Sprintf("%dB", size)
+}
+
+// Round a duration to 3 significant digits
+func formatDuration(d time.Duration) string {
+	precision := time.Duration(1)
+	for d >= 1000*precision {
+		precision *= 10
+	}
+
+	return d.Round(precision).String()
+}
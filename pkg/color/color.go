@@ -3,6 +3,9 @@ package color
 import (
 	"fmt"
 	"io"
+	"os"
+
+	"github.com/LxrdShadow/linker/pkg/term"
 )
 
 const (
@@ -15,8 +18,61 @@ const (
 	CYAN   = 36
 )
 
-// Wraps a string with ANSI escape codes for coloring
+// When to write colors, as given to -color
+const (
+	AUTO   = "auto"   // Only on terminals, unless NO_COLOR is set
+	ALWAYS = "always" // Even when writing to a file or a pipe
+	NEVER  = "never"
+)
+
+// Colors are decided at runtime, by default for stdout and stderr
+var enabled = decide(AUTO, os.Stdout, os.Stderr)
+
+// Decide whether colors are written to the given outputs.
+// In auto mode, every output has to be a terminal and NO_COLOR must not be set
+func SetMode(mode string, outputs ...*os.File) error {
+	if mode != AUTO && mode != ALWAYS && mode != NEVER {
+		return fmt.Errorf("%s: invalid color mode, it should be %s, %s or %s", mode, AUTO, ALWAYS, NEVER)
+	}
+
+	enabled = decide(mode, outputs...)
+
+	return nil
+}
+
+// Check if the colors are written
+func Enabled() bool {
+	return enabled
+}
+
+func decide(mode string, outputs ...*os.File) bool {
+	switch mode {
+	case ALWAYS:
+		return true
+	case NEVER:
+		return false
+	}
+
+	// https://no-color.org
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+
+	for _, output := range outputs {
+		if !term.IsTerminal(output) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Wraps a string with ANSI escape codes for coloring, when the colors are enabled
 func colorize(color int, text string) string {
+	if !enabled {
+		return text
+	}
+
 	return fmt.Sprintf("\x1b[%dm%s\x1b[0m", color, text)
 }
 
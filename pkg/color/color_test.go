@@ -0,0 +1,58 @@
+package color
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSetMode(t *testing.T) {
+	defer SetMode(NEVER)
+
+	file, err := os.Create(filepath.Join(t.TempDir(), "output"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	cases := []struct {
+		mode    string
+		noColor string
+		want    bool
+	}{
+		{mode: ALWAYS, want: true},
+		{mode: ALWAYS, noColor: "1", want: true},
+		{mode: NEVER, want: false},
+		{mode: AUTO, want: false}, // A regular file is not a terminal
+		{mode: AUTO, noColor: "1", want: false},
+	}
+
+	for _, test := range cases {
+		t.Setenv("NO_COLOR", test.noColor)
+
+		if err := SetMode(test.mode, file); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if Enabled() != test.want {
+			t.Errorf("mode %s with NO_COLOR=%q: got %v want %v", test.mode, test.noColor, Enabled(), test.want)
+		}
+	}
+
+	if err := SetMode("sometimes"); err == nil {
+		t.Errorf("expected an error for an invalid mode")
+	}
+}
+
+func TestSprint(t *testing.T) {
+	defer SetMode(NEVER)
+
+	SetMode(ALWAYS)
+	if got, want := Sprint(RED, "text"), "\x1b[31mtext\x1b[0m"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+
+	SetMode(NEVER)
+	if got, want := Sprint(RED, "text"), "text"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
@@ -0,0 +1,233 @@
+// Package discovery finds the senders on the local network: each share announces itself with a
+// beacon sent to a multicast group, which the receivers listen to.
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LxrdShadow/linker/internal/config"
+	"github.com/LxrdShadow/linker/internal/protocol"
+	"github.com/LxrdShadow/linker/pkg/transfer"
+)
+
+// Largest datagram read, a beacon is always shorter
+const MAX_DATAGRAM_SIZE = 1024
+
+// A sender heard of on the network
+type Peer struct {
+	Addr        string // Of the share
+	PreviewAddr string // Where its manifest is listed
+	Name        string
+	Files       uint64
+	Bytes       uint64 // UNKNOWN_SIZE when one of the entries is a stream
+
+	seen time.Time
+}
+
+// Announces a share by sending its beacon to Addr every Interval. Totals is called for each
+// beacon, as the files of the share can change
+type Announcer struct {
+	Addr        string
+	Interval    time.Duration
+	Name        string
+	SharePort   uint16
+	PreviewPort uint16
+	Totals      func() (uint64, uint64)
+}
+
+// Send the beacons until the context is canceled
+func (a *Announcer) Run(ctx context.Context) error {
+	conn, err := net.Dial("udp", a.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to announce the share: %w", err)
+	}
+	defer conn.Close()
+
+	ticker := time.NewTicker(a.Interval)
+	defer ticker.Stop()
+
+	for {
+		files, bytes := a.Totals()
+		packetBuffer, err := protocol.PrepareBeacon(a.Name, a.SharePort, a.PreviewPort, files, bytes).Serialize()
+		if err != nil {
+			return fmt.Errorf("failed to serialize beacon: %w", err)
+		}
+
+		// A lost beacon is sent again at the next tick
+		conn.Write(packetBuffer)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Serve the previews of a sender and announce it to addr, until the context is canceled.
+// shareAddr is the address the sender listens on, the previews are served on the same host
+func Share(ctx context.Context, sender *transfer.Sender, shareAddr, addr string) error {
+	host, port, err := net.SplitHostPort(shareAddr)
+	if err != nil {
+		return fmt.Errorf("invalid address of the share: %w", err)
+	}
+	sharePort, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port of the share: %w", err)
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return fmt.Errorf("failed to serve the previews: %w", err)
+	}
+	defer listener.Close()
+	go sender.ServePreview(listener)
+
+	name, err := os.Hostname()
+	if err != nil {
+		name = host
+	}
+
+	announcer := &Announcer{
+		Addr:        addr,
+		Interval:    config.ANNOUNCE_INTERVAL,
+		Name:        name,
+		SharePort:   uint16(sharePort),
+		PreviewPort: uint16(listener.Addr().(*net.TCPAddr).Port),
+		Totals:      sender.Totals,
+	}
+
+	return announcer.Run(ctx)
+}
+
+// Keep the senders announced to an address, forgetting the ones not heard of for a while
+type Browser struct {
+	conn     *net.UDPConn
+	ttl      time.Duration
+	onChange func()
+
+	mu    sync.Mutex
+	peers map[string]*Peer // By address of the share
+}
+
+// Listen to the beacons sent to addr, joining its group when it is a multicast address.
+// onChange is optional, called when a sender appears, changes or is gone
+func Browse(addr string, ttl time.Duration, onChange func()) (*Browser, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid discovery address: %w", err)
+	}
+
+	var conn *net.UDPConn
+	if udpAddr.IP.IsMulticast() {
+		conn, err = net.ListenMulticastUDP("udp", nil, udpAddr)
+	} else {
+		conn, err = net.ListenUDP("udp", udpAddr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen to the senders: %w", err)
+	}
+
+	b := &Browser{conn: conn, ttl: ttl, onChange: onChange, peers: make(map[string]*Peer)}
+	go b.serve()
+
+	return b, nil
+}
+
+// Address the beacons are read from
+func (b *Browser) Addr() net.Addr {
+	return b.conn.LocalAddr()
+}
+
+func (b *Browser) Close() error {
+	return b.conn.Close()
+}
+
+// The senders heard of lately, by name
+func (b *Browser) Peers() []Peer {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	peers := make([]Peer, 0, len(b.peers))
+	for _, peer := range b.peers {
+		peers = append(peers, *peer)
+	}
+	slices.SortFunc(peers, func(a, b Peer) int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Addr, b.Addr)
+	})
+
+	return peers
+}
+
+func (b *Browser) serve() {
+	buff := make([]byte, MAX_DATAGRAM_SIZE)
+
+	for {
+		// Wake up regularly to forget the senders that are gone
+		b.conn.SetReadDeadline(time.Now().Add(b.ttl / 2))
+		n, from, err := b.conn.ReadFromUDP(buff)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+
+		changed := b.expire()
+		if err == nil {
+			// Datagrams of other programs and versions are ignored
+			if beacon, err := protocol.DeserializeBeacon(buff[:n]); err == nil {
+				changed = b.add(beacon, from.IP) || changed
+			}
+		}
+
+		if changed && b.onChange != nil {
+			b.onChange()
+		}
+	}
+}
+
+// Keep a sender, reports if it is new or changed
+func (b *Browser) add(beacon *protocol.Beacon, ip net.IP) bool {
+	peer := &Peer{
+		Addr:        net.JoinHostPort(ip.String(), strconv.Itoa(int(beacon.SharePort))),
+		PreviewAddr: net.JoinHostPort(ip.String(), strconv.Itoa(int(beacon.PreviewPort))),
+		Name:        beacon.Name,
+		Files:       beacon.TotalFiles,
+		Bytes:       beacon.TotalBytes,
+		seen:        time.Now(),
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	known, ok := b.peers[peer.Addr]
+	b.peers[peer.Addr] = peer
+
+	return !ok || known.PreviewAddr != peer.PreviewAddr || known.Name != peer.Name || known.Files != peer.Files || known.Bytes != peer.Bytes
+}
+
+// Forget the senders not heard of for too long, reports if there were any
+func (b *Browser) expire() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	expired := false
+	for addr, peer := range b.peers {
+		if time.Since(peer.seen) > b.ttl {
+			delete(b.peers, addr)
+			expired = true
+		}
+	}
+
+	return expired
+}
@@ -0,0 +1,125 @@
+package discovery
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/LxrdShadow/linker/internal/config"
+	"github.com/LxrdShadow/linker/pkg/log"
+	"github.com/LxrdShadow/linker/pkg/transfer"
+)
+
+const (
+	TEST_TIMEOUT  = 10 * time.Second
+	TEST_INTERVAL = 20 * time.Millisecond
+)
+
+// Wait for the browser to see the number of senders
+func waitPeers(t *testing.T, browser *Browser, changed <-chan struct{}, n int) []Peer {
+	t.Helper()
+
+	deadline := time.After(TEST_TIMEOUT)
+	for {
+		if peers := browser.Peers(); len(peers) == n {
+			return peers
+		}
+
+		select {
+		case <-changed:
+		case <-deadline:
+			t.Fatalf("got %d senders, want %d", len(browser.Peers()), n)
+		}
+	}
+}
+
+func TestBrowserFindsAndForgetsSenders(t *testing.T) {
+	changed := make(chan struct{}, 1)
+	browser, err := Browse("127.0.0.1:0", 5*TEST_INTERVAL, func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer browser.Close()
+
+	// Datagrams that aren't beacons are ignored
+	conn, err := net.Dial("udp", browser.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte("not a beacon at all"))
+	conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	announcer := &Announcer{
+		Addr:        browser.Addr().String(),
+		Interval:    TEST_INTERVAL,
+		Name:        "laptop",
+		SharePort:   9090,
+		PreviewPort: 9092,
+		Totals:      func() (uint64, uint64) { return 3, 300 },
+	}
+	done := make(chan error, 1)
+	go func() { done <- announcer.Run(ctx) }()
+
+	peers := waitPeers(t, browser, changed, 1)
+	want := Peer{Addr: "127.0.0.1:9090", PreviewAddr: "127.0.0.1:9092", Name: "laptop", Files: 3, Bytes: 300}
+	peers[0].seen = time.Time{}
+	if peers[0] != want {
+		t.Errorf("got %+v, want %+v", peers[0], want)
+	}
+
+	// The sender is forgotten once it stops announcing itself
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("failed to announce: %v", err)
+	}
+	waitPeers(t, browser, changed, 0)
+}
+
+func TestShareServesThePreview(t *testing.T) {
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "a.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	browser, err := Browse("127.0.0.1:0", config.DISCOVERY_TTL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer browser.Close()
+
+	conn := &transfer.Connection{Network: "tcp", HandshakeTimeout: TEST_TIMEOUT}
+	sender := &transfer.Sender{Connection: conn, Entries: []string{filepath.Join(src, "a.txt")}, Logger: log.New(io.Discard, io.Discard)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go Share(ctx, sender, "127.0.0.1:9090", browser.Addr().String())
+
+	var peers []Peer
+	deadline := time.Now().Add(TEST_TIMEOUT)
+	for len(peers) == 0 && time.Now().Before(deadline) {
+		time.Sleep(TEST_INTERVAL)
+		peers = browser.Peers()
+	}
+	if len(peers) != 1 || peers[0].Addr != "127.0.0.1:9090" || peers[0].Files != 1 || peers[0].Bytes != 5 {
+		t.Fatalf("unexpected senders: %+v", peers)
+	}
+
+	receiver := &transfer.Receiver{Connection: conn, Logger: log.New(io.Discard, io.Discard)}
+	manifest, err := receiver.Preview(ctx, peers[0].PreviewAddr, config.PREVIEW_MAX_FILES)
+	if err != nil {
+		t.Fatalf("failed to preview: %v", err)
+	}
+	if len(manifest.Files) != 1 || manifest.Files[0].Name != "a.txt" || manifest.Files[0].Size != 5 {
+		t.Errorf("unexpected manifest: %+v", manifest)
+	}
+}
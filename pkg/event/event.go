@@ -0,0 +1,116 @@
+package event
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Type of an event, the fields set for each type are documented in docs/events.md
+type Type string
+
+const (
+	SESSION_START Type = "session_start"
+	MANIFEST      Type = "manifest"
+	FILE_START    Type = "file_start"
+	PROGRESS      Type = "progress"
+	FILE_DONE     Type = "file_done"
+	ERROR         Type = "error"
+	SUMMARY       Type = "summary"
+)
+
+// Side of the transfer that emitted the event
+const (
+	SENDER   = "sender"
+	RECEIVER = "receiver"
+)
+
+// Something that happened during a transfer, numeric fields equal to 0 are omitted
+type Event struct {
+	Type      Type      `json:"type"`
+	Time      time.Time `json:"time"`
+	Role      string    `json:"role"`
+	Session   string    `json:"session"`
+	Peer      string    `json:"peer,omitempty"`
+	Version   int       `json:"protocol_version,omitempty"`
+	ChunkSize uint32    `json:"chunk_size,omitempty"`
+	Entries   []string  `json:"entries,omitempty"`
+	File      string    `json:"file,omitempty"`
+	Size      uint64    `json:"size,omitempty"`
+	Stream    bool      `json:"stream,omitempty"`
+	Bytes     uint64    `json:"bytes,omitempty"`
+	Speed     float64   `json:"bytes_per_second,omitempty"`
+	Hash      string    `json:"sha256,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	ErrorKind string    `json:"error_kind,omitempty"`
+	Files     uint64    `json:"files,omitempty"`
+	Failed    uint64    `json:"failed,omitempty"`
+	Duration  float64   `json:"duration_seconds,omitempty"`
+}
+
+// Receives the events of a transfer
+type Sink interface {
+	Emit(Event)
+}
+
+// Adapter to use a function as a sink
+type SinkFunc func(Event)
+
+func (f SinkFunc) Emit(ev Event) {
+	f(ev)
+}
+
+// Send the events to every sink, the nil ones are skipped. Returns nil without any sink
+func Tee(sinks ...Sink) Sink {
+	var tee multiSink
+	for _, sink := range sinks {
+		if sink != nil {
+			tee = append(tee, sink)
+		}
+	}
+
+	switch len(tee) {
+	case 0:
+		return nil
+	case 1:
+		return tee[0]
+	}
+
+	return tee
+}
+
+type multiSink []Sink
+
+func (ms multiSink) Emit(ev Event) {
+	for _, sink := range ms {
+		sink.Emit(ev)
+	}
+}
+
+// Writes the events as newline-delimited JSON
+type JSONWriter struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+func NewJSONWriter(w io.Writer) *JSONWriter {
+	return &JSONWriter{encoder: json.NewEncoder(w)}
+}
+
+func (jw *JSONWriter) Emit(ev Event) {
+	jw.mu.Lock()
+	defer jw.mu.Unlock()
+
+	jw.encoder.Encode(ev)
+}
+
+// Generate a random identifier for a session
+func NewSessionID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,97 @@
+package event
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSONWriter(t *testing.T) {
+	buff := new(bytes.Buffer)
+	writer := NewJSONWriter(buff)
+
+	writer.Emit(Event{Type: FILE_START, Time: time.Unix(0, 0).UTC(), Role: SENDER, Session: "abcd", File: "hello.txt", Size: 12})
+	writer.Emit(Event{Type: FILE_DONE, Time: time.Unix(0, 0).UTC(), Role: SENDER, Session: "abcd", File: "hello.txt", Bytes: 12})
+
+	lines := strings.Split(strings.TrimSpace(buff.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected one line per event, got %d", len(lines))
+	}
+
+	want := `{"type":"file_start","time":"1970-01-01T00:00:00Z","role":"sender","session":"abcd","file":"hello.txt","size":12}`
+	if lines[0] != want {
+		t.Errorf("encoding mismatch: got %s want %s", lines[0], want)
+	}
+
+	var got Event
+	if err := json.Unmarshal([]byte(lines[1]), &got); err != nil {
+		t.Fatalf("failed to decode event: %v", err)
+	}
+
+	if got.Type != FILE_DONE || got.Bytes != 12 {
+		t.Errorf("decoding mismatch: got %+v", got)
+	}
+}
+
+func TestTee(t *testing.T) {
+	if Tee(nil, nil) != nil {
+		t.Error("expected no sink without any sink")
+	}
+
+	var first, second []Type
+	sink := Tee(SinkFunc(func(ev Event) { first = append(first, ev.Type) }), nil, SinkFunc(func(ev Event) { second = append(second, ev.Type) }))
+	sink.Emit(Event{Type: SUMMARY})
+
+	if len(first) != 1 || len(second) != 1 {
+		t.Errorf("every sink should get the event: got %v and %v", first, second)
+	}
+}
+
+func TestOutcome(t *testing.T) {
+	events := []Event{
+		{Type: SESSION_START},
+		{Type: FILE_START, File: "a.txt", Size: 5},
+		{Type: FILE_DONE, File: "a.txt", Bytes: 5, Hash: "aaaa", Duration: 0.5},
+		{Type: ERROR, File: "secret.txt", Error: "permission denied", ErrorKind: "filesystem"},
+		{Type: FILE_START, File: "b.txt", Size: 8},
+		{Type: ERROR, File: "b.txt", Error: "connection reset", ErrorKind: "network"},
+		// The receipt tells that a file transferred earlier differs
+		{Type: ERROR, File: "a.txt", Error: "checksum mismatch", ErrorKind: "integrity"},
+	}
+
+	outcome := NewOutcome(Event{Session: "abcd", Role: SENDER})
+	for _, ev := range events {
+		if outcome.Add(ev) {
+			t.Fatalf("the session ended early with %s", ev.Type)
+		}
+	}
+	if !outcome.Add(Event{Type: SUMMARY, Duration: 2}) {
+		t.Fatal("the session should end with the summary")
+	}
+
+	want := []FileOutcome{
+		{Name: "a.txt", Size: 5, Bytes: 5, Hash: "aaaa", Duration: 0.5, Error: "checksum mismatch", ErrorKind: "integrity"},
+		{Name: "secret.txt", Error: "permission denied", ErrorKind: "filesystem"},
+		{Name: "b.txt", Size: 8, Error: "connection reset", ErrorKind: "network"},
+	}
+	if len(outcome.Files) != len(want) {
+		t.Fatalf("got %d files, want %d: %+v", len(outcome.Files), len(want), outcome.Files)
+	}
+	for i, file := range want {
+		if outcome.Files[i] != file {
+			t.Errorf("file %d: got %+v, want %+v", i, outcome.Files[i], file)
+		}
+	}
+	// Nothing was delivered
+	if outcome.Bytes != 0 || outcome.Duration != 2 || outcome.Error != "" {
+		t.Errorf("unexpected outcome: %+v", outcome)
+	}
+
+	// No summary follows a session that failed before it started
+	failed := NewOutcome(Event{Session: "efgh"})
+	if !failed.Add(Event{Type: ERROR, Error: "the share is closed", ErrorKind: "auth"}) || failed.ErrorKind != "auth" {
+		t.Errorf("unexpected outcome: %+v", failed)
+	}
+}
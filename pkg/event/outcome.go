@@ -0,0 +1,91 @@
+package event
+
+import (
+	"slices"
+	"time"
+)
+
+// What the events of a session tell about a file
+type FileOutcome struct {
+	Name      string
+	Size      uint64 // As announced, 0 for a stream
+	Bytes     uint64
+	Hash      string  // SHA-256 of the data transferred, empty until the file is done
+	Duration  float64 // In seconds
+	Error     string  // Why the file failed, empty when it didn't
+	ErrorKind string
+}
+
+// What the events of a session tell about it, built one event at a time
+type Outcome struct {
+	Session string
+	Role    string
+	Peer    string
+	Time    time.Time // Of the start of the session, or of its first event until then
+	Started bool
+
+	Files    []FileOutcome
+	Bytes    uint64  // Of the files transferred, without the ones failed by the receipt
+	Duration float64 // In seconds, known once the session is over
+
+	// Why the session stopped before the end, empty when it went through
+	Error     string
+	ErrorKind string
+}
+
+// Start the outcome of a session with its first event
+func NewOutcome(ev Event) *Outcome {
+	return &Outcome{Session: ev.Session, Role: ev.Role, Peer: ev.Peer, Time: ev.Time}
+}
+
+// Update the outcome with an event of the session, reports if the session is over
+func (o *Outcome) Add(ev Event) bool {
+	// The file in progress is the last one until it is done or failed
+	var current *FileOutcome
+	if n := len(o.Files); n > 0 && o.Files[n-1].Hash == "" && o.Files[n-1].Error == "" {
+		current = &o.Files[n-1]
+	}
+
+	switch ev.Type {
+	case SESSION_START:
+		o.Started = true
+		o.Time = ev.Time
+
+	case FILE_START:
+		o.Files = append(o.Files, FileOutcome{Name: ev.File, Size: ev.Size})
+
+	case FILE_DONE:
+		if current != nil {
+			current.Bytes = ev.Bytes
+			current.Hash = ev.Hash
+			current.Duration = ev.Duration
+			o.Bytes += ev.Bytes
+		}
+
+	case ERROR:
+		// A file already transferred fails when the receipt of the receiver says so
+		done := slices.IndexFunc(o.Files, func(f FileOutcome) bool { return f.Name == ev.File && f.Hash != "" })
+		switch {
+		case ev.File == "":
+			o.Error, o.ErrorKind = ev.Error, ev.ErrorKind
+			// No summary comes for a session that failed while being set up
+			return !o.Started
+		case current != nil && current.Name == ev.File:
+			current.Error, current.ErrorKind = ev.Error, ev.ErrorKind
+		case done >= 0:
+			if o.Files[done].Error == "" {
+				o.Bytes -= o.Files[done].Bytes
+			}
+			o.Files[done].Error, o.Files[done].ErrorKind = ev.Error, ev.ErrorKind
+		default:
+			// Failed before it started, as when the sender can't read it
+			o.Files = append(o.Files, FileOutcome{Name: ev.File, Error: ev.Error, ErrorKind: ev.ErrorKind})
+		}
+
+	case SUMMARY:
+		o.Duration = ev.Duration
+		return true
+	}
+
+	return false
+}
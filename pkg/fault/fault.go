@@ -0,0 +1,216 @@
+package fault
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Returned once a connection is dropped by its schedule, it passes for a connection reset by the peer
+var Disconnected = fmt.Errorf("connection dropped by the fault schedule: %w", syscall.ECONNRESET)
+
+// Faults injected in the connections, for testing how a transfer copes with a bad network.
+// The same seed gives the same faults at the same offsets, the n-th connection wrapped by a
+// schedule always behaves the same way
+type Schedule struct {
+	Seed int64
+
+	// Wait before each write, plus up to Jitter more
+	Latency, Jitter time.Duration
+
+	// Bytes per second in each direction, 0 for no limit
+	Bandwidth uint64
+
+	// Probability for a read to return only part of the data available, and for a write
+	// to be split in several writes
+	Short float64
+
+	// Probability for each byte read to have a bit flipped
+	Corrupt float64
+
+	// Drop the connection after that many bytes read and written, 0 to keep it
+	Disconnect uint64
+
+	conns atomic.Int64 // Connections wrapped so far
+}
+
+// Wrap a connection in the faults of the schedule, a nil schedule leaves it as is
+func (s *Schedule) Wrap(conn net.Conn) net.Conn {
+	if s == nil {
+		return conn
+	}
+
+	seed := s.Seed + 2*s.conns.Add(1)
+	c := &Conn{
+		Conn:     conn,
+		schedule: s,
+		read:     newDirection(seed),
+		write:    newDirection(seed + 1),
+	}
+	if s.Corrupt > 0 {
+		c.read.nextCorrupt = c.read.corruptFrom(0, s.Corrupt)
+	}
+
+	return c
+}
+
+// Short description of the faults, as given to -debug-faults
+func (s *Schedule) String() string {
+	var faults []string
+	if s.Latency > 0 || s.Jitter > 0 {
+		faults = append(faults, fmt.Sprintf("latency=%s", s.Latency), fmt.Sprintf("jitter=%s", s.Jitter))
+	}
+	if s.Bandwidth > 0 {
+		faults = append(faults, fmt.Sprintf("bandwidth=%d", s.Bandwidth))
+	}
+	if s.Short > 0 {
+		faults = append(faults, fmt.Sprintf("short=%g", s.Short))
+	}
+	if s.Corrupt > 0 {
+		faults = append(faults, fmt.Sprintf("corrupt=%g", s.Corrupt))
+	}
+	if s.Disconnect > 0 {
+		faults = append(faults, fmt.Sprintf("disconnect=%d", s.Disconnect))
+	}
+
+	return fmt.Sprintf("seed=%d %s", s.Seed, strings.Join(faults, " "))
+}
+
+// State of the faults of one direction, each has its own random source so that
+// concurrent reads and writes don't change each other's faults
+type direction struct {
+	mu     sync.Mutex
+	random *rand.Rand
+
+	start       time.Time // Of the first transfer, for the bandwidth
+	bytes       uint64    // Transferred in this direction
+	nextCorrupt uint64    // Offset of the next byte to corrupt
+}
+
+func newDirection(seed int64) *direction {
+	return &direction{random: rand.New(rand.NewSource(seed))}
+}
+
+// Offset of the next byte to corrupt from an offset on, for a probability per byte
+func (d *direction) corruptFrom(offset uint64, probability float64) uint64 {
+	return offset + uint64(d.random.ExpFloat64()/probability)
+}
+
+// Wait until the bytes transferred fit in the bandwidth
+func (d *direction) pace(bandwidth uint64, n int) {
+	if d.start.IsZero() {
+		d.start = time.Now()
+	}
+	d.bytes += uint64(n)
+
+	if bandwidth > 0 {
+		due := d.start.Add(time.Duration(float64(d.bytes) / float64(bandwidth) * float64(time.Second)))
+		time.Sleep(time.Until(due))
+	}
+}
+
+// A connection with injected faults
+type Conn struct {
+	net.Conn
+	schedule    *Schedule
+	read, write *direction
+
+	transferred atomic.Uint64 // Read and written, for Disconnect
+	dropped     atomic.Bool
+}
+
+// Room left before the connection is dropped, up to n bytes
+func (c *Conn) allowance(n int) int {
+	limit := c.schedule.Disconnect
+	if limit == 0 {
+		return n
+	}
+
+	done := c.transferred.Load()
+	if done >= limit {
+		return 0
+	}
+
+	return int(min(uint64(n), limit-done))
+}
+
+// Close the connection for good, once its bytes are spent
+func (c *Conn) drop() error {
+	if !c.dropped.Swap(true) {
+		c.Conn.Close()
+	}
+
+	return Disconnected
+}
+
+func (c *Conn) Read(p []byte) (int, error) {
+	if c.dropped.Load() {
+		return 0, Disconnected
+	}
+
+	d := c.read
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	size := c.allowance(len(p))
+	if size == 0 && len(p) > 0 {
+		return 0, c.drop()
+	}
+	if size > 1 && d.random.Float64() < c.schedule.Short {
+		size = 1 + d.random.Intn(size)
+	}
+
+	n, err := c.Conn.Read(p[:size])
+	c.transferred.Add(uint64(n))
+
+	// Flip a bit of each corrupted byte in what was just read
+	for c.schedule.Corrupt > 0 && d.nextCorrupt < d.bytes+uint64(n) {
+		p[d.nextCorrupt-d.bytes] ^= 1 << d.random.Intn(8)
+		d.nextCorrupt = d.corruptFrom(d.nextCorrupt+1, c.schedule.Corrupt)
+	}
+	d.pace(c.schedule.Bandwidth, n)
+
+	return n, err
+}
+
+func (c *Conn) Write(p []byte) (int, error) {
+	if c.dropped.Load() {
+		return 0, Disconnected
+	}
+
+	d := c.write
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delay := c.schedule.Latency
+	if c.schedule.Jitter > 0 {
+		delay += time.Duration(d.random.Int63n(int64(c.schedule.Jitter)))
+	}
+	time.Sleep(delay)
+
+	written := 0
+	for written < len(p) {
+		size := c.allowance(len(p) - written)
+		if size == 0 {
+			return written, c.drop()
+		}
+		if size > 1 && d.random.Float64() < c.schedule.Short {
+			size = 1 + d.random.Intn(size)
+		}
+
+		n, err := c.Conn.Write(p[written : written+size])
+		written += n
+		c.transferred.Add(uint64(n))
+		d.pace(c.schedule.Bandwidth, n)
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
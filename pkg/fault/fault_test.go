@@ -0,0 +1,170 @@
+package fault
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// Send data through a connection wrapped in the schedule, returns what the other end read
+// and the error of the reading side
+func transmit(t *testing.T, schedule *Schedule, data []byte) ([]byte, error) {
+	t.Helper()
+
+	client, server := net.Pipe()
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+
+	reader := schedule.Wrap(server)
+	go func() {
+		client.Write(data)
+		client.Close()
+	}()
+
+	var received bytes.Buffer
+	buff := make([]byte, 1024)
+	for {
+		n, err := reader.Read(buff)
+		received.Write(buff[:n])
+		if err == io.EOF {
+			return received.Bytes(), nil
+		}
+		if err != nil {
+			return received.Bytes(), err
+		}
+	}
+}
+
+func testData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	return data
+}
+
+func TestNilScheduleKeepsConnection(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	var schedule *Schedule
+	if schedule.Wrap(server) != server {
+		t.Error("a nil schedule should leave the connection as is")
+	}
+}
+
+func TestShortReads(t *testing.T) {
+	data := testData(64 << 10)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	reader := (&Schedule{Short: 1}).Wrap(server)
+	defer reader.Close()
+	go client.Write(data)
+
+	buff := make([]byte, len(data))
+	n, err := reader.Read(buff)
+	if err != nil || n >= len(data) {
+		t.Fatalf("got %d bytes and %v, want a short read", n, err)
+	}
+
+	// The rest of the data still arrives
+	if _, err := io.ReadFull(reader, buff[n:]); err != nil || !bytes.Equal(buff, data) {
+		t.Errorf("the data differs once read in pieces: %v", err)
+	}
+}
+
+func TestSplitWrites(t *testing.T) {
+	data := testData(64 << 10)
+
+	client, server := net.Pipe()
+	defer server.Close()
+	writer := (&Schedule{Short: 1}).Wrap(client)
+
+	done := make(chan error, 1)
+	go func() {
+		n, err := writer.Write(data)
+		if err == nil && n != len(data) {
+			err = io.ErrShortWrite
+		}
+		writer.Close()
+		done <- err
+	}()
+
+	received, err := io.ReadAll(server)
+	if err != nil || !bytes.Equal(received, data) {
+		t.Errorf("the data differs once written in pieces: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("failed to write: %v", err)
+	}
+}
+
+func TestDisconnect(t *testing.T) {
+	data := testData(10000)
+
+	received, err := transmit(t, &Schedule{Disconnect: 4000}, data)
+	if !errors.Is(err, Disconnected) || !errors.Is(err, syscall.ECONNRESET) {
+		t.Fatalf("got %v, want %v", err, Disconnected)
+	}
+	if !bytes.Equal(received, data[:4000]) {
+		t.Errorf("got %d bytes before the disconnection, want 4000", len(received))
+	}
+}
+
+func TestCorruptionIsDeterministic(t *testing.T) {
+	data := testData(1 << 20)
+
+	first, err := transmit(t, &Schedule{Seed: 42, Corrupt: 0.001}, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := transmit(t, &Schedule{Seed: 42, Corrupt: 0.001}, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := transmit(t, &Schedule{Seed: 7, Corrupt: 0.001}, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	corrupted := 0
+	for i := range data {
+		if first[i] != data[i] {
+			corrupted++
+		}
+	}
+	// About one byte in a thousand
+	if corrupted < 500 || corrupted > 1600 {
+		t.Errorf("%d bytes corrupted out of %d", corrupted, len(data))
+	}
+
+	if !bytes.Equal(first, second) {
+		t.Error("the same seed corrupted different bytes")
+	}
+	if bytes.Equal(first, other) {
+		t.Error("another seed corrupted the same bytes")
+	}
+}
+
+func TestBandwidth(t *testing.T) {
+	data := testData(50 << 10)
+
+	start := time.Now()
+	if _, err := transmit(t, &Schedule{Bandwidth: 200 << 10}, data); err != nil {
+		t.Fatal(err)
+	}
+
+	// A quarter of a second at 200KB/s
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("got 50KB in %s, faster than the bandwidth", elapsed)
+	}
+}
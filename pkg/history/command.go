@@ -0,0 +1,148 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/LxrdShadow/linker/pkg/color"
+	"github.com/LxrdShadow/linker/pkg/event"
+	"github.com/LxrdShadow/linker/pkg/util"
+)
+
+const DATE_FORMAT = "2006-01-02 15:04"
+
+// Run the history command: list the past transfers, or show the ones of a session
+func Run(conf *util.FlagConfig, w io.Writer) error {
+	store, err := DefaultStore()
+	if err != nil {
+		return err
+	}
+
+	records, err := store.Load()
+	if err != nil {
+		return err
+	}
+
+	limit := conf.HistoryLimit
+	if conf.HistorySession != "" {
+		limit = 0
+	}
+
+	// The most recent first
+	records = Select(records, NewFilter(conf), limit)
+	slices.Reverse(records)
+
+	if conf.JSON {
+		encoder := json.NewEncoder(w)
+		for _, record := range records {
+			if err := encoder.Encode(record); err != nil {
+				return fmt.Errorf("failed to write the history: %w", err)
+			}
+		}
+		return nil
+	}
+
+	if conf.HistorySession != "" {
+		if len(records) == 0 {
+			return fmt.Errorf("%s: no such session in the history", conf.HistorySession)
+		}
+		for i, record := range records {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			Show(w, record)
+		}
+		return nil
+	}
+
+	if len(records) == 0 {
+		fmt.Fprintf(w, "No transfer found in %s\n", store.Path())
+		return nil
+	}
+	List(w, records)
+
+	return nil
+}
+
+// Print one line per record
+func List(w io.Writer, records []Record) {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "DATE\tDIRECTION\tPEER\tFILES\tSIZE\tRESULT\tSESSION")
+
+	for _, record := range records {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+			record.Time.Local().Format(DATE_FORMAT),
+			direction(record.Role),
+			record.Peer,
+			len(record.Files),
+			formatBytes(record.Bytes),
+			outcome(record.Outcome),
+			record.Session,
+		)
+	}
+
+	table.Flush()
+}
+
+// Print everything known about a record
+func Show(w io.Writer, record Record) {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(table, "Session\t%s\n", record.Session)
+	fmt.Fprintf(table, "Date\t%s\n", record.Time.Local().Format(time.DateTime))
+	fmt.Fprintf(table, "Direction\t%s %s\n", direction(record.Role), record.Peer)
+	fmt.Fprintf(table, "Duration\t%s\n", (time.Duration(record.Duration * float64(time.Second))).Round(time.Millisecond))
+	fmt.Fprintf(table, "Size\t%s in %d file(s)\n", formatBytes(record.Bytes), len(record.Files))
+	fmt.Fprintf(table, "Result\t%s\n", outcome(record.Outcome))
+	if record.Error != "" {
+		fmt.Fprintf(table, "Error\t%s\n", record.Error)
+	}
+	table.Flush()
+
+	if len(record.Files) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w)
+	table = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "FILE\tSIZE\tSHA-256")
+	for _, file := range record.Files {
+		detail := file.SHA256
+		if file.Error != "" {
+			detail = color.Sprint(color.RED, file.Error)
+		} else if file.SHA256 == "" {
+			detail = "incomplete"
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\n", file.Name, formatBytes(file.Bytes), detail)
+	}
+	table.Flush()
+}
+
+// "from" and "to" read better than the role
+func direction(role string) string {
+	if role == event.SENDER {
+		return "sent to"
+	}
+
+	return "received from"
+}
+
+func outcome(result string) string {
+	switch result {
+	case COMPLETED:
+		return color.Sprint(color.GREEN, result)
+	case PARTIAL:
+		return color.Sprint(color.YELLOW, result)
+	default:
+		return color.Sprint(color.RED, result)
+	}
+}
+
+func formatBytes(bytes uint64) string {
+	unit, denom := util.ByteDecodeUnit(bytes)
+	return fmt.Sprintf("%.2f%s", float64(bytes)/float64(denom), unit)
+}
@@ -0,0 +1,71 @@
+package history
+
+import (
+	"strings"
+	"time"
+
+	"github.com/LxrdShadow/linker/pkg/util"
+)
+
+// Selects records, the empty fields match everything
+type Filter struct {
+	Session string // Start of the session identifier
+	Peer    string // Part of the peer address
+	File    string // Part of the name of one of the files
+	Role    string // event.SENDER or event.RECEIVER
+	Since   time.Time
+	Until   time.Time
+}
+
+// Get the filter given to the history command
+func NewFilter(conf *util.FlagConfig) Filter {
+	return Filter{
+		Session: conf.HistorySession,
+		Peer:    conf.HistoryPeer,
+		File:    conf.HistoryFile,
+		Role:    conf.HistoryRole,
+		Since:   conf.HistorySince,
+		Until:   conf.HistoryUntil,
+	}
+}
+
+func (f Filter) Match(record Record) bool {
+	if !strings.HasPrefix(record.Session, f.Session) || !strings.Contains(record.Peer, f.Peer) {
+		return false
+	}
+
+	if f.Role != "" && record.Role != f.Role {
+		return false
+	}
+
+	if !f.Since.IsZero() && record.Time.Before(f.Since) || !f.Until.IsZero() && !record.Time.Before(f.Until) {
+		return false
+	}
+
+	if f.File == "" {
+		return true
+	}
+	for _, file := range record.Files {
+		if strings.Contains(file.Name, f.File) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Keep the records selected by the filter, at most limit of the most recent ones (0 for no limit)
+func Select(records []Record, filter Filter, limit int) []Record {
+	var selected []Record
+	for _, record := range records {
+		if filter.Match(record) {
+			selected = append(selected, record)
+		}
+	}
+
+	if limit > 0 && len(selected) > limit {
+		selected = selected[len(selected)-limit:]
+	}
+
+	return selected
+}
@@ -0,0 +1,164 @@
+// Package history keeps a record of every transfer session in a local file, one JSON object per line.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+)
+
+const HISTORY_ENV_VAR = "LNKR_HISTORY" // Overrides the path of the history file
+
+// Outcome of a session
+const (
+	COMPLETED = "completed"
+	PARTIAL   = "partial" // Some files failed, the session went to the end
+	FAILED    = "failed"  // The session stopped before the end
+)
+
+// A file of a session
+type FileRecord struct {
+	Name   string `json:"name"`
+	Size   uint64 `json:"size,omitempty"` // As announced, 0 for a stream
+	Bytes  uint64 `json:"bytes"`
+	SHA256 string `json:"sha256,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// A session with a peer, as seen from one side
+type Record struct {
+	Session  string       `json:"session"`
+	Role     string       `json:"role"`
+	Peer     string       `json:"peer"`
+	Time     time.Time    `json:"time"`
+	Duration float64      `json:"duration_seconds"`
+	Files    []FileRecord `json:"files"`
+	Bytes    uint64       `json:"bytes"` // Of the files delivered, the ones failed by the receipt aren't counted
+	Outcome  string       `json:"outcome"`
+	Error    string       `json:"error,omitempty"`
+}
+
+// Get the path of the history file ($XDG_STATE_HOME/lnkr/history on Linux)
+func Path() (string, error) {
+	if path := os.Getenv(HISTORY_ENV_VAR); path != "" {
+		return path, nil
+	}
+
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "lnkr", "history"), nil
+	}
+
+	// Only the Unix-like systems follow the XDG layout
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to find the configuration directory: %w", err)
+		}
+		return filepath.Join(dir, "lnkr", "history"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the home directory: %w", err)
+	}
+
+	return filepath.Join(home, ".local", "state", "lnkr", "history"), nil
+}
+
+// The history file, safe to use from several goroutines
+type Store struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// Open the history file at its default path
+func DefaultStore() (*Store, error) {
+	path, err := Path()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewStore(path), nil
+}
+
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Add a record at the end of the history, the file is created if needed
+func (s *Store) Append(record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode the record: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The history tells who sent what, only the user can read it
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("failed to create the history directory: %w", err)
+	}
+
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open the history: %w", err)
+	}
+	defer file.Close()
+
+	// A single write keeps the lines whole when several programs append at once
+	if _, err := file.Write(line); err != nil {
+		return fmt.Errorf("failed to write the history: %w", err)
+	}
+
+	return nil
+}
+
+// Read every record, oldest first. A missing file is an empty history
+func (s *Store) Load() ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the history: %w", err)
+	}
+	defer file.Close()
+
+	var records []Record
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var record Record
+			// A line cut by a crash is skipped, the rest of the history is still good
+			if json.Unmarshal(line, &record) == nil {
+				records = append(records, record)
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the history: %w", err)
+		}
+	}
+
+	return records, nil
+}
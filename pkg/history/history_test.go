@@ -0,0 +1,127 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/LxrdShadow/linker/pkg/event"
+)
+
+func TestStore(t *testing.T) {
+	store := NewStore(filepath.Join(t.TempDir(), "lnkr", "history"))
+
+	records, err := store.Load()
+	if err != nil || len(records) != 0 {
+		t.Fatalf("a missing file should be an empty history, got %v and %v", records, err)
+	}
+
+	first := Record{Session: "aaaa", Role: event.SENDER, Peer: "192.168.1.2:50000", Outcome: COMPLETED,
+		Files: []FileRecord{{Name: "hello.txt", Size: 12, Bytes: 12, SHA256: "abcd"}}}
+	second := Record{Session: "bbbb", Role: event.RECEIVER, Peer: "192.168.1.3:9090", Outcome: FAILED, Error: "connection timed out"}
+
+	for _, record := range []Record{first, second} {
+		if err := store.Append(record); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+
+	// A line cut by a crash doesn't hide the others
+	file, _ := os.OpenFile(store.Path(), os.O_WRONLY|os.O_APPEND, 0)
+	file.WriteString(`{"session":"cccc","ro`)
+	file.Close()
+
+	records, err = store.Load()
+	if err != nil {
+		t.Fatalf("failed to load: %v", err)
+	}
+	if len(records) != 2 || records[0].Session != "aaaa" || records[1].Error != second.Error || records[0].Files[0].SHA256 != "abcd" {
+		t.Errorf("unexpected records: %+v", records)
+	}
+
+	if info, err := os.Stat(store.Path()); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("the history should only be readable by the user: %v %v", info.Mode(), err)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	store := NewStore(filepath.Join(t.TempDir(), "history"))
+	recorder := NewRecorder(store)
+	start := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+
+	emit := func(session string, ev event.Event) {
+		ev.Session, ev.Role, ev.Peer, ev.Time = session, event.RECEIVER, "192.168.1.2:9090", start
+		recorder.Emit(ev)
+	}
+
+	// A session where a file failed
+	emit("aaaa", event.Event{Type: event.SESSION_START})
+	emit("aaaa", event.Event{Type: event.FILE_START, File: "a.txt", Size: 5})
+	emit("aaaa", event.Event{Type: event.FILE_DONE, File: "a.txt", Bytes: 5, Hash: "1234"})
+	emit("aaaa", event.Event{Type: event.FILE_START, File: "b.txt", Size: 7})
+	emit("aaaa", event.Event{Type: event.ERROR, File: "b.txt", Error: "disk full\n"})
+
+	// A session that failed while being set up, no summary comes
+	emit("bbbb", event.Event{Type: event.ERROR, Error: "the share is closed"})
+
+	emit("aaaa", event.Event{Type: event.SUMMARY, Duration: 1.5})
+
+	records, _ := store.Load()
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %+v", records)
+	}
+
+	failed, partial := records[0], records[1]
+	if failed.Session != "bbbb" || failed.Outcome != FAILED || failed.Error != "the share is closed" {
+		t.Errorf("unexpected record of the failed session: %+v", failed)
+	}
+
+	want := []FileRecord{{Name: "a.txt", Size: 5, Bytes: 5, SHA256: "1234"}, {Name: "b.txt", Size: 7, Error: "disk full"}}
+	if partial.Outcome != PARTIAL || partial.Bytes != 5 || partial.Duration != 1.5 || !partial.Time.Equal(start) ||
+		len(partial.Files) != 2 || partial.Files[0] != want[0] || partial.Files[1] != want[1] {
+		t.Errorf("unexpected record of the partial session: %+v", partial)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	day := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	records := []Record{
+		{Session: "a1", Role: event.SENDER, Peer: "10.0.0.2:50000", Time: day.Add(-24 * time.Hour), Files: []FileRecord{{Name: "photos/cat.jpg"}}},
+		{Session: "b2", Role: event.RECEIVER, Peer: "10.0.0.3:9090", Time: day.Add(time.Hour), Files: []FileRecord{{Name: "report.pdf"}}},
+		{Session: "c3", Role: event.RECEIVER, Peer: "10.0.0.2:9090", Time: day.Add(2 * time.Hour), Files: []FileRecord{{Name: "cat.png"}}},
+	}
+
+	cases := []struct {
+		name   string
+		filter Filter
+		limit  int
+		want   []string
+	}{
+		{name: "everything", want: []string{"a1", "b2", "c3"}},
+		{name: "most recent", limit: 2, want: []string{"b2", "c3"}},
+		{name: "peer", filter: Filter{Peer: "10.0.0.2"}, want: []string{"a1", "c3"}},
+		{name: "file", filter: Filter{File: "cat"}, want: []string{"a1", "c3"}},
+		{name: "role", filter: Filter{Role: event.RECEIVER}, want: []string{"b2", "c3"}},
+		{name: "session", filter: Filter{Session: "b"}, want: []string{"b2"}},
+		{name: "dates", filter: Filter{Since: day, Until: day.Add(2 * time.Hour)}, want: []string{"b2"}},
+	}
+
+	for _, test := range cases {
+		var got []string
+		for _, record := range Select(records, test.filter, test.limit) {
+			got = append(got, record.Session)
+		}
+
+		if len(got) != len(test.want) {
+			t.Errorf("%s: got %v want %v", test.name, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%s: got %v want %v", test.name, got, test.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package history
+
+import (
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/LxrdShadow/linker/pkg/event"
+	"github.com/LxrdShadow/linker/pkg/log"
+)
+
+// Builds a record of each session from its events, saved when the session ends
+type Recorder struct {
+	store *Store
+
+	// Destination of the messages, the logger of the log package when nil
+	Logger *log.Logger
+
+	mu       sync.Mutex
+	sessions map[string]*event.Outcome // In progress
+}
+
+func NewRecorder(store *Store) *Recorder {
+	return &Recorder{
+		store:    store,
+		sessions: make(map[string]*event.Outcome),
+	}
+}
+
+func (r *Recorder) Emit(ev event.Event) {
+	r.mu.Lock()
+	record, done := r.record(ev)
+	r.mu.Unlock()
+
+	if !done {
+		return
+	}
+
+	if err := r.store.Append(record); err != nil {
+		r.logger().Warningf("the session %s is missing from the history: %s\n", record.Session, err.Error())
+	}
+}
+
+func (r *Recorder) logger() *log.Logger {
+	if r.Logger != nil {
+		return r.Logger
+	}
+
+	return log.Default()
+}
+
+// Update the session of an event, returns its record once it is over. mu has to be held
+func (r *Recorder) record(ev event.Event) (Record, bool) {
+	outcome, ok := r.sessions[ev.Session]
+	if !ok {
+		outcome = event.NewOutcome(ev)
+		r.sessions[ev.Session] = outcome
+	}
+
+	if !outcome.Add(ev) {
+		return Record{}, false
+	}
+	delete(r.sessions, ev.Session)
+
+	return newRecord(outcome), true
+}
+
+// Settle the record of a session that is over
+func newRecord(outcome *event.Outcome) Record {
+	record := Record{
+		Session:  outcome.Session,
+		Role:     outcome.Role,
+		Peer:     outcome.Peer,
+		Time:     outcome.Time,
+		Duration: outcome.Duration,
+		Bytes:    outcome.Bytes,
+		Error:    strings.TrimSpace(outcome.Error),
+	}
+	for _, file := range outcome.Files {
+		record.Files = append(record.Files, FileRecord{
+			Name:   file.Name,
+			Size:   file.Size,
+			Bytes:  file.Bytes,
+			SHA256: file.Hash,
+			Error:  strings.TrimSpace(file.Error),
+		})
+	}
+
+	record.Outcome = COMPLETED
+	if record.Error != "" {
+		record.Outcome = FAILED
+	} else if slices.ContainsFunc(record.Files, func(f FileRecord) bool { return f.Error != "" }) {
+		record.Outcome = PARTIAL
+	}
+
+	return record
+}
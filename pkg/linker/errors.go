@@ -0,0 +1,19 @@
+package linker
+
+import lnkerrors "github.com/LxrdShadow/linker/internal/errors"
+
+// Kinds of failures, errors.Is(err, linker.ErrNetwork) tells what went wrong with a transfer
+// or with one of its files
+var (
+	ErrNetwork    error = lnkerrors.Network    // The peer can't be reached or the connection was lost
+	ErrProtocol   error = lnkerrors.Protocol   // The peer sent something that can't be understood
+	ErrAuth       error = lnkerrors.Auth       // The share is closed to the receiver
+	ErrIntegrity  error = lnkerrors.Integrity  // Files missing or different at the other end
+	ErrFilesystem error = lnkerrors.Filesystem // A file can't be read or written
+	ErrCanceled   error = lnkerrors.Canceled   // Stopped on either side
+)
+
+// Exit status of lnkr for an error, 0 for nil
+func ExitCode(err error) int {
+	return lnkerrors.ExitCode(err)
+}
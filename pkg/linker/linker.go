@@ -0,0 +1,233 @@
+// Package linker shares and receives files from another program, without the command line.
+//
+// Nothing is printed unless asked: the messages go to the Log writers of the options
+// and the progress is reported to the OnEvent callbacks, with the events documented in docs/events.md.
+package linker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/LxrdShadow/linker/internal/config"
+	lnkerrors "github.com/LxrdShadow/linker/internal/errors"
+	"github.com/LxrdShadow/linker/pkg/event"
+	"github.com/LxrdShadow/linker/pkg/log"
+	"github.com/LxrdShadow/linker/pkg/transfer"
+	"github.com/LxrdShadow/linker/pkg/util"
+)
+
+// Settings of the connections, 0 uses the default and a negative value disables the setting
+type Timeouts struct {
+	HandshakeTimeout time.Duration // Longest wait for the peer while setting up a session, 10s by default
+	IdleTimeout      time.Duration // Longest wait for the peer during the transfer, 60s by default
+	KeepAlive        time.Duration // Interval of the TCP keepalive probes, 15s by default
+}
+
+// Settings of a share
+type SendOptions struct {
+	Addr    string   // Address to listen on (host:port), a free port is picked with port 0
+	Entries []string // Files and directories to share
+
+	// Data shared as a single file named StreamName, after the entries.
+	// Its place among them can be set with the "-" entry
+	Stream     io.Reader
+	StreamName string
+
+	MaxDownloads int           // Close the share after that many receivers, 0 for no limit
+	Expire       time.Duration // Close the share after that time, 0 to never expire
+	ChunkSize    uint32        // Proposed to the receivers, 64KB when 0
+
+	Timeouts
+
+	// Optional, called with the address of each receiver before its transfer starts,
+	// refused receivers are told that the share is closed
+	Approve func(peer string) bool
+
+	// Optional, called with the address of the share once it is listening
+	OnListen func(addr string)
+
+	// Optional, called with every event of the transfers. The receivers are served
+	// concurrently, so it can be called from several goroutines at once
+	OnEvent func(event.Event)
+
+	// Destination of the messages, discarded when nil
+	Log io.Writer
+}
+
+// Settings of a download
+type ReceiveOptions struct {
+	Addr string // Address of the sender (host:port)
+	Dir  string // Directory to store the received files, the current one when empty
+
+	// When set, everything received is written one after the other to it instead of Dir
+	Writer io.Writer
+
+	MaxChunkSize uint32 // Largest chunk size accepted from the sender, 16MB when 0
+
+	Timeouts
+
+	// Reconnections when the connection is lost, each one resumes the transfer.
+	// 3 by default and negative to disable, the delay between them starts at
+	// RetryDelay (1s by default) and doubles up to RetryMaxDelay (30s by default)
+	Retries       int
+	RetryDelay    time.Duration
+	RetryMaxDelay time.Duration
+
+	// Optional, called with every event of the transfer
+	OnEvent func(event.Event)
+
+	// Destinations of the messages and of the progress bars, discarded when nil
+	Log      io.Writer
+	Progress io.Writer
+}
+
+// Share files until the share is closed, by MaxDownloads, Expire or the context.
+// Returns the result of each receiver that was served, in the order they connected
+func Send(ctx context.Context, opts SendOptions) ([]SessionResult, error) {
+	entries := opts.Entries
+	if opts.Stream != nil && !slices.Contains(entries, config.STDIN_ENTRY) {
+		entries = append(slices.Clip(entries), config.STDIN_ENTRY)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("nothing to share")
+	}
+	if slices.Contains(entries, config.STDIN_ENTRY) && opts.Stream == nil {
+		return nil, fmt.Errorf("the %q entry needs a stream", config.STDIN_ENTRY)
+	}
+
+	chunkSize, err := chunkSizeOrDefault(opts.ChunkSize, config.CHUNK_SIZE)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := opts.Timeouts.connection(opts.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	results := newCollector(opts.OnEvent)
+	sender := &transfer.Sender{
+		Connection:   conn,
+		Entries:      entries,
+		MaxDownloads: opts.MaxDownloads,
+		Expire:       opts.Expire,
+		StreamName:   opts.StreamName,
+		Stdin:        opts.Stream,
+		ChunkSize:    chunkSize,
+		Events:       results,
+		Approve:      opts.Approve,
+		OnListen:     opts.OnListen,
+		Logger:       newLogger(opts.Log),
+	}
+
+	err = lnkerrors.Classify(sender.ListenContext(ctx))
+
+	return results.sessions(), err
+}
+
+// Download the files of a sender, the result is returned even when the transfer failed.
+// It is the result of the last attempt when the connection was lost along the way
+func Receive(ctx context.Context, opts ReceiveOptions) (*SessionResult, error) {
+	chunkSize, err := chunkSizeOrDefault(opts.MaxChunkSize, config.CHUNK_SIZE_UPPER_BOUND)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := opts.Timeouts.connection(opts.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := opts.Dir
+	if dir == "" {
+		dir = config.RECEIVE_DIRECTORY
+	}
+
+	results := newCollector(opts.OnEvent)
+	receiver := &transfer.Receiver{
+		Connection:   conn,
+		ReceiveDir:   dir,
+		Stdout:       opts.Writer,
+		ChunkSize:    chunkSize,
+		Events:       results,
+		FileProgress: true,
+		Progress:     opts.Progress,
+		Logger:       newLogger(opts.Log),
+
+		Retries:       retriesOrDefault(opts.Retries),
+		RetryDelay:    durationOrDefault(opts.RetryDelay, config.RETRY_DELAY),
+		RetryMaxDelay: durationOrDefault(opts.RetryMaxDelay, config.RETRY_MAX_DELAY),
+	}
+
+	err = lnkerrors.Classify(receiver.ConnectContext(ctx))
+
+	result := &SessionResult{Peer: opts.Addr}
+	if sessions := results.sessions(); len(sessions) > 0 {
+		result = &sessions[len(sessions)-1]
+	}
+	if err != nil {
+		result.Err = err
+	}
+
+	return result, err
+}
+
+// Settings of a connection to or from an address
+func (t Timeouts) connection(addr string) (*transfer.Connection, error) {
+	host, port, err := util.GetHostPortFromAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &transfer.Connection{
+		Host:    host,
+		Port:    port,
+		Network: "tcp",
+		Addr:    addr,
+
+		HandshakeTimeout: durationOrDefault(t.HandshakeTimeout, config.HANDSHAKE_TIMEOUT),
+		IdleTimeout:      durationOrDefault(t.IdleTimeout, config.IDLE_TIMEOUT),
+		KeepAlive:        durationOrDefault(t.KeepAlive, config.KEEPALIVE_INTERVAL),
+	}, nil
+}
+
+// The transfers use 0 to disable a setting
+func durationOrDefault(d, fallback time.Duration) time.Duration {
+	if d == 0 {
+		return fallback
+	}
+
+	return max(d, 0)
+}
+
+func retriesOrDefault(retries int) int {
+	if retries == 0 {
+		return config.RETRIES
+	}
+
+	return max(retries, 0)
+}
+
+// Check a chunk size, 0 stands for the default one
+func chunkSizeOrDefault(size, fallback uint32) (uint32, error) {
+	if size == 0 {
+		return fallback, nil
+	}
+
+	if size < config.CHUNK_SIZE_LOWER_BOUND || size > config.CHUNK_SIZE_UPPER_BOUND {
+		return 0, fmt.Errorf("chunk size %d out of bounds (%d to %d bytes)", size, config.CHUNK_SIZE_LOWER_BOUND, config.CHUNK_SIZE_UPPER_BOUND)
+	}
+
+	return size, nil
+}
+
+func newLogger(w io.Writer) *log.Logger {
+	if w == nil {
+		w = io.Discard
+	}
+
+	return log.New(w, w)
+}
@@ -0,0 +1,392 @@
+package linker
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	lnkerrors "github.com/LxrdShadow/linker/internal/errors"
+	"github.com/LxrdShadow/linker/pkg/event"
+)
+
+// Start a share in the background, returns its address and a channel with its outcome
+func startShare(t *testing.T, ctx context.Context, opts SendOptions) (string, <-chan []SessionResult, <-chan error) {
+	t.Helper()
+
+	listening := make(chan string, 1)
+	opts.Addr = "127.0.0.1:0"
+	opts.OnListen = func(addr string) { listening <- addr }
+
+	results := make(chan []SessionResult, 1)
+	errs := make(chan error, 1)
+	go func() {
+		sessions, err := Send(ctx, opts)
+		results <- sessions
+		errs <- err
+	}()
+
+	select {
+	case addr := <-listening:
+		return addr, results, errs
+	case err := <-errs:
+		t.Fatalf("failed to start the share: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the share didn't start in time")
+	}
+
+	return "", nil, nil
+}
+
+func sum(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+func TestSendReceive(t *testing.T) {
+	src, dest := t.TempDir(), t.TempDir()
+
+	content := bytes.Repeat([]byte("linker"), 50000)
+	if err := os.WriteFile(filepath.Join(src, "data.bin"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var types []event.Type
+
+	addr, results, errs := startShare(t, context.Background(), SendOptions{
+		Entries:      []string{filepath.Join(src, "data.bin")},
+		MaxDownloads: 1,
+		ChunkSize:    4096,
+	})
+
+	received, err := Receive(context.Background(), ReceiveOptions{
+		Addr: addr,
+		Dir:  dest,
+		OnEvent: func(ev event.Event) {
+			mu.Lock()
+			types = append(types, ev.Type)
+			mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to receive: %v", err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(dest, "data.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("received %d bytes that differ from the %d sent", len(got), len(content))
+	}
+
+	if len(received.Files) != 1 || received.Files[0].Name != "data.bin" || received.Files[0].SHA256 != sum(content) {
+		t.Errorf("unexpected receiver result: %+v", received.Files)
+	}
+	if received.Bytes != uint64(len(content)) || received.Err != nil {
+		t.Errorf("got %d bytes and error %v, want %d bytes and no error", received.Bytes, received.Err, len(content))
+	}
+
+	if err := <-errs; err != nil {
+		t.Fatalf("the share failed: %v", err)
+	}
+	sessions := <-results
+	if len(sessions) != 1 || len(sessions[0].Files) != 1 || sessions[0].Files[0].SHA256 != sum(content) {
+		t.Errorf("unexpected sender results: %+v", sessions)
+	}
+	if sessions[0].Session == received.Session {
+		t.Errorf("each side should have its own session identifier, both got %s", received.Session)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(types) == 0 || types[0] != event.SESSION_START || types[len(types)-1] != event.SUMMARY {
+		t.Errorf("unexpected events: %v", types)
+	}
+}
+
+func TestReceiveStreamToWriter(t *testing.T) {
+	content := []byte(strings.Repeat("streamed data\n", 1000))
+
+	addr, _, errs := startShare(t, context.Background(), SendOptions{
+		Stream:       bytes.NewReader(content),
+		StreamName:   "stream.txt",
+		MaxDownloads: 1,
+	})
+
+	var out bytes.Buffer
+	received, err := Receive(context.Background(), ReceiveOptions{Addr: addr, Writer: &out})
+	if err != nil {
+		t.Fatalf("failed to receive: %v", err)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("the share failed: %v", err)
+	}
+
+	if !bytes.Equal(out.Bytes(), content) {
+		t.Errorf("got %d bytes, want %d", out.Len(), len(content))
+	}
+	if len(received.Files) != 1 || received.Files[0].Name != "stream.txt" {
+		t.Errorf("unexpected result: %+v", received.Files)
+	}
+}
+
+func TestSendCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	_, results, errs := startShare(t, ctx, SendOptions{Entries: []string{t.TempDir()}})
+
+	cancel()
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("got %v, want %v", err, context.Canceled)
+		}
+		if sessions := <-results; len(sessions) != 0 {
+			t.Errorf("expected no session, got %d", len(sessions))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the share was still open after the cancellation")
+	}
+}
+
+func TestOptionsValidation(t *testing.T) {
+	if _, err := Send(context.Background(), SendOptions{Addr: "127.0.0.1:0"}); err == nil {
+		t.Error("expected an error without entries")
+	}
+
+	if _, err := Send(context.Background(), SendOptions{Addr: "127.0.0.1:0", Entries: []string{"-"}}); err == nil {
+		t.Error("expected an error for the stream entry without a stream")
+	}
+
+	if _, err := Receive(context.Background(), ReceiveOptions{Addr: "127.0.0.1:9", MaxChunkSize: 10}); err == nil {
+		t.Error("expected an error for a chunk size out of bounds")
+	}
+}
+
+func TestReceiveHandshakeTimeout(t *testing.T) {
+	// A sender that accepts the connection and never answers
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(2 * time.Second)
+		}
+	}()
+
+	start := time.Now()
+	_, err = Receive(context.Background(), ReceiveOptions{
+		Addr:     listener.Addr().String(),
+		Dir:      t.TempDir(),
+		Timeouts: Timeouts{HandshakeTimeout: 200 * time.Millisecond},
+	})
+
+	if !errors.Is(err, lnkerrors.Timeout) {
+		t.Fatalf("got %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("the timeout took %s", elapsed)
+	}
+}
+
+// Forward connections to addr, the first one is cut once limit bytes went from addr to the client
+func startFlakyProxy(t *testing.T, addr string, limit int64) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for first := true; ; first = false {
+			client, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			server, err := net.Dial("tcp", addr)
+			if err != nil {
+				client.Close()
+				return
+			}
+
+			go func() {
+				defer client.Close()
+				defer server.Close()
+				io.Copy(server, client)
+			}()
+			go func(cut bool) {
+				defer client.Close()
+				defer server.Close()
+				if cut {
+					io.CopyN(client, server, limit)
+					return
+				}
+				io.Copy(client, server)
+			}(first)
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func TestReceiveResumesAfterLostConnection(t *testing.T) {
+	src, dest := t.TempDir(), t.TempDir()
+
+	first := bytes.Repeat([]byte("first"), 1000)
+	second := bytes.Repeat([]byte("linker"), 50000)
+	if err := os.WriteFile(filepath.Join(src, "a.txt"), first, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "b.bin"), second, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Once the receiver is back, the download of the lost connection is available again
+	addr, results, errs := startShare(t, context.Background(), SendOptions{
+		Entries:      []string{filepath.Join(src, "a.txt"), filepath.Join(src, "b.bin")},
+		MaxDownloads: 1,
+		ChunkSize:    4096,
+	})
+	proxy := startFlakyProxy(t, addr, 100000)
+
+	var mu sync.Mutex
+	var resumed []event.Event
+	received, err := Receive(context.Background(), ReceiveOptions{
+		Addr:       proxy,
+		Dir:        dest,
+		Retries:    5,
+		RetryDelay: 10 * time.Millisecond,
+		OnEvent: func(ev event.Event) {
+			if ev.Type == event.FILE_START && ev.Bytes > 0 {
+				mu.Lock()
+				resumed = append(resumed, ev)
+				mu.Unlock()
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to receive: %v", err)
+	}
+
+	for name, content := range map[string][]byte{"a.txt": first, "b.bin": second} {
+		got, err := os.ReadFile(filepath.Join(dest, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Errorf("%s: received %d bytes that differ from the %d sent", name, len(got), len(content))
+		}
+	}
+
+	// The last session completes the transfer, with the hashes of the whole files
+	if len(received.Files) != 2 || received.Files[0].SHA256 != sum(first) || received.Files[1].SHA256 != sum(second) {
+		t.Errorf("unexpected receiver result: %+v", received.Files)
+	}
+
+	mu.Lock()
+	if len(resumed) != 2 || resumed[0].Bytes != uint64(len(first)) || resumed[1].Bytes == 0 || resumed[1].Bytes >= uint64(len(second)) {
+		t.Errorf("expected the first file to be complete and the second one to be resumed, got %+v", resumed)
+	}
+	mu.Unlock()
+
+	if err := <-errs; err != nil {
+		t.Fatalf("the share failed: %v", err)
+	}
+	if sessions := <-results; len(sessions) != 2 || len(sessions[0].Failed()) == 0 || len(sessions[1].Failed()) != 0 {
+		t.Errorf("expected a lost session and a complete one, got %+v", sessions)
+	}
+}
+
+func TestReceiptReportsSkippedFiles(t *testing.T) {
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "data.bin"), []byte("linker"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	addr, results, errs := startShare(t, context.Background(), SendOptions{
+		Entries:      []string{filepath.Join(src, "data.bin")},
+		MaxDownloads: 1,
+	})
+
+	// No path fits under that directory, the receiver skips the file and says so in its receipt
+	dir := filepath.Join(t.TempDir(), strings.Repeat("directory/", 410))
+	received, err := Receive(context.Background(), ReceiveOptions{Addr: addr, Dir: dir})
+	if !errors.Is(err, ErrIntegrity) || ExitCode(err) != 6 {
+		t.Fatalf("got %v, want a missing file", err)
+	}
+	if failed := received.Failed(); len(failed) != 1 || !strings.Contains(failed[0].Err.Error(), "can't be represented") {
+		t.Errorf("expected the file to be skipped by the receiver, got %+v", received.Files)
+	}
+
+	if err := <-errs; !errors.Is(err, lnkerrors.TransferIncomplete) {
+		t.Errorf("got %v, want %v", err, lnkerrors.TransferIncomplete)
+	}
+	sessions := <-results
+	if len(sessions) != 1 || len(sessions[0].Files) != 1 || sessions[0].Files[0].Err == nil ||
+		!strings.Contains(sessions[0].Files[0].Err.Error(), "skipped by the receiver") {
+		t.Errorf("expected the receipt to fail the file on the sender, got %+v", sessions)
+	}
+}
+
+func TestSendSkipsUnreadableFiles(t *testing.T) {
+	src, dest := t.TempDir(), t.TempDir()
+	dir := filepath.Join(src, "dir")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.txt", "z.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Listed in the directory but impossible to open, even as root
+	if err := os.Symlink(filepath.Join(src, "missing"), filepath.Join(dir, "broken")); err != nil {
+		t.Fatal(err)
+	}
+
+	addr, _, errs := startShare(t, context.Background(), SendOptions{
+		Entries:      []string{dir},
+		MaxDownloads: 1,
+	})
+
+	received, err := Receive(context.Background(), ReceiveOptions{Addr: addr, Dir: dest})
+	if !errors.Is(err, lnkerrors.TransferIncomplete) {
+		t.Fatalf("got %v, want %v", err, lnkerrors.TransferIncomplete)
+	}
+
+	// The entries after the unreadable one still arrive
+	for _, name := range []string{"a.txt", "z.txt"} {
+		got, err := os.ReadFile(filepath.Join(dest, "dir", name))
+		if err != nil || string(got) != name {
+			t.Errorf("%s: got %q, %v", name, got, err)
+		}
+	}
+
+	failed := received.Failed()
+	if len(failed) != 1 || failed[0].Name != filepath.Join("dir", "broken") || !errors.Is(failed[0].Err, ErrFilesystem) {
+		t.Errorf("expected the receiver to know that the sender couldn't read dir/broken, got %+v", received.Files)
+	}
+
+	if err := <-errs; !errors.Is(err, lnkerrors.TransferIncomplete) {
+		t.Errorf("got %v, want %v", err, lnkerrors.TransferIncomplete)
+	}
+}
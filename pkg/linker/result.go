@@ -0,0 +1,125 @@
+package linker
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	lnkerrors "github.com/LxrdShadow/linker/internal/errors"
+	"github.com/LxrdShadow/linker/pkg/event"
+)
+
+// Outcome of a file of a session
+type FileResult struct {
+	Name     string
+	Bytes    uint64
+	SHA256   string // Of the data transferred, empty when the file failed
+	Duration time.Duration
+	Err      error // Why the file failed, nil when it was transferred
+}
+
+// Outcome of a session with a peer
+type SessionResult struct {
+	Peer     string
+	Session  string // Identifier of the session, as in the events
+	Files    []FileResult
+	Bytes    uint64 // Of the files transferred, without the ones failed by the receipt
+	Duration time.Duration
+	Err      error // Why the session stopped before the end, nil when it completed
+}
+
+// Failed files of the session
+func (sr *SessionResult) Failed() []FileResult {
+	var failed []FileResult
+	for _, file := range sr.Files {
+		if file.Err != nil {
+			failed = append(failed, file)
+		}
+	}
+
+	return failed
+}
+
+// Builds the results from the events of the sessions, before passing them on
+type collector struct {
+	mu       sync.Mutex
+	outcomes []*event.Outcome // In the order the sessions started
+	byID     map[string]*event.Outcome
+	onEvent  func(event.Event)
+}
+
+func newCollector(onEvent func(event.Event)) *collector {
+	return &collector{
+		byID:    make(map[string]*event.Outcome),
+		onEvent: onEvent,
+	}
+}
+
+func (c *collector) Emit(ev event.Event) {
+	c.mu.Lock()
+	c.record(ev)
+	c.mu.Unlock()
+
+	if c.onEvent != nil {
+		c.onEvent(ev)
+	}
+}
+
+// Update the outcome of the session of an event, mu has to be held
+func (c *collector) record(ev event.Event) {
+	outcome, ok := c.byID[ev.Session]
+	if !ok {
+		outcome = event.NewOutcome(ev)
+		c.byID[ev.Session] = outcome
+		c.outcomes = append(c.outcomes, outcome)
+	}
+
+	outcome.Add(ev)
+}
+
+// Results of the sessions, in the order they started
+func (c *collector) sessions() []SessionResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sessions := make([]SessionResult, len(c.outcomes))
+	for i, outcome := range c.outcomes {
+		sessions[i] = newSessionResult(outcome)
+	}
+
+	return sessions
+}
+
+func newSessionResult(outcome *event.Outcome) SessionResult {
+	result := SessionResult{
+		Peer:     outcome.Peer,
+		Session:  outcome.Session,
+		Bytes:    outcome.Bytes,
+		Duration: seconds(outcome.Duration),
+		Err:      eventError(outcome.Error, outcome.ErrorKind),
+	}
+	for _, file := range outcome.Files {
+		result.Files = append(result.Files, FileResult{
+			Name:     file.Name,
+			Bytes:    file.Bytes,
+			SHA256:   file.Hash,
+			Duration: seconds(file.Duration),
+			Err:      eventError(file.Error, file.ErrorKind),
+		})
+	}
+
+	return result
+}
+
+// Rebuild an error from its event, with its kind. nil without a message
+func eventError(message, kind string) error {
+	if message == "" {
+		return nil
+	}
+
+	return lnkerrors.Wrap(lnkerrors.ParseKind(kind), errors.New(message))
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
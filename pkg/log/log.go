@@ -2,50 +2,296 @@ package log
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/LxrdShadow/linker/pkg/color"
 )
 
+type Level int
+
+const (
+	DEBUG Level = iota
+	INFO
+	WARNING
+	ERROR
+)
+
+var levelNames = map[Level]string{
+	DEBUG:   "DEBUG",
+	INFO:    "INFO",
+	WARNING: "WARNING",
+	ERROR:   "ERROR",
+}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// Prefix of each kind of message, colored when it is printed
+type prefix struct {
+	text  string
+	color int
+}
+
 var (
-	errorPrefix   = color.Sprint(color.RED, "[ERROR]: ")
-	warningPrefix = color.Sprint(color.YELLOW, "[WARNING]: ")
-	infoPrefix    = color.Sprint(color.BLUE, "[INFO]: ")
-	successPrefix = color.Sprint(color.GREEN, "[SUCCESS]: ")
+	errorPrefix   = prefix{"[ERROR]: ", color.RED}
+	warningPrefix = prefix{"[WARNING]: ", color.YELLOW}
+	infoPrefix    = prefix{"[INFO]: ", color.BLUE}
+	successPrefix = prefix{"[SUCCESS]: ", color.GREEN}
+	debugPrefix   = prefix{"[DEBUG]: ", color.PINK}
 )
 
-func Error(msg any) {
-	fmt.Fprint(os.Stderr, errorPrefix, msg)
+var (
+	mu sync.Mutex
+
+	// Destination of the non-error messages
+	output io.Writer = os.Stdout
+
+	// Destination of the errors
+	errorOutput io.Writer = os.Stderr
+
+	// Optional copy of every message, without colors and with a timestamp
+	logFile io.Writer
+
+	// Messages below this level are dropped
+	threshold = INFO
+)
+
+// Set the destination of the non-error messages (stdout by default)
+func SetOutput(w io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	output = w
+}
+
+// Set the destination of the errors (stderr by default)
+func SetErrorOutput(w io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	errorOutput = w
+}
+
+// Get the destination of the non-error messages, it discards everything in quiet mode
+func Writer() io.Writer {
+	return root.Writer()
+}
+
+// Drop the messages below the given level
+func SetLevel(level Level) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	threshold = level
+}
+
+// Check if the messages of a level are printed, to avoid building expensive ones
+func Enabled(level Level) bool {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return level >= threshold
+}
+
+// Also write every message to a file
+func SetLogFile(w io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	logFile = w
+}
+
+// Key-value pair added at the end of a message
+type Field struct {
+	Key   string
+	Value any
+}
+
+// Logs messages with a set of fields (peer address, file, session id...)
+type Logger struct {
+	fields []Field
+
+	// Destinations of the messages, nil for the ones of the package
+	output, errorOutput io.Writer
+}
+
+var root = &Logger{}
+
+// Create a logger writing to its own destinations instead of the ones of the package,
+// io.Discard silences it
+func New(output, errorOutput io.Writer) *Logger {
+	return &Logger{output: output, errorOutput: errorOutput}
+}
+
+// Get the logger used by the functions of the package
+func Default() *Logger {
+	return root
+}
+
+// Create a logger adding the given key-value pairs to every message
+func With(keyValues ...any) *Logger {
+	return root.With(keyValues...)
+}
+
+// Create a logger with more key-value pairs
+func (l *Logger) With(keyValues ...any) *Logger {
+	fields := make([]Field, len(l.fields), len(l.fields)+len(keyValues)/2)
+	copy(fields, l.fields)
+
+	for i := 0; i+1 < len(keyValues); i += 2 {
+		fields = append(fields, Field{Key: fmt.Sprint(keyValues[i]), Value: keyValues[i+1]})
+	}
+
+	return &Logger{fields: fields, output: l.output, errorOutput: l.errorOutput}
+}
+
+// Get the destination of the non-error messages, it discards everything in quiet mode
+func (l *Logger) Writer() io.Writer {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if threshold > INFO {
+		return io.Discard
+	}
+
+	return l.destination(INFO)
+}
+
+// Get the destination of a message, mu has to be held
+func (l *Logger) destination(level Level) io.Writer {
+	if level == ERROR {
+		if l.errorOutput != nil {
+			return l.errorOutput
+		}
+		return errorOutput
+	}
+
+	if l.output != nil {
+		return l.output
+	}
+	return output
+}
+
+func (l *Logger) write(level Level, prefix prefix, msg string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if level < threshold {
+		return
+	}
+
+	msg = strings.TrimRight(msg, "\n")
+	fields := l.formatFields()
+
+	w := l.destination(level)
+	// The colors are decided at runtime, they may have been disabled after the start
+	coloredPrefix := color.Sprint(prefix.color, prefix.text)
+	if fields != "" {
+		fmt.Fprintf(w, "%s%s%s\n", coloredPrefix, msg, color.Sprint(color.GRAY, fields))
+	} else {
+		fmt.Fprintf(w, "%s%s\n", coloredPrefix, msg)
+	}
+
+	if logFile != nil {
+		fmt.Fprintf(logFile, "%s %-7s %s%s\n", time.Now().UTC().Format(time.RFC3339), level, msg, fields)
+	}
+}
+
+func (l *Logger) formatFields() string {
+	var builder strings.Builder
+
+	for _, field := range l.fields {
+		value := fmt.Sprint(field.Value)
+		if value == "" || strings.ContainsAny(value, " \t\"=") {
+			value = fmt.Sprintf("%q", value)
+		}
+		fmt.Fprintf(&builder, " %s=%s", field.Key, value)
+	}
+
+	return builder.String()
+}
+
+func (l *Logger) Debug(msg ...any) {
+	l.write(DEBUG, debugPrefix, fmt.Sprint(msg...))
+}
+
+func (l *Logger) Debugf(format string, a ...any) {
+	l.write(DEBUG, debugPrefix, fmt.Sprintf(format, a...))
+}
+
+func (l *Logger) Info(msg ...any) {
+	l.write(INFO, infoPrefix, fmt.Sprint(msg...))
+}
+
+func (l *Logger) Infof(format string, a ...any) {
+	l.write(INFO, infoPrefix, fmt.Sprintf(format, a...))
+}
+
+func (l *Logger) Success(msg ...any) {
+	l.write(INFO, successPrefix, fmt.Sprint(msg...))
+}
+
+func (l *Logger) Successf(format string, a ...any) {
+	l.write(INFO, successPrefix, fmt.Sprintf(format, a...))
+}
+
+func (l *Logger) Warning(msg ...any) {
+	l.write(WARNING, warningPrefix, fmt.Sprint(msg...))
+}
+
+func (l *Logger) Warningf(format string, a ...any) {
+	l.write(WARNING, warningPrefix, fmt.Sprintf(format, a...))
+}
+
+func (l *Logger) Error(msg ...any) {
+	l.write(ERROR, errorPrefix, fmt.Sprint(msg...))
+}
+
+func (l *Logger) Errorf(format string, a ...any) {
+	l.write(ERROR, errorPrefix, fmt.Sprintf(format, a...))
+}
+
+func Debug(msg ...any) {
+	root.Debug(msg...)
+}
+
+func Debugf(format string, a ...any) {
+	root.Debugf(format, a...)
+}
+
+func Error(msg ...any) {
+	root.Error(msg...)
 }
 
-func Errorf(format string, msg any) {
-	fmt.Fprint(os.Stderr, errorPrefix)
-	fmt.Fprintf(os.Stderr, format, msg)
+func Errorf(format string, a ...any) {
+	root.Errorf(format, a...)
 }
 
-func Warning(msg any) {
-	fmt.Print(warningPrefix, msg)
+func Warning(msg ...any) {
+	root.Warning(msg...)
 }
 
-func Warningf(format string, msg any) {
-	fmt.Print(warningPrefix)
-	fmt.Printf(format, msg)
+func Warningf(format string, a ...any) {
+	root.Warningf(format, a...)
 }
 
-func Info(msg any) {
-	fmt.Print(infoPrefix, msg)
+func Info(msg ...any) {
+	root.Info(msg...)
 }
 
-func Infof(format string, msg any) {
-	fmt.Print(infoPrefix)
-	fmt.Printf(format, msg)
+func Infof(format string, a ...any) {
+	root.Infof(format, a...)
 }
 
-func Success(msg any) {
-	fmt.Print(successPrefix, msg)
+func Success(msg ...any) {
+	root.Success(msg...)
 }
 
-func Successf(format string, msg any) {
-	fmt.Print(successPrefix)
-	fmt.Printf(format, msg)
+func Successf(format string, a ...any) {
+	root.Successf(format, a...)
 }
@@ -0,0 +1,63 @@
+package log
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	out := new(bytes.Buffer)
+	file := new(bytes.Buffer)
+	SetOutput(out)
+	SetLogFile(file)
+	defer SetOutput(os.Stdout)
+	defer SetLogFile(nil)
+	defer SetLevel(INFO)
+
+	t.Run("drops the messages below the level", func(t *testing.T) {
+		out.Reset()
+		SetLevel(WARNING)
+
+		Info("hidden\n")
+		Warningf("shown %d %s\n", 1, "time")
+
+		if strings.Contains(out.String(), "hidden") {
+			t.Errorf("info message printed at warning level: %q", out.String())
+		}
+
+		if !strings.Contains(out.String(), "shown 1 time") {
+			t.Errorf("warning message missing: %q", out.String())
+		}
+	})
+
+	t.Run("adds the fields at the end of the line", func(t *testing.T) {
+		file.Reset()
+		SetLevel(DEBUG)
+
+		With("peer", "127.0.0.1:9090").With("file", "my file.txt").Debugf("sent %s\n", "header")
+
+		got := file.String()
+		want := `DEBUG   sent header peer=127.0.0.1:9090 file="my file.txt"` + "\n"
+		if !strings.HasSuffix(got, want) {
+			t.Errorf("log file mismatch: got %q want suffix %q", got, want)
+		}
+	})
+	t.Run("loggers with their own destinations", func(t *testing.T) {
+		out.Reset()
+		SetLevel(INFO)
+		own, ownErrors := new(bytes.Buffer), new(bytes.Buffer)
+
+		logger := New(own, ownErrors).With("session", "1")
+		logger.Info("mine\n")
+		logger.Error("failed\n")
+
+		if out.Len() != 0 {
+			t.Errorf("message written to the package output: %q", out.String())
+		}
+		if !strings.Contains(own.String(), "mine") || !strings.Contains(ownErrors.String(), "failed") {
+			t.Errorf("messages missing: %q and %q", own.String(), ownErrors.String())
+		}
+	})
+}
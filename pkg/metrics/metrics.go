@@ -0,0 +1,289 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/LxrdShadow/linker/pkg/event"
+)
+
+const CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8"
+
+// Upper bounds of the buckets of the chunk round trips, in seconds
+var latencyBuckets = []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics of the transfers of the process, built from their events and served in the
+// Prometheus text format
+type Registry struct {
+	mu    sync.Mutex
+	roles map[string]*roleMetrics
+
+	started  map[string]bool            // Sessions in progress
+	progress map[string]uint64          // Bytes of the current file already counted, by session
+	files    map[string]map[string]bool // Files counted by session, true until counted as failed
+}
+
+// Metrics of one side of the transfers
+type roleMetrics struct {
+	active, sessions  uint64
+	bytes             uint64
+	completed, failed uint64
+	authFailures      uint64
+	errors            map[string]uint64 // By kind
+	latency           histogram
+}
+
+type histogram struct {
+	buckets []uint64 // Observations in each bucket, not cumulated
+	count   uint64
+	sum     float64
+}
+
+// Create the metrics of the given roles, reported at 0 until something happens
+func NewRegistry(roles ...string) *Registry {
+	r := &Registry{
+		roles:    make(map[string]*roleMetrics),
+		started:  make(map[string]bool),
+		progress: make(map[string]uint64),
+		files:    make(map[string]map[string]bool),
+	}
+	for _, role := range roles {
+		r.role(role)
+	}
+
+	return r
+}
+
+// Get the metrics of a role, mu has to be held
+func (r *Registry) role(role string) *roleMetrics {
+	m, ok := r.roles[role]
+	if !ok {
+		m = &roleMetrics{
+			errors:  make(map[string]uint64),
+			latency: histogram{buckets: make([]uint64, len(latencyBuckets)+1)},
+		}
+		r.roles[role] = m
+	}
+
+	return m
+}
+
+func (r *Registry) Emit(ev event.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m := r.role(ev.Role)
+	switch ev.Type {
+	case event.SESSION_START:
+		r.started[ev.Session] = true
+		m.active++
+		m.sessions++
+
+	case event.FILE_START:
+		// A resumed file was partly counted by an earlier session
+		r.progress[ev.Session] = ev.Bytes
+
+	case event.PROGRESS:
+		r.count(m, ev)
+
+	case event.FILE_DONE:
+		r.count(m, ev)
+		delete(r.progress, ev.Session)
+		r.setFile(ev, true)
+		m.completed++
+
+	case event.ERROR:
+		// A file can fail the check of the receipt after being transferred, it stays
+		// in the completed files as a counter never goes down
+		if ev.File != "" {
+			completed, counted := r.files[ev.Session][ev.File]
+			if completed || !counted {
+				m.failed++
+			}
+			r.setFile(ev, false)
+		}
+		m.errors[ev.ErrorKind]++
+		if ev.ErrorKind == "auth" {
+			m.authFailures++
+		}
+
+	case event.SUMMARY:
+		if r.started[ev.Session] {
+			m.active--
+		}
+		delete(r.started, ev.Session)
+		delete(r.progress, ev.Session)
+		delete(r.files, ev.Session)
+	}
+}
+
+// Remember how the file of an event was counted in its session, mu has to be held
+func (r *Registry) setFile(ev event.Event, completed bool) {
+	files, ok := r.files[ev.Session]
+	if !ok {
+		files = make(map[string]bool)
+		r.files[ev.Session] = files
+	}
+	files[ev.File] = completed
+}
+
+// Count the bytes of the current file transferred since the last event about it, mu has to be held
+func (r *Registry) count(m *roleMetrics, ev event.Event) {
+	if ev.Bytes > r.progress[ev.Session] {
+		m.bytes += ev.Bytes - r.progress[ev.Session]
+		r.progress[ev.Session] = ev.Bytes
+	}
+}
+
+// Count a receiver turned away by the sender
+func (r *Registry) Reject(peer string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.role(event.SENDER).authFailures++
+}
+
+// Get a function recording the round trips of the chunks of a role
+func (r *Registry) ObserveChunk(role string) func(time.Duration) {
+	return func(rtt time.Duration) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		h := &r.role(role).latency
+		seconds := rtt.Seconds()
+		i, _ := slices.BinarySearch(latencyBuckets, seconds)
+		h.buckets[i]++
+		h.count++
+		h.sum += seconds
+	}
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", CONTENT_TYPE)
+	r.Write(w)
+}
+
+// Serve the metrics on /metrics in the background, an address that can't be listened on fails right away
+func (r *Registry) Serve(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to serve the metrics: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", r)
+	go http.Serve(listener, mux)
+
+	return nil
+}
+
+// Write the metrics in the Prometheus text format
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p := &printer{w: w}
+	roles := slices.Sorted(maps.Keys(r.roles))
+	each := func(value func(*roleMetrics) uint64) {
+		for _, role := range roles {
+			p.sample("", value(r.roles[role]), "role", role)
+		}
+	}
+
+	p.header("lnkr_active_connections", "gauge", "Sessions in progress")
+	each(func(m *roleMetrics) uint64 { return m.active })
+
+	p.header("lnkr_sessions_total", "counter", "Sessions started")
+	each(func(m *roleMetrics) uint64 { return m.sessions })
+
+	for _, side := range []struct{ role, name, help string }{
+		{event.SENDER, "lnkr_bytes_sent_total", "Bytes of file data sent"},
+		{event.RECEIVER, "lnkr_bytes_received_total", "Bytes of file data received"},
+	} {
+		if m, ok := r.roles[side.role]; ok {
+			p.header(side.name, "counter", side.help)
+			p.sample("", m.bytes, "role", side.role)
+		}
+	}
+
+	p.header("lnkr_files_completed_total", "counter", "Files transferred entirely")
+	each(func(m *roleMetrics) uint64 { return m.completed })
+
+	p.header("lnkr_files_failed_total", "counter", "Files that failed or were skipped, including the ones transferred that failed the check of the receipt")
+	each(func(m *roleMetrics) uint64 { return m.failed })
+
+	p.header("lnkr_auth_failures_total", "counter", "Receivers turned away by the sender, or shares found closed by the receiver")
+	each(func(m *roleMetrics) uint64 { return m.authFailures })
+
+	p.header("lnkr_errors_total", "counter", "Errors by kind, as in the error_kind of the JSON events")
+	for _, role := range roles {
+		errors := r.roles[role].errors
+		for _, kind := range slices.Sorted(maps.Keys(errors)) {
+			p.sample("", errors[kind], "role", role, "kind", kind)
+		}
+	}
+
+	p.header("lnkr_chunk_latency_seconds", "histogram", "Round trips of the chunks, from the sending of a chunk to its acknowledgment on the sender, and from the acknowledgment of a chunk to the arrival of the next one on the receiver")
+	for _, role := range roles {
+		h := r.roles[role].latency
+		cumulated := uint64(0)
+		for i, count := range h.buckets {
+			cumulated += count
+			bound := "+Inf"
+			if i < len(latencyBuckets) {
+				bound = strconv.FormatFloat(latencyBuckets[i], 'g', -1, 64)
+			}
+			p.sample("_bucket", cumulated, "role", role, "le", bound)
+		}
+		p.line("lnkr_chunk_latency_seconds_sum", strconv.FormatFloat(h.sum, 'g', -1, 64), "role", role)
+		p.sample("_count", h.count, "role", role)
+	}
+
+	return p.err
+}
+
+// Writes the lines of the text format, keeping the first error
+type printer struct {
+	w    io.Writer
+	name string // Of the metric being written
+	err  error
+}
+
+func (p *printer) header(name, kind, help string) {
+	p.name = name
+	p.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// Write a sample of the current metric, the suffix is added to its name
+func (p *printer) sample(suffix string, value uint64, labels ...string) {
+	p.line(p.name+suffix, strconv.FormatUint(value, 10), labels...)
+}
+
+// Write a sample, the labels are given as name and value pairs
+func (p *printer) line(name, value string, labels ...string) {
+	if len(labels) > 0 {
+		name += "{"
+		for i := 0; i < len(labels); i += 2 {
+			if i > 0 {
+				name += ","
+			}
+			name += fmt.Sprintf("%s=%s", labels[i], strconv.Quote(labels[i+1]))
+		}
+		name += "}"
+	}
+
+	p.printf("%s %s\n", name, value)
+}
+
+func (p *printer) printf(format string, args ...any) {
+	if p.err == nil {
+		_, p.err = fmt.Fprintf(p.w, format, args...)
+	}
+}
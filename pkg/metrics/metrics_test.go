@@ -0,0 +1,138 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LxrdShadow/linker/pkg/event"
+)
+
+// Get the samples written by the registry, by name and labels
+func samples(t *testing.T, r *Registry) map[string]string {
+	t.Helper()
+
+	var out strings.Builder
+	if err := r.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	values := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, _ := strings.Cut(line, " ")
+		values[name] = value
+	}
+
+	return values
+}
+
+func assertSamples(t *testing.T, r *Registry, want map[string]string) {
+	t.Helper()
+
+	got := samples(t, r)
+	for name, value := range want {
+		if got[name] != value {
+			t.Errorf("%s: got %q, want %q", name, got[name], value)
+		}
+	}
+}
+
+func TestRegistryCountsSessions(t *testing.T) {
+	r := NewRegistry(event.SENDER)
+	assertSamples(t, r, map[string]string{
+		`lnkr_active_connections{role="sender"}`: "0",
+		`lnkr_bytes_sent_total{role="sender"}`:   "0",
+	})
+
+	emit := func(session string, ev event.Event) {
+		ev.Role = event.SENDER
+		ev.Session = session
+		r.Emit(ev)
+	}
+
+	emit("a", event.Event{Type: event.SESSION_START})
+	emit("b", event.Event{Type: event.SESSION_START})
+	emit("a", event.Event{Type: event.FILE_START, File: "big.iso", Size: 1000})
+	emit("a", event.Event{Type: event.PROGRESS, File: "big.iso", Bytes: 400})
+	assertSamples(t, r, map[string]string{
+		`lnkr_active_connections{role="sender"}`: "2",
+		`lnkr_bytes_sent_total{role="sender"}`:   "400",
+	})
+
+	emit("a", event.Event{Type: event.PROGRESS, File: "big.iso", Bytes: 700})
+	emit("a", event.Event{Type: event.FILE_DONE, File: "big.iso", Bytes: 1000})
+	emit("a", event.Event{Type: event.ERROR, File: "secret.txt", ErrorKind: "filesystem"})
+	emit("a", event.Event{Type: event.SUMMARY})
+
+	// A resumed file only counts what is sent again
+	emit("b", event.Event{Type: event.FILE_START, File: "big.iso", Size: 1000, Bytes: 600})
+	emit("b", event.Event{Type: event.FILE_DONE, File: "big.iso", Bytes: 1000})
+
+	// The receiver got a different file, which fails with the receipt
+	emit("b", event.Event{Type: event.ERROR, File: "big.iso", ErrorKind: "integrity"})
+	emit("b", event.Event{Type: event.SUMMARY})
+
+	assertSamples(t, r, map[string]string{
+		`lnkr_active_connections{role="sender"}`:             "0",
+		`lnkr_sessions_total{role="sender"}`:                 "2",
+		`lnkr_bytes_sent_total{role="sender"}`:               "1400",
+		`lnkr_files_completed_total{role="sender"}`:          "2",
+		`lnkr_files_failed_total{role="sender"}`:             "2",
+		`lnkr_errors_total{role="sender",kind="integrity"}`:  "1",
+		`lnkr_errors_total{role="sender",kind="filesystem"}`: "1",
+		`lnkr_auth_failures_total{role="sender"}`:            "0",
+	})
+}
+
+func TestRegistryCountsAuthFailures(t *testing.T) {
+	r := NewRegistry(event.SENDER, event.RECEIVER)
+	r.Reject("192.168.1.12:40000")
+	r.Reject("192.168.1.13:40000")
+
+	// The receiver finds the share closed before its session starts
+	r.Emit(event.Event{Type: event.ERROR, Role: event.RECEIVER, Session: "c", ErrorKind: "auth"})
+
+	assertSamples(t, r, map[string]string{
+		`lnkr_auth_failures_total{role="sender"}`:        "2",
+		`lnkr_auth_failures_total{role="receiver"}`:      "1",
+		`lnkr_errors_total{role="receiver",kind="auth"}`: "1",
+		`lnkr_active_connections{role="receiver"}`:       "0",
+		`lnkr_files_failed_total{role="receiver"}`:       "0",
+		`lnkr_bytes_received_total{role="receiver"}`:     "0",
+	})
+}
+
+func TestChunkLatencyHistogram(t *testing.T) {
+	r := NewRegistry(event.RECEIVER)
+	observe := r.ObserveChunk(event.RECEIVER)
+	for _, rtt := range []time.Duration{50 * time.Microsecond, time.Millisecond, 3 * time.Millisecond, 20 * time.Second} {
+		observe(rtt)
+	}
+
+	assertSamples(t, r, map[string]string{
+		`lnkr_chunk_latency_seconds_bucket{role="receiver",le="0.0001"}`: "1",
+		`lnkr_chunk_latency_seconds_bucket{role="receiver",le="0.001"}`:  "2", // The bounds are included
+		`lnkr_chunk_latency_seconds_bucket{role="receiver",le="0.005"}`:  "3",
+		`lnkr_chunk_latency_seconds_bucket{role="receiver",le="10"}`:     "3",
+		`lnkr_chunk_latency_seconds_bucket{role="receiver",le="+Inf"}`:   "4",
+		`lnkr_chunk_latency_seconds_count{role="receiver"}`:              "4",
+		`lnkr_chunk_latency_seconds_sum{role="receiver"}`:                "20.00405",
+	})
+}
+
+func TestServeHTTP(t *testing.T) {
+	r := NewRegistry(event.SENDER)
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	if content := recorder.Header().Get("Content-Type"); content != CONTENT_TYPE {
+		t.Errorf("got the content type %q, want %q", content, CONTENT_TYPE)
+	}
+	if !strings.Contains(recorder.Body.String(), "# TYPE lnkr_sessions_total counter\n") {
+		t.Errorf("unexpected body:\n%s", recorder.Body.String())
+	}
+}
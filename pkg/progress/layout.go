@@ -0,0 +1,108 @@
+package progress
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/LxrdShadow/linker/pkg/color"
+)
+
+const (
+	BAR_MAX_WIDTH  = 50 // Cells filled by the bar, when the terminal is wide enough
+	BAR_MIN_WIDTH  = 10 // Below that, the bar is dropped
+	NAME_MIN_WIDTH = 12 // The name is shortened down to that before the bar is dropped
+)
+
+// Part of a progress line, with its color on a terminal (0 for none)
+type segment struct {
+	text  string
+	color int
+}
+
+// Lay out a progress line: name, bar and information.
+// On a terminal, the line fits in the width: the bar shrinks first, then the name is shortened.
+// Otherwise, the line has no bar and no padding
+func layout(name string, withBar bool, percent uint8, char rune, info []segment, width int, onTerminal bool) string {
+	infoWidth := segmentsWidth(info)
+
+	// On a very narrow terminal, the last information are dropped
+	for onTerminal && width > 0 && len(info) > 1 && infoWidth > width-1 {
+		info = info[:len(info)-1]
+		infoWidth = segmentsWidth(info)
+	}
+
+	barWidth := BAR_MAX_WIDTH
+	if !onTerminal {
+		withBar = false
+	} else if width > 0 {
+		// The last column stays empty, writing to it wraps the line on some terminals
+		room := width - 1 - infoWidth
+		nameWidth := utf8.RuneCountInString(name)
+
+		barWidth = min(BAR_MAX_WIDTH, room-nameWidth-1-3)
+		if withBar && barWidth < BAR_MIN_WIDTH {
+			barWidth = BAR_MIN_WIDTH
+			if room-1-(barWidth+3) < NAME_MIN_WIDTH {
+				withBar = false
+			}
+		}
+
+		if withBar {
+			name = shorten(name, room-1-(barWidth+3))
+		} else {
+			name = shorten(name, room)
+		}
+	}
+
+	var builder strings.Builder
+	builder.WriteString(name)
+
+	if withBar {
+		repr := strings.Repeat(string(char), int(percent)*barWidth/100) + ">"
+		info = append([]segment{{fmt.Sprintf("[%-*s]", barWidth+1, repr), percentColor(percent)}}, info...)
+	}
+
+	for _, s := range info {
+		if builder.Len() > 0 {
+			builder.WriteByte(' ')
+		}
+
+		text := s.text
+		if !onTerminal {
+			text = strings.TrimSpace(text)
+		}
+
+		if s.color != 0 {
+			text = color.Sprint(s.color, text)
+		}
+		builder.WriteString(text)
+	}
+
+	return builder.String()
+}
+
+// Number of characters taken by segments, with the spaces before them
+func segmentsWidth(segments []segment) int {
+	width := 0
+	for _, s := range segments {
+		width += utf8.RuneCountInString(s.text) + 1
+	}
+
+	return width
+}
+
+// Shorten a path to the given number of characters, keeping its end
+func shorten(name string, width int) string {
+	length := utf8.RuneCountInString(name)
+	if length <= width {
+		return name
+	}
+
+	if width <= 1 {
+		return ""
+	}
+
+	runes := []rune(name)
+	return "…" + string(runes[length-width+1:])
+}
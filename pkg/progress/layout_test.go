@@ -0,0 +1,50 @@
+package progress
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/LxrdShadow/linker/pkg/color"
+)
+
+func TestLayout(t *testing.T) {
+	info := []segment{{" 42%", color.YELLOW}, {"  1.00MB/2.00MB", 0}, {"  3.00MB/s", color.GRAY}}
+
+	t.Run("plain line without the bar", func(t *testing.T) {
+		got := layout("dir/file.txt", true, 42, '=', info, 0, false)
+		assertEqual(t, got, "dir/file.txt 42% 1.00MB/2.00MB 3.00MB/s", "line")
+	})
+
+	t.Run("full bar on a wide terminal", func(t *testing.T) {
+		got := layout("file.txt", true, 42, '=', info, 200, true)
+		want := color.Sprint(color.YELLOW, "["+strings.Repeat("=", 21)+">"+strings.Repeat(" ", 29)+"]")
+		if !strings.Contains(got, want) {
+			t.Errorf("expected a bar of %d cells in %q", BAR_MAX_WIDTH, got)
+		}
+	})
+
+	for _, width := range []int{80, 60, 40, 20} {
+		got := stripColors(layout(strings.Repeat("long/path/", 10)+"file.txt", true, 42, '=', info, width, true))
+		if length := utf8.RuneCountInString(got); length >= width {
+			t.Errorf("width %d: the line is %d characters long: %q", width, length, got)
+		}
+	}
+
+	t.Run("shortened name", func(t *testing.T) {
+		assertEqual(t, shorten("a/b/file.txt", 20), "a/b/file.txt", "short name")
+		assertEqual(t, shorten("a/b/file.txt", 9), "…file.txt", "long name")
+		assertEqual(t, shorten("a/b/file.txt", 0), "", "no room")
+	})
+}
+
+func stripColors(s string) string {
+	for {
+		start := strings.Index(s, "\x1b[")
+		if start < 0 {
+			return s
+		}
+		end := strings.IndexByte(s[start:], 'm')
+		s = s[:start] + s[start+end+1:]
+	}
+}
@@ -2,17 +2,91 @@ package progress
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"time"
 
 	"github.com/LxrdShadow/linker/pkg/color"
+	"github.com/LxrdShadow/linker/pkg/term"
+	"github.com/LxrdShadow/linker/pkg/util"
 )
 
+const (
+	RENDER_INTERVAL       = 100 * time.Millisecond // Shortest time between two redraws on a terminal
+	PLAIN_RENDER_INTERVAL = 5 * time.Second        // Time between two progress lines when not on a terminal
+)
+
+// Where a bar is drawn
+type output struct {
+	w        io.Writer
+	terminal *os.File // Same as w when it is a terminal, the bars are printed as plain lines otherwise
+}
+
+func newOutput(w io.Writer) output {
+	out := output{w: w}
+	if f, ok := w.(*os.File); ok && term.IsTerminal(f) {
+		out.terminal = f
+	}
+
+	return out
+}
+
+// Destination of the new progress bars
+var defaultOutput = newOutput(os.Stdout)
+
+// Set the destination of the new progress bars (stdout by default)
+func SetOutput(w io.Writer) {
+	defaultOutput = newOutput(w)
+}
+
+// Get the destination of the new progress bars
+func Output() io.Writer {
+	return defaultOutput.w
+}
+
+// Get the width of the lines, 0 when the output is not a terminal
+func (out output) lineWidth() int {
+	if out.terminal == nil {
+		return 0
+	}
+
+	return term.Width(out.terminal)
+}
+
+// Check if a bar last drawn at the given time can be drawn again, and remember it
+func (out output) due(last *time.Time) bool {
+	interval := RENDER_INTERVAL
+	if out.terminal == nil {
+		interval = PLAIN_RENDER_INTERVAL
+
+		// The first plain line is printed after an interval, short files only print their final line
+		if last.IsZero() {
+			*last = time.Now()
+			return false
+		}
+	}
+
+	if time.Since(*last) < interval {
+		return false
+	}
+	*last = time.Now()
+
+	return true
+}
+
 type ProgressBar struct {
 	current, total, denom uint64
 	percent               uint8
 	char                  rune
-	prefix, repr, unit    string
+	prefix, unit          string
 	start                 time.Time
+	stream                bool
+	out                   output
+	lastRender            time.Time
+
+	// Session bar drawing this bar beneath it, and the bytes already reported to it
+	parent   *SessionBar
+	reported uint64
 }
 
 func NewProgressBar(total uint64, char rune, denominator uint64, prefix, unit string) *ProgressBar {
@@ -23,94 +97,132 @@ func NewProgressBar(total uint64, char rune, denominator uint64, prefix, unit st
 		denom:   denominator,
 		prefix:  prefix,
 		unit:    unit,
-		repr:    "",
 		start:   time.Now(),
+		out:     defaultOutput,
 	}
 
 	return progress
 }
 
+// Create a progress bar for a stream whose total size is unknown
+func NewStreamProgressBar(prefix string) *ProgressBar {
+	progress := &ProgressBar{
+		denom:  1,
+		prefix: prefix,
+		unit:   "B",
+		start:  time.Now(),
+		stream: true,
+		out:    defaultOutput,
+	}
+
+	return progress
+}
+
+// Draw the bar somewhere else than the destination of the package
+func (progress *ProgressBar) SetOutput(w io.Writer) {
+	progress.out = newOutput(w)
+}
+
 func (progress *ProgressBar) NewValueUpdate(current uint64) {
 	progress.current = current
-	progress.update()
+	progress.refresh()
+	progress.draw(false)
 }
 
 func (progress *ProgressBar) AppendUpdate(value uint64) {
 	progress.current += value
-	progress.update()
+	progress.refresh()
+	progress.draw(false)
 }
 
+// Draw the bar, at most every RENDER_INTERVAL on a terminal and every PLAIN_RENDER_INTERVAL otherwise
 func (progress *ProgressBar) Render() {
-	fmt.Printf("\r%s %s %s %s %s", progress.prefix, progress.representation(), progress.percentage(), progress.progress(), progress.speed())
+	progress.draw(false)
 }
 
 func (progress *ProgressBar) Finish() {
-	progress.current = progress.total
-	progress.update()
-	fmt.Println()
-}
-
-func (progress *ProgressBar) update() {
-	if progress.current >= progress.total {
+	if !progress.stream {
 		progress.current = progress.total
 	}
+	progress.refresh()
 
-	progress.percent = progress.getPercentage()
-	progress.repr = progress.getRepresentation()
-	progress.Render()
-}
+	if progress.parent != nil {
+		progress.parent.fileDone(progress)
+		return
+	}
 
-func (progress *ProgressBar) getPercentage() uint8 {
-	return uint8(float64(progress.current) / float64(progress.total) * 100)
+	progress.draw(true)
+	if progress.out.terminal != nil {
+		fmt.Fprintln(progress.out.w)
+	}
 }
 
-func (progress *ProgressBar) getRepresentation() string {
-	repr := ""
-	for range int(progress.percent / 2) {
-		repr += string(progress.char)
+// Draw the bar, the final state is always drawn
+func (progress *ProgressBar) draw(final bool) {
+	if progress.parent != nil {
+		progress.parent.draw(final)
+		return
 	}
-	repr += ">"
 
-	return repr
-}
+	if !final && !progress.out.due(&progress.lastRender) {
+		return
+	}
 
-func (progress *ProgressBar) divideByDenom(value uint64) float32 {
-	return float32(float64(value) / float64(progress.denom))
+	if progress.out.terminal == nil {
+		fmt.Fprintln(progress.out.w, progress.line(0, false))
+		return
+	}
+
+	fmt.Fprintf(progress.out.w, "\r%s\x1b[K", progress.line(progress.out.lineWidth(), true))
 }
 
-func (progress *ProgressBar) percentage() string {
-	var percentColor int
+// Update the values computed from the current one
+func (progress *ProgressBar) refresh() {
+	if !progress.stream && progress.current >= progress.total {
+		progress.current = progress.total
+	}
+
+	if progress.parent != nil && progress.current > progress.reported {
+		progress.parent.add(progress.current-progress.reported, time.Now())
+		progress.reported = progress.current
+	}
 
-	if progress.percent <= 33 {
-		percentColor = color.RED
-	} else if progress.percent <= 66 {
-		percentColor = color.YELLOW
-	} else if progress.percent <= 99 {
-		percentColor = color.CYAN
-	} else {
-		percentColor = color.GREEN
+	if progress.stream {
+		progress.unit, progress.denom = util.ByteDecodeUnit(progress.current)
+		return
 	}
 
-	return color.Sprint(percentColor, fmt.Sprintf("%3d%%", progress.percent))
+	progress.percent = progress.getPercentage()
 }
 
-func (progress *ProgressBar) representation() string {
-	var reprColor int
+func (progress *ProgressBar) getPercentage() uint8 {
+	if progress.total == 0 {
+		return 100
+	}
+
+	return uint8(float64(progress.current) / float64(progress.total) * 100)
+}
 
-	if progress.percent <= 33 {
-		reprColor = color.RED
-	} else if progress.percent <= 66 {
-		reprColor = color.YELLOW
-	} else if progress.percent <= 99 {
-		reprColor = color.CYAN
-	} else {
-		reprColor = color.GREEN
+// Get the line of the bar within the width (0 when unknown), colored for a terminal
+func (progress *ProgressBar) line(width int, colored bool) string {
+	info := []segment{}
+	if !progress.stream {
+		info = append(info, segment{fmt.Sprintf("%3d%%", progress.percent), percentColor(progress.percent)})
 	}
+	info = append(info, segment{progress.progress(), 0}, segment{progress.speed(), color.GRAY})
 
-	return color.Sprint(reprColor, fmt.Sprintf("[%-50s]", progress.repr))
+	return layout(progress.prefix, !progress.stream, progress.percent, progress.char, info, width, colored)
+}
+
+func (progress *ProgressBar) divideByDenom(value uint64) float32 {
+	return float32(float64(value) / float64(progress.denom))
 }
 
 func (progress *ProgressBar) progress() string {
+	if progress.stream {
+		return fmt.Sprintf("%8.2f%s", progress.divideByDenom(progress.current), progress.unit)
+	}
+
 	return fmt.Sprintf("%8.2f%s/%.2f%s", progress.divideByDenom(progress.current), progress.unit, progress.divideByDenom(progress.total), progress.unit)
 }
 
@@ -119,8 +231,12 @@ func (progress *ProgressBar) speed() string {
 	if elapsed == 0 {
 		return fmt.Sprintf("%7.2f%s/s", 0.0, progress.unit)
 	}
-	speed := float32(progress.current) / float32(elapsed)
 
+	return formatSpeed(float64(progress.current) / elapsed)
+}
+
+// Format a speed in bytes per second with the closest unit
+func formatSpeed(speed float64) string {
 	units := []string{"B", "KB", "MB", "GB"}
 	unitIdx := 0
 
@@ -129,5 +245,17 @@ func (progress *ProgressBar) speed() string {
 		unitIdx++
 	}
 
-	return color.Sprintf(color.GRAY, "%7.2f%s/s", speed, units[unitIdx])
+	return fmt.Sprintf("%7.2f%s/s", speed, units[unitIdx])
+}
+
+func percentColor(percent uint8) int {
+	if percent <= 33 {
+		return color.RED
+	} else if percent <= 66 {
+		return color.YELLOW
+	} else if percent <= 99 {
+		return color.CYAN
+	}
+
+	return color.GREEN
 }
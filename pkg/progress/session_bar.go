@@ -0,0 +1,215 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/LxrdShadow/linker/internal/config"
+	"github.com/LxrdShadow/linker/pkg/color"
+	"github.com/LxrdShadow/linker/pkg/util"
+)
+
+const (
+	SPEED_SAMPLE_INTERVAL = 500 * time.Millisecond // Shortest time between two samples of the speed
+	SPEED_SMOOTHING       = 0.3                    // Weight of the latest sample in the moving average
+)
+
+// Progress of a whole session: files done, overall throughput and time left,
+// with the bar of the current file optionally drawn beneath it
+type SessionBar struct {
+	totalFiles, filesDone uint64
+	bytes                 *ProgressBar
+	skipped               uint64
+
+	// Moving average of the speed in bytes per second
+	speed       float64
+	lastSample  time.Time
+	lastCurrent uint64
+
+	file       *ProgressBar
+	out        output
+	showFiles  bool
+	drawn      bool
+	finished   bool
+	lastRender time.Time
+}
+
+func NewSessionBar(totalFiles, totalBytes uint64, showFiles bool) *SessionBar {
+	var bytes *ProgressBar
+	if totalBytes == config.UNKNOWN_SIZE {
+		bytes = NewStreamProgressBar("")
+	} else {
+		unit, denom := util.ByteDecodeUnit(totalBytes)
+		bytes = NewProgressBar(totalBytes, '=', denom, "", unit)
+	}
+
+	sessionBar := &SessionBar{
+		totalFiles: totalFiles,
+		bytes:      bytes,
+		lastSample: bytes.start,
+		out:        defaultOutput,
+		showFiles:  showFiles,
+	}
+
+	return sessionBar
+}
+
+// Draw the bar somewhere else than the destination of the package, along with the bars of the files
+func (sb *SessionBar) SetOutput(w io.Writer) {
+	sb.out = newOutput(w)
+}
+
+// Draw the bar of a file beneath the session bar until it is finished
+func (sb *SessionBar) StartFile(bar *ProgressBar) {
+	bar.parent = sb
+	sb.file = bar
+	sb.Render()
+}
+
+// Count a file that won't be transferred, so that it doesn't hold back the ETA
+func (sb *SessionBar) SkipFile(size uint64) {
+	sb.filesDone++
+	sb.skipped += size
+	sb.refresh()
+	sb.draw(false)
+}
+
+// Draw the bar, at most every RENDER_INTERVAL on a terminal and every PLAIN_RENDER_INTERVAL otherwise
+func (sb *SessionBar) Render() {
+	sb.draw(false)
+}
+
+// Draw the bar a last time and move past it, only the first call has an effect
+func (sb *SessionBar) Finish() {
+	if sb.finished {
+		return
+	}
+	sb.finished = true
+
+	sb.file = nil
+	sb.draw(true)
+	if sb.out.terminal != nil {
+		fmt.Fprintln(sb.out.w)
+	}
+}
+
+func (sb *SessionBar) fileDone(bar *ProgressBar) {
+	sb.filesDone++
+	sb.file = nil
+
+	// Without a terminal, each file gets a single line when it is done
+	if sb.out.terminal == nil && sb.showFiles {
+		fmt.Fprintln(sb.out.w, bar.line(0, false))
+	}
+	sb.draw(false)
+}
+
+func (sb *SessionBar) draw(final bool) {
+	if !final && !sb.out.due(&sb.lastRender) {
+		return
+	}
+
+	if sb.out.terminal == nil {
+		fmt.Fprintln(sb.out.w, sb.line(0, false))
+		return
+	}
+
+	width := sb.out.lineWidth()
+
+	// Go back to the line of the session bar
+	if sb.drawn && sb.showFiles {
+		fmt.Fprint(sb.out.w, "\x1b[1A")
+	}
+	fmt.Fprintf(sb.out.w, "\r%s\x1b[K", sb.line(width, true))
+
+	if sb.showFiles {
+		fmt.Fprint(sb.out.w, "\n\r")
+		if sb.file != nil {
+			fmt.Fprint(sb.out.w, sb.file.line(width, true))
+		}
+		fmt.Fprint(sb.out.w, "\x1b[K")
+	}
+	sb.drawn = true
+}
+
+// Account for bytes of the current file
+func (sb *SessionBar) add(n uint64, now time.Time) {
+	sb.bytes.current += n
+	sb.refresh()
+
+	elapsed := now.Sub(sb.lastSample)
+	if elapsed < SPEED_SAMPLE_INTERVAL {
+		return
+	}
+
+	sample := float64(sb.bytes.current-sb.lastCurrent) / elapsed.Seconds()
+	if sb.speed == 0 {
+		sb.speed = sample
+	} else {
+		sb.speed = SPEED_SMOOTHING*sample + (1-SPEED_SMOOTHING)*sb.speed
+	}
+
+	sb.lastSample = now
+	sb.lastCurrent = sb.bytes.current
+}
+
+// Update the bar of the bytes, the skipped files count as done
+func (sb *SessionBar) refresh() {
+	bytes := sb.bytes
+	if bytes.stream {
+		bytes.unit, bytes.denom = util.ByteDecodeUnit(bytes.current)
+		return
+	}
+
+	done := min(bytes.current+sb.skipped, bytes.total)
+	if bytes.total == 0 {
+		bytes.percent = 100
+	} else {
+		bytes.percent = uint8(float64(done) / float64(bytes.total) * 100)
+	}
+}
+
+// Estimated time left at the current speed, zero when unknown
+func (sb *SessionBar) eta() time.Duration {
+	if sb.bytes.stream || sb.speed == 0 {
+		return 0
+	}
+
+	done := sb.bytes.current + sb.skipped
+	if done >= sb.bytes.total {
+		return 0
+	}
+
+	return time.Duration(float64(sb.bytes.total-done) / sb.speed * float64(time.Second))
+}
+
+// Get the line of the bar within the width (0 when unknown), colored for a terminal
+func (sb *SessionBar) line(width int, colored bool) string {
+	files := fmt.Sprintf("[%d/%d files]", sb.filesDone, sb.totalFiles)
+
+	// The average speed is shown until the first sample
+	speed := formatSpeed(sb.speed)
+	if sb.speed == 0 {
+		speed = sb.bytes.speed()
+	}
+
+	if sb.bytes.stream {
+		info := []segment{{sb.bytes.progress(), 0}, {speed, color.GRAY}}
+		return layout(files, false, 0, '=', info, width, colored)
+	}
+
+	eta := "--"
+	if left := sb.eta(); left > 0 {
+		eta = left.Round(time.Second).String()
+	}
+
+	info := []segment{
+		{fmt.Sprintf("%3d%%", sb.bytes.percent), percentColor(sb.bytes.percent)},
+		{sb.bytes.progress(), 0},
+		{speed, color.GRAY},
+		{"ETA " + eta, color.GRAY},
+	}
+
+	return layout(files, true, sb.bytes.percent, '=', info, width, colored)
+}
@@ -0,0 +1,57 @@
+package progress
+
+import (
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/LxrdShadow/linker/internal/config"
+)
+
+func TestSessionBar(t *testing.T) {
+	SetOutput(io.Discard)
+	defer SetOutput(os.Stdout)
+
+	t.Run("files and bytes of the session", func(t *testing.T) {
+		bar := NewSessionBar(3, 3000, true)
+
+		file := NewProgressBar(1000, '=', 1, "a", "B")
+		bar.StartFile(file)
+		file.AppendUpdate(400)
+		assertEqual(t, bar.bytes.current, uint64(400), "bytes")
+		assertEqual(t, bar.bytes.percent, uint8(13), "percentage")
+
+		file.Finish()
+		assertEqual(t, bar.bytes.current, uint64(1000), "bytes")
+		assertEqual(t, bar.filesDone, uint64(1), "files done")
+
+		bar.SkipFile(1000)
+		assertEqual(t, bar.filesDone, uint64(2), "files done")
+		assertEqual(t, bar.bytes.percent, uint8(66), "percentage")
+	})
+
+	t.Run("moving average of the speed", func(t *testing.T) {
+		bar := NewSessionBar(1, 10000, false)
+		start := bar.lastSample
+
+		bar.add(1000, start.Add(100*time.Millisecond))
+		assertEqual(t, bar.speed, 0.0, "speed before the first sample")
+		assertEqual(t, bar.eta(), time.Duration(0), "unknown ETA")
+
+		bar.add(1000, start.Add(time.Second))
+		assertEqual(t, bar.speed, 2000.0, "first sample")
+
+		bar.add(3000, start.Add(2*time.Second))
+		assertEqual(t, bar.speed, SPEED_SMOOTHING*3000+(1-SPEED_SMOOTHING)*2000, "smoothed speed")
+		assertEqual(t, bar.eta(), time.Duration(5000/bar.speed*float64(time.Second)), "ETA")
+	})
+
+	t.Run("unknown total size", func(t *testing.T) {
+		bar := NewSessionBar(2, config.UNKNOWN_SIZE, false)
+		bar.add(5000, bar.lastSample.Add(time.Second))
+
+		assertEqual(t, bar.bytes.stream, true, "stream")
+		assertEqual(t, bar.eta(), time.Duration(0), "unknown ETA")
+	})
+}
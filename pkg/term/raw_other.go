@@ -0,0 +1,28 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package term
+
+import (
+	"errors"
+	"os"
+)
+
+type State struct{}
+
+// A character device is the closest to a terminal without its settings, /dev/null is one too
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+func MakeRaw(f *os.File) (*State, error) {
+	return nil, errors.New("the raw mode is not supported on this platform")
+}
+
+func Restore(f *os.File, state *State) error {
+	return nil
+}
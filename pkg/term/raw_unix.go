@@ -0,0 +1,59 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package term
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// Settings of a terminal, to restore them after using the raw mode
+type State struct {
+	termios syscall.Termios
+}
+
+// Put the terminal in raw mode: no echo, no line buffering and no signals on Ctrl-C,
+// every key is read as soon as it is pressed. The output is not processed either, lines end with "\r\n"
+func MakeRaw(f *os.File) (*State, error) {
+	var termios syscall.Termios
+	if err := ioctlTermios(f, getTermios, &termios); err != nil {
+		return nil, err
+	}
+	state := &State{termios: termios}
+
+	// Same as cfmakeraw(3)
+	termios.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	termios.Oflag &^= syscall.OPOST
+	termios.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	termios.Cflag &^= syscall.CSIZE | syscall.PARENB
+	termios.Cflag |= syscall.CS8
+	termios.Cc[syscall.VMIN] = 1
+	termios.Cc[syscall.VTIME] = 0
+
+	if err := ioctlTermios(f, setTermios, &termios); err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// Put back the settings saved by MakeRaw
+func Restore(f *os.File, state *State) error {
+	return ioctlTermios(f, setTermios, &state.termios)
+}
+
+// Only a terminal has settings to get
+func isTerminal(f *os.File) bool {
+	var termios syscall.Termios
+	return ioctlTermios(f, getTermios, &termios) == nil
+}
+
+func ioctlTermios(f *os.File, request uintptr, termios *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), request, uintptr(unsafe.Pointer(termios)))
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
@@ -0,0 +1,32 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package term
+
+import (
+	"os"
+	"testing"
+)
+
+func TestIsTerminalRejectsOtherDevices(t *testing.T) {
+	null, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer null.Close()
+
+	// A character device, without the settings of a terminal
+	if IsTerminal(null) {
+		t.Errorf("%s is not a terminal", os.DevNull)
+	}
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	defer writer.Close()
+
+	if IsTerminal(reader) {
+		t.Error("a pipe is not a terminal")
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package term
+
+import (
+	"errors"
+	"os"
+)
+
+func getSize(f *os.File) (int, int, error) {
+	return 0, 0, errors.New("the terminal size is not supported on this platform")
+}
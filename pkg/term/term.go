@@ -0,0 +1,42 @@
+package term
+
+import (
+	"os"
+	"strconv"
+)
+
+// Size used when the size of the terminal can't be known
+const (
+	DEFAULT_WIDTH  = 80
+	DEFAULT_HEIGHT = 24
+)
+
+// Check if the file is a terminal (and not a pipe, a regular file or another device like /dev/null)
+func IsTerminal(f *os.File) bool {
+	return isTerminal(f)
+}
+
+// Get the number of columns of the terminal, $COLUMNS or DEFAULT_WIDTH when it can't be asked
+func Width(f *os.File) int {
+	width, _ := Size(f)
+	return width
+}
+
+// Get the number of columns and rows of the terminal,
+// $COLUMNS and $LINES or the default size when it can't be asked
+func Size(f *os.File) (int, int) {
+	width, height, err := getSize(f)
+	if err == nil && width > 0 && height > 0 {
+		return width, height
+	}
+
+	return envSize("COLUMNS", DEFAULT_WIDTH), envSize("LINES", DEFAULT_HEIGHT)
+}
+
+func envSize(name string, fallback int) int {
+	if size, err := strconv.Atoi(os.Getenv(name)); err == nil && size > 0 {
+		return size
+	}
+
+	return fallback
+}
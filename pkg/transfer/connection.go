@@ -1,5 +1,235 @@
 package transfer
 
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/LxrdShadow/linker/internal/config"
+	lnkerrors "github.com/LxrdShadow/linker/internal/errors"
+	"github.com/LxrdShadow/linker/internal/protocol"
+	"github.com/LxrdShadow/linker/pkg/event"
+	"github.com/LxrdShadow/linker/pkg/fault"
+	"github.com/LxrdShadow/linker/pkg/log"
+)
+
 type Connection struct {
 	Host, Port, Network, Addr string
+
+	// Longest wait for the peer while the session is set up and once the transfer started,
+	// 0 waits forever
+	HandshakeTimeout, IdleTimeout time.Duration
+
+	// Interval of the TCP keepalive probes, 0 disables them
+	KeepAlive time.Duration
+
+	// Faults injected in every connection, for testing, nil for none
+	Faults *fault.Schedule
+}
+
+// Keepalive setting of the standard library for an interval, where 0 means the default
+func (c *Connection) keepAlive() time.Duration {
+	if c.KeepAlive == 0 {
+		return -1
+	}
+
+	return c.KeepAlive
+}
+
+// A connection along with the settings negotiated at the start of the transfer
+type session struct {
+	net.Conn
+	chunkSize   uint32
+	chunkBuffer []byte
+
+	id     string
+	role   string
+	events event.Sink
+	logger *log.Logger
+	start  time.Time
+
+	// Longest wait for each read or write, 0 waits forever
+	timeout time.Duration
+
+	// When the last chunk was acknowledged, for the round trips of the chunks
+	lastAck time.Time
+
+	// Totals reported in the summary
+	files, failed, bytes uint64
+
+	// Outcome of each file, as listed in the receipt
+	outcomes []protocol.ReceiptEntry
+}
+
+func newSession(conn net.Conn, role string, events event.Sink, logger *log.Logger) *session {
+	id := event.NewSessionID()
+
+	return &session{
+		Conn:   conn,
+		id:     id,
+		role:   role,
+		events: events,
+		logger: logger.With("peer", conn.RemoteAddr().String(), "session", id),
+		start:  time.Now(),
+	}
+}
+
+// Change the longest wait for each read or write
+func (s *session) setTimeout(timeout time.Duration) {
+	s.timeout = timeout
+	if timeout == 0 {
+		s.Conn.SetDeadline(time.Time{})
+	}
+}
+
+func (s *session) Read(p []byte) (int, error) {
+	if s.timeout > 0 {
+		s.Conn.SetReadDeadline(time.Now().Add(s.timeout))
+	}
+
+	n, err := s.Conn.Read(p)
+	return n, s.timeoutError(err)
+}
+
+func (s *session) Write(p []byte) (int, error) {
+	if s.timeout > 0 {
+		s.Conn.SetWriteDeadline(time.Now().Add(s.timeout))
+	}
+
+	n, err := s.Conn.Write(p)
+	return n, s.timeoutError(err)
+}
+
+// Explain a deadline that expired
+func (s *session) timeoutError(err error) error {
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return fmt.Errorf("%w: no answer from %s for %s", lnkerrors.Timeout, s.RemoteAddr().String(), s.timeout)
+	}
+
+	return err
+}
+
+// Trace a protocol message at the debug level
+func (s *session) trace(direction string, packet protocol.Packet) {
+	if !log.Enabled(log.DEBUG) {
+		return
+	}
+
+	s.logger.Debugf("%s %s", direction, describePacket(packet))
+}
+
+// Short description of a packet, without its data
+func describePacket(packet protocol.Packet) string {
+	switch p := packet.(type) {
+	case *protocol.TransferHeader:
+		return fmt.Sprintf("transfer header (version %d, status %d, chunk size %d, %d files, %d bytes)", p.Version, p.Status, p.ChunkSize, p.TotalFiles, p.TotalBytes)
+	case *protocol.TransferAck:
+		return fmt.Sprintf("transfer acknowledgment (chunk size %d)", p.ChunkSize)
+	case *protocol.EntryHeader:
+		return fmt.Sprintf("entry header (type %d)", p.Type)
+	case *protocol.FileHeader:
+		return fmt.Sprintf("file header %q (%d bytes, %d chunks of %d bytes)", p.FileName, p.FileSize, p.Reps, p.ChunkSize)
+	case *protocol.FileAck:
+		return fmt.Sprintf("file acknowledgment (status %d, offset %d)", p.Status, p.Offset)
+	case *protocol.SkipHeader:
+		return fmt.Sprintf("skip header %q (%s)", p.FileName, p.Reason)
+	case *protocol.ReceiptEntry:
+		if p.IsEnd() {
+			return "end of receipt"
+		}
+		return fmt.Sprintf("receipt entry %q (status %d, %d bytes)", p.Name, p.Status, p.Bytes)
+	case *protocol.Chunk:
+		if p.IsHeartbeat() {
+			return "heartbeat"
+		}
+		if p.IsFailure() {
+			return fmt.Sprintf("failure chunk (%s)", p.Data)
+		}
+		return fmt.Sprintf("chunk #%d (%d bytes)", p.SequenceNumber, p.DataLength)
+	}
+
+	return fmt.Sprintf("%T", packet)
+}
+
+// Check if an error means that the peer can't be reached anymore
+func connectionLost(err error) bool {
+	return errors.Is(err, net.ErrClosed) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, lnkerrors.Timeout)
+}
+
+// Use the negotiated chunk size for the rest of the session
+func (s *session) setChunkSize(size uint32) {
+	s.chunkSize = size
+	s.chunkBuffer = make([]byte, size)
+}
+
+// Send an event about this session, if anyone listens
+func (s *session) emit(ev event.Event) {
+	if s.events == nil {
+		return
+	}
+
+	ev.Time = time.Now().UTC()
+	ev.Role = s.role
+	ev.Session = s.id
+	ev.Peer = s.RemoteAddr().String()
+
+	s.events.Emit(ev)
+}
+
+// Report the settings of the session once they are negotiated
+func (s *session) started() {
+	s.emit(event.Event{
+		Type:      event.SESSION_START,
+		Version:   config.PROTOCOL_VERSION,
+		ChunkSize: s.chunkSize,
+	})
+}
+
+// Report the totals announced at the start of the session, the size is omitted when unknown
+func (s *session) manifest(entries []string, totalFiles, totalBytes uint64) {
+	ev := event.Event{
+		Type:    event.MANIFEST,
+		Entries: entries,
+		Files:   totalFiles,
+	}
+	if totalBytes != config.UNKNOWN_SIZE {
+		ev.Size = totalBytes
+	}
+
+	s.emit(ev)
+}
+
+// Report an entry that couldn't be transferred
+func (s *session) fail(file string, err error) {
+	if file != "" {
+		status := byte(config.RECEIPT_FAILED)
+		if errors.Is(err, lnkerrors.PathNotRepresentable) {
+			status = config.RECEIPT_SKIPPED
+		}
+		s.outcomes = append(s.outcomes, protocol.ReceiptEntry{Status: status, Name: file, Reason: err.Error()})
+	}
+
+	s.failed++
+	s.emit(event.Event{
+		Type:      event.ERROR,
+		File:      file,
+		Error:     err.Error(),
+		ErrorKind: lnkerrors.KindOf(err).String(),
+	})
+}
+
+// Report the totals of the session
+func (s *session) summary() {
+	s.emit(event.Event{
+		Type:     event.SUMMARY,
+		Files:    s.files,
+		Failed:   s.failed,
+		Bytes:    s.bytes,
+		Duration: time.Since(s.start).Seconds(),
+	})
 }
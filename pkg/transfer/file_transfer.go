@@ -0,0 +1,103 @@
+package transfer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"time"
+
+	"github.com/LxrdShadow/linker/internal/config"
+	"github.com/LxrdShadow/linker/internal/protocol"
+	"github.com/LxrdShadow/linker/pkg/event"
+)
+
+// Shortest time between two progress events of a file
+const PROGRESS_EVENT_INTERVAL = 500 * time.Millisecond
+
+// Keeps track of the bytes and the hash of the file being transferred
+type fileTransfer struct {
+	conn      *session
+	name      string
+	bytes     uint64
+	resumed   uint64 // Transferred during an earlier session
+	hash      hash.Hash
+	start     time.Time
+	lastEvent time.Time
+}
+
+func (s *session) startFile(header *protocol.FileHeader) *fileTransfer {
+	return s.resumeFile(header, sha256.New(), 0)
+}
+
+// Start a file whose first bytes were transferred during an earlier session,
+// the hash already covers them
+func (s *session) resumeFile(header *protocol.FileHeader, hash hash.Hash, bytes uint64) *fileTransfer {
+	ft := &fileTransfer{
+		conn:    s,
+		name:    header.FileName,
+		bytes:   bytes,
+		resumed: bytes,
+		hash:    hash,
+		start:   time.Now(),
+	}
+
+	s.emit(event.Event{
+		Type:   event.FILE_START,
+		File:   header.FileName,
+		Size:   header.FileSize,
+		Bytes:  bytes,
+		Stream: header.IsStream(),
+	})
+
+	return ft
+}
+
+// Account for data that went through the connection
+func (ft *fileTransfer) add(data []byte) {
+	ft.hash.Write(data)
+	ft.bytes += uint64(len(data))
+
+	if time.Since(ft.lastEvent) < PROGRESS_EVENT_INTERVAL {
+		return
+	}
+	ft.lastEvent = time.Now()
+
+	ft.conn.emit(event.Event{
+		Type:  event.PROGRESS,
+		File:  ft.name,
+		Bytes: ft.bytes,
+		Speed: ft.speed(),
+	})
+}
+
+func (ft *fileTransfer) done() {
+	ft.conn.files++
+	ft.conn.bytes += ft.bytes
+
+	entry := protocol.ReceiptEntry{Status: config.RECEIPT_OK, Bytes: ft.bytes, Name: ft.name}
+	copy(entry.Hash[:], ft.hash.Sum(nil))
+	ft.conn.outcomes = append(ft.conn.outcomes, entry)
+
+	ft.conn.emit(event.Event{
+		Type:     event.FILE_DONE,
+		File:     ft.name,
+		Bytes:    ft.bytes,
+		Speed:    ft.speed(),
+		Hash:     ft.sum(),
+		Duration: time.Since(ft.start).Seconds(),
+	})
+}
+
+// SHA-256 of the data transferred so far
+func (ft *fileTransfer) sum() string {
+	return hex.EncodeToString(ft.hash.Sum(nil))
+}
+
+func (ft *fileTransfer) speed() float64 {
+	elapsed := time.Since(ft.start).Seconds()
+	if elapsed == 0 {
+		return 0
+	}
+
+	return float64(ft.bytes-ft.resumed) / elapsed
+}
@@ -0,0 +1,200 @@
+package transfer
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/LxrdShadow/linker/internal/config"
+	lnkerrors "github.com/LxrdShadow/linker/internal/errors"
+	"github.com/LxrdShadow/linker/internal/protocol"
+)
+
+// The files of a share, as listed by its sender before any download
+type Manifest struct {
+	TotalFiles uint64
+	TotalBytes uint64 // UNKNOWN_SIZE when one of the entries is a stream
+	Files      []protocol.ListingEntry
+	Truncated  bool // Only the first files are listed
+}
+
+// Count the files of the entries and their total size, as announced to the receivers
+func (s *Sender) Totals() (uint64, uint64) {
+	return s.countEntries()
+}
+
+// List the manifest to the receivers previewing the share, until the listener is closed.
+// A preview doesn't count as a download and isn't submitted to Approve
+func (s *Sender) ServePreview(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to accept a preview: %w", err)
+		}
+
+		go s.sendPreview(s.Faults.Wrap(conn))
+	}
+}
+
+// Send the transfer header and every file of the manifest, then hang up
+func (s *Sender) sendPreview(netConn net.Conn) {
+	defer netConn.Close()
+
+	conn := newSession(netConn, "", nil, s.logger())
+	conn.setTimeout(s.HandshakeTimeout)
+	writer := bufio.NewWriter(conn)
+
+	write := func(packet protocol.Packet) error {
+		packetBuffer, err := packet.Serialize()
+		if err != nil {
+			return fmt.Errorf("failed to serialize packet: %w", err)
+		}
+		_, err = writer.Write(packetBuffer)
+		return err
+	}
+
+	header := protocol.PrepareClosedTransferHeader()
+	if !s.isClosed() {
+		totalFiles, totalBytes := s.countEntries()
+		header = protocol.PrepareTransferHeader(s.ChunkSize, totalFiles, totalBytes)
+	}
+	if err := write(header); err != nil || header.Status == config.SHARE_CLOSED {
+		writer.Flush()
+		return
+	}
+
+	err := s.walkManifest(func(name string, size uint64) error {
+		return write(&protocol.ListingEntry{Size: size, Name: name})
+	})
+	if err == nil {
+		err = write(protocol.PrepareListingEnd())
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+
+	// A receiver that saw enough hangs up before the end
+	if err != nil && !connectionLost(err) {
+		conn.logger.Debugf("failed to send the preview: %s\n", err.Error())
+	}
+}
+
+// Call fn with the name and the size of every file of the entries, in the order they are sent.
+// The names are the ones given in the file headers, the files that can't be read have a size of 0
+func (s *Sender) walkManifest(fn func(name string, size uint64) error) error {
+	for _, entry := range s.Entries {
+		if entry == config.STDIN_ENTRY {
+			if err := fn(s.StreamName, config.UNKNOWN_SIZE); err != nil {
+				return err
+			}
+			continue
+		}
+
+		info, err := os.Stat(entry)
+		if err != nil || !info.IsDir() {
+			size := uint64(0)
+			if err == nil {
+				size = uint64(info.Size())
+			}
+			if err := fn(filepath.Base(entry), size); err != nil {
+				return err
+			}
+			continue
+		}
+
+		baseDir := filepath.Dir(filepath.Clean(entry))
+		err = filepath.WalkDir(entry, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && d.IsDir() {
+				return nil
+			}
+
+			name := entryName(path, baseDir)
+			if len(name) > config.MAX_FILENAME_LENGTH {
+				// Skipped when sent
+				return nil
+			}
+
+			size := uint64(0)
+			if err == nil {
+				if info, err := d.Info(); err == nil {
+					size = uint64(info.Size())
+				}
+			}
+
+			return fn(name, size)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Get the manifest of the share whose preview is served at addr, listing up to max files
+func (r *Receiver) Preview(ctx context.Context, addr string, max int) (*Manifest, error) {
+	dialer := net.Dialer{Timeout: r.HandshakeTimeout, KeepAlive: r.keepAlive()}
+	netConn, err := dialer.DialContext(ctx, r.Network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the preview: %w", err)
+	}
+	defer netConn.Close()
+	stop := context.AfterFunc(ctx, func() { netConn.Close() })
+	defer stop()
+
+	conn := newSession(r.Faults.Wrap(netConn), "", nil, r.logger())
+	conn.setTimeout(r.HandshakeTimeout)
+	reader := bufio.NewReader(conn)
+
+	headerBuffer := make([]byte, config.TRANSFER_HEADER_SIZE)
+	if _, err := io.ReadFull(reader, headerBuffer); err != nil {
+		return nil, fmt.Errorf("failed to read the preview: %w", err)
+	}
+	header, err := protocol.DeserializeTransferHeader(headerBuffer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid preview: %w", lnkerrors.Wrap(lnkerrors.Protocol, err))
+	}
+	if header.Status == config.SHARE_CLOSED {
+		return nil, fmt.Errorf("%s: %w", addr, lnkerrors.ShareClosed)
+	}
+
+	manifest := &Manifest{TotalFiles: header.TotalFiles, TotalBytes: header.TotalBytes}
+	entryBuffer := make([]byte, config.LISTING_ENTRY_MIN_SIZE+config.MAX_FILENAME_LENGTH)
+	for {
+		if _, err := io.ReadFull(reader, entryBuffer[:config.LISTING_ENTRY_MIN_SIZE]); err != nil {
+			return nil, fmt.Errorf("failed to read the preview: %w", err)
+		}
+
+		size, err := protocol.ListingEntrySize(entryBuffer)
+		if err != nil {
+			return nil, fmt.Errorf("invalid preview: %w", lnkerrors.Wrap(lnkerrors.Protocol, err))
+		}
+		if _, err := io.ReadFull(reader, entryBuffer[config.LISTING_ENTRY_MIN_SIZE:size]); err != nil {
+			return nil, fmt.Errorf("failed to read the preview: %w", err)
+		}
+
+		entry, err := protocol.DeserializeListingEntry(entryBuffer[:size])
+		if err != nil {
+			return nil, fmt.Errorf("invalid preview: %w", lnkerrors.Wrap(lnkerrors.Protocol, err))
+		}
+		if entry.IsEnd() {
+			return manifest, nil
+		}
+
+		// The rest is only counted in the totals
+		if len(manifest.Files) == max {
+			manifest.Truncated = true
+			return manifest, nil
+		}
+		manifest.Files = append(manifest.Files, *entry)
+	}
+}
@@ -1,16 +1,23 @@
 package transfer
 
 import (
+	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/LxrdShadow/linker/internal/config"
+	lnkerrors "github.com/LxrdShadow/linker/internal/errors"
 	"github.com/LxrdShadow/linker/internal/protocol"
+	"github.com/LxrdShadow/linker/pkg/event"
 	"github.com/LxrdShadow/linker/pkg/log"
 	"github.com/LxrdShadow/linker/pkg/progress"
 	"github.com/LxrdShadow/linker/pkg/util"
@@ -19,173 +26,714 @@ import (
 type Receiver struct {
 	*Connection
 	ReceiveDir string
+	Stdout     io.Writer
+	ChunkSize  uint32 // Largest chunk size accepted from the sender
+	Events     event.Sink
+
+	// Draw the bar of the current file beneath the bar of the session
+	FileProgress bool
+
+	// Destination of the progress bars, nil to hide them
+	Progress io.Writer
+
+	// Destination of the messages, the logger of the log package when nil
+	Logger *log.Logger
+
+	// Optional, called with the round trip of each chunk of a file after the first one:
+	// from the acknowledgment of the previous chunk to the arrival of this one
+	OnChunk func(rtt time.Duration)
+
+	// Dial the sender again when the connection is lost, up to Retries times, and resume the transfer.
+	// The delay between two attempts starts at RetryDelay and doubles up to RetryMaxDelay
+	Retries       int
+	RetryDelay    time.Duration
+	RetryMaxDelay time.Duration
+
+	mu       sync.Mutex
+	conn     net.Conn
+	canceled bool
+	stopped  chan struct{} // Closed by Cancel
+
+	// The files of the earlier attempts, by name, to resume them
+	partials map[string]*partialFile
+}
+
+// A file received during an earlier attempt, complete or not
+type partialFile struct {
+	size     uint64
+	path     string // Empty when written to stdout
+	created  bool
+	transfer *fileTransfer
 }
 
 // Creates a new receiver
 func NewReceiver(config *util.FlagConfig) *Receiver {
-	return &Receiver{
+	receiver := &Receiver{
 		Connection: &Connection{
 			Host:    config.Host,
 			Port:    config.Port,
 			Network: config.Network,
 			Addr:    config.Addr,
+
+			HandshakeTimeout: config.HandshakeTimeout,
+			IdleTimeout:      config.IdleTimeout,
+			KeepAlive:        config.KeepAlive,
+			Faults:           config.Faults,
 		},
-		ReceiveDir: config.ReceiveDir,
+		ReceiveDir:    config.ReceiveDir,
+		ChunkSize:     config.ChunkSize,
+		FileProgress:  config.FileProgress,
+		Progress:      progress.Output(),
+		Retries:       config.Retries,
+		RetryDelay:    config.RetryDelay,
+		RetryMaxDelay: config.RetryMaxDelay,
+	}
+
+	if config.Stdout {
+		receiver.Stdout = os.Stdout
 	}
+
+	return receiver
 }
 
 // Connect to a send server
 func (r *Receiver) Connect() error {
-	conn, err := net.Dial(r.Network, r.Addr)
+	return r.ConnectContext(context.Background())
+}
+
+// Same as Connect, the transfer is canceled when the context is
+func (r *Receiver) ConnectContext(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, r.Cancel)
+	defer stop()
+
+	r.partials = make(map[string]*partialFile)
+
+	// The first attempt has to reach the sender, a wrong address is not worth retrying
+	reached := false
+	for attempt := 1; ; attempt++ {
+		started, err := r.connectOnce(ctx)
+		reached = reached || started
+		if err == nil {
+			return nil
+		}
+
+		if !reached || attempt > r.Retries || !r.retryable(ctx, err) {
+			r.removePartialFiles()
+			return err
+		}
+
+		delay := r.retryDelay(attempt)
+		r.logger().Warningf("the transfer was interrupted, retrying in %s (attempt %d of %d): %s\n", delay, attempt, r.Retries, err.Error())
+		if !r.wait(delay) {
+			r.removePartialFiles()
+			return fmt.Errorf("%w", lnkerrors.TransferCanceled)
+		}
+		r.logger().Infof("reconnecting to %s\n", r.Addr)
+	}
+}
+
+// Run one session with the sender, reports if it got past the handshake
+func (r *Receiver) connectOnce(ctx context.Context) (bool, error) {
+	dialer := net.Dialer{Timeout: r.HandshakeTimeout, KeepAlive: r.keepAlive()}
+	netConn, err := dialer.DialContext(ctx, r.Network, r.Addr)
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() && ctx.Err() == nil {
+		return false, fmt.Errorf("Failed to dial the server: %w: no answer from %s for %s", lnkerrors.Timeout, r.Addr, r.HandshakeTimeout)
+	}
 	if err != nil {
-		return fmt.Errorf("Failed to dial the server: %w\n", err)
+		return false, fmt.Errorf("Failed to dial the server: %w", err)
 	}
-	defer conn.Close()
+	defer netConn.Close()
+	netConn = r.Faults.Wrap(netConn)
 
-	transferHeader, err := r.getTransferHeader(conn)
+	if !r.setConn(netConn) {
+		return false, fmt.Errorf("%w", lnkerrors.TransferCanceled)
+	}
+
+	conn := newSession(netConn, event.RECEIVER, r.Events, r.logger())
+	conn.setTimeout(r.HandshakeTimeout)
+
+	header, err := r.getTransferHeader(conn)
 	if err != nil {
-		return err
+		err = r.canceledError(err)
+		conn.fail("", err)
+		return false, err
 	}
+	conn.setTimeout(r.IdleTimeout)
+	conn.started()
+	conn.manifest(nil, header.TotalFiles, header.TotalBytes)
+	defer conn.summary()
+
+	fmt.Fprintln(r.logger().Writer())
+	bar := progress.NewSessionBar(header.TotalFiles, header.TotalBytes, r.FileProgress)
+	bar.SetOutput(r.progressOutput())
+	bar.Render()
+	defer bar.Finish()
+	// Receive the entries one by one until the end of the manifest
+	for {
+		entryHeader, err := r.getEntryHeader(conn)
+		if err != nil {
+			err = r.canceledError(err)
+			conn.fail("", err)
+			return true, err
+		}
 
-	fmt.Println()
-	// Loop over the number of entries sent by the server
-	for i := range transferHeader.Reps {
-		if transferHeader.IsDir[i] {
-			err = r.receiveDirectory(conn, r.ReceiveDir)
-		} else {
-			err = r.receiveSingleFile(conn, r.ReceiveDir)
+		if entryHeader.Type == config.ENTRY_END {
+			break
+		}
+		if entryHeader.Type == config.ENTRY_ABORT {
+			err := fmt.Errorf("%s: %w", r.Addr, lnkerrors.TransferAborted)
+			conn.fail("", err)
+			return true, err
+		}
+		if entryHeader.Type == config.ENTRY_SKIP {
+			if err := r.receiveSkip(conn, bar); err != nil {
+				err = r.canceledError(err)
+				conn.fail("", err)
+				return true, err
+			}
+			continue
 		}
 
+		name, err := r.receiveSingleFile(conn, bar, r.ReceiveDir)
 		if err != nil {
-			log.Errorf("failed to handle request: %v\n", err)
+			err = r.canceledError(err)
+			conn.fail(name, err)
+		}
+		if errors.Is(err, lnkerrors.PathNotRepresentable) || errors.Is(err, lnkerrors.SenderFailed) {
+			// The file was skipped, the stream is still in sync
+			conn.logger.With("file", name).Errorf("failed to handle request: %v\n", err)
 			continue
 		}
+		if err != nil {
+			return true, err
+		}
 	}
 
-	time := time.Now().UTC().Format("Monday, 02-Jan-06 15:04:05 MST")
-	log.Success(time)
-	conn.Write([]byte(time))
+	bar.Finish()
 
-	return nil
+	if err := r.sendReceipt(conn); err != nil {
+		err = r.canceledError(err)
+		conn.fail("", err)
+		return true, err
+	}
+
+	// The files that were skipped are already reported, the session itself went well
+	if conn.failed > 0 {
+		return true, fmt.Errorf("%d file(s) not received: %w", conn.failed, lnkerrors.TransferIncomplete)
+	}
+
+	return true, nil
 }
 
-func (r *Receiver) receiveDirectory(conn net.Conn, receiveDir string) error {
-	header, err := r.getDirHeader(conn)
+// Record an entry the sender couldn't read
+func (r *Receiver) receiveSkip(conn *session, bar *progress.SessionBar) error {
+	header, err := r.getSkipHeader(conn)
 	if err != nil {
 		return err
 	}
 
-	for range header.Reps {
-		err = r.receiveSingleFile(conn, receiveDir)
+	err = fmt.Errorf("%s: %w: %s", header.FileName, lnkerrors.SenderFailed, header.Reason)
+	conn.logger.With("file", header.FileName).Errorf("%s", err.Error())
+	conn.fail(header.FileName, err)
+	bar.SkipFile(header.FileSize)
+
+	return nil
+}
+
+// Tell the sender what became of each file, once the manifest is over. The entries are
+// streamed without acknowledgment, the end of the receipt is marked by an entry of its own
+func (r *Receiver) sendReceipt(conn *session) error {
+	writer := bufio.NewWriter(conn)
+	send := func(entry *protocol.ReceiptEntry) error {
+		packetBuffer, err := entry.Serialize()
 		if err != nil {
+			return fmt.Errorf("failed to serialize the receipt: %w", err)
+		}
+
+		if _, err := writer.Write(packetBuffer); err != nil {
+			return fmt.Errorf("failed to send the receipt: %w", err)
+		}
+		conn.trace("sent", entry)
+
+		return nil
+	}
+
+	for i := range conn.outcomes {
+		if err := send(&conn.outcomes[i]); err != nil {
 			return err
 		}
 	}
+	if err := send(protocol.PrepareReceiptEnd()); err != nil {
+		return err
+	}
+
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed to send the receipt: %w", err)
+	}
+
+	received := conn.files
+	if missed := len(conn.outcomes) - int(received); missed > 0 {
+		conn.logger.Warningf("received %d file(s), %d could not be written\n", received, missed)
+	} else {
+		conn.logger.Successf("received %d file(s)\n", received)
+	}
 
 	return nil
 }
 
-func (r *Receiver) receiveSingleFile(conn net.Conn, receiveDir string) error {
+// Stop the transfer by closing the connection, Connect returns an error
+func (r *Receiver) Cancel() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.canceled {
+		return
+	}
+	r.canceled = true
+	if r.stopped != nil {
+		close(r.stopped)
+	}
+	if r.conn != nil {
+		r.conn.Close()
+	}
+}
+
+// Check if the sender is worth dialing again after an error
+func (r *Receiver) retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, lnkerrors.TransferCanceled) || errors.Is(err, lnkerrors.StreamInterrupted) {
+		return false
+	}
+
+	// The sender may be restarting, or still holding the download of the lost connection
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" || errors.Is(err, lnkerrors.ShareClosed) {
+		return true
+	}
+
+	return connectionLost(err)
+}
+
+// Delay before an attempt, doubled after each one up to RetryMaxDelay
+func (r *Receiver) retryDelay(attempt int) time.Duration {
+	delay := r.RetryDelay
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if r.RetryMaxDelay > 0 && delay >= r.RetryMaxDelay {
+			return r.RetryMaxDelay
+		}
+	}
+
+	return delay
+}
+
+// Wait before the next attempt, returns false if the transfer is canceled meanwhile
+func (r *Receiver) wait(delay time.Duration) bool {
+	r.mu.Lock()
+	if r.stopped == nil {
+		r.stopped = make(chan struct{})
+		if r.canceled {
+			close(r.stopped)
+		}
+	}
+	stopped := r.stopped
+	r.mu.Unlock()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-stopped:
+		return false
+	}
+}
+
+func (r *Receiver) logger() *log.Logger {
+	if r.Logger != nil {
+		return r.Logger
+	}
+
+	return log.Default()
+}
+
+func (r *Receiver) progressOutput() io.Writer {
+	if r.Progress == nil {
+		return io.Discard
+	}
+
+	return r.Progress
+}
+
+// Replace the error of a transfer canceled with Cancel, which is only about the closed connection
+func (r *Receiver) canceledError(err error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.canceled {
+		return fmt.Errorf("%w", lnkerrors.TransferCanceled)
+	}
+
+	return err
+}
+
+// Remember the connection to be able to cancel it, unless it is already canceled
+func (r *Receiver) setConn(conn net.Conn) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.conn = conn
+	return !r.canceled
+}
+
+// Receive a file, returning its name as announced by the sender
+func (r *Receiver) receiveSingleFile(conn *session, bar *progress.SessionBar, receiveDir string) (string, error) {
 	header, err := r.getFileHeader(conn)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	file, err := r.createDestFile(receiveDir, header.FileName)
-	defer file.Close()
+	// Everything received is written one after the other to stdout
+	if r.Stdout != nil {
+		transfer, err := r.resume(conn, header, nil)
+		if err == nil {
+			err = r.receiveFile(conn, bar, r.Stdout, header, transfer, "", false)
+		}
+		return header.FileName, err
+	}
 
-	err = r.receiveFileByChunks(conn, file, header)
+	file, created, err := r.createDestFile(receiveDir, header.FileName)
 	if err != nil {
+		// Consume the chunks of the file to keep in sync with the sender
+		if ackErr := r.acceptFile(conn, 0); ackErr != nil {
+			return header.FileName, ackErr
+		}
+		if skipErr := r.skipFile(conn, header); skipErr != nil {
+			return header.FileName, skipErr
+		}
+		bar.SkipFile(header.FileSize)
+		return header.FileName, err
+	}
+	defer file.Close()
+
+	// The file may have been created by an earlier attempt
+	if partial := r.partials[header.FileName]; partial != nil {
+		created = created || partial.created
+	}
+
+	transfer, err := r.resume(conn, header, file)
+	if err == nil {
+		err = r.receiveFile(conn, bar, file, header, transfer, file.Name(), created)
+	}
+	// Unless it is kept for the next attempt
+	if err != nil && r.partials[header.FileName] == nil {
+		file.Close()
+		r.removePartialFile(conn.logger.With("file", header.FileName), file.Name(), created)
+	}
+
+	return header.FileName, err
+}
+
+// Tell the sender where to start the file from and receive it. A file interrupted by
+// a lost connection is kept to be resumed by the next attempt, unless it is a stream
+func (r *Receiver) receiveFile(conn *session, bar *progress.SessionBar, file io.Writer, header *protocol.FileHeader, transfer *fileTransfer, path string, created bool) error {
+	err := r.acceptFile(conn, transfer.bytes)
+	if err == nil {
+		err = r.receiveFileByChunks(conn, bar, file, header, transfer)
+	}
+
+	if err == nil || connectionLost(err) && !header.IsStream() {
+		r.partials[header.FileName] = &partialFile{size: header.FileSize, path: path, created: created, transfer: transfer}
 		return err
 	}
 
+	delete(r.partials, header.FileName)
+	if header.IsStream() && connectionLost(err) {
+		return fmt.Errorf("%w: %w", lnkerrors.StreamInterrupted, err)
+	}
+
+	return err
+}
+
+// Pick up a file where an earlier attempt left it, or start it over.
+// The file on disk is nil when writing to stdout
+func (r *Receiver) resume(conn *session, header *protocol.FileHeader, file *os.File) (*fileTransfer, error) {
+	partial := r.partials[header.FileName]
+	dataSize := uint64(conn.chunkSize - config.CHUNK_MIN_SIZE)
+
+	// Only whole chunks can be resumed, and the file changed if its size did
+	resumable := partial != nil && !header.IsStream() && partial.size == header.FileSize &&
+		(partial.transfer.bytes%dataSize == 0 || partial.transfer.bytes == header.FileSize)
+
+	if file == nil {
+		if partial != nil && !resumable {
+			// What was written can't be taken back
+			return nil, fmt.Errorf("%s: the file can't be resumed on stdout", header.FileName)
+		}
+	} else {
+		offset := int64(0)
+		if resumable {
+			offset = int64(partial.transfer.bytes)
+		}
+		// Someone else may have changed the file meanwhile
+		if info, err := file.Stat(); err != nil || info.Size() < offset {
+			offset, resumable = 0, false
+		}
+		// The data past the offset is received again, an existing file is overwritten
+		if err := file.Truncate(offset); err != nil {
+			return nil, fmt.Errorf("failed to resume the file: %w", err)
+		}
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("failed to resume the file: %w", err)
+		}
+	}
+
+	if !resumable {
+		return conn.startFile(header), nil
+	}
+
+	if partial.transfer.bytes < header.FileSize {
+		conn.logger.With("file", header.FileName).Infof("resuming at %d of %d bytes\n", partial.transfer.bytes, header.FileSize)
+	}
+
+	return conn.resumeFile(header, partial.transfer.hash, partial.transfer.bytes), nil
+}
+
+// Remove the files left incomplete by the attempts, once no other attempt is coming
+func (r *Receiver) removePartialFiles() {
+	for name, partial := range r.partials {
+		if partial.path != "" && partial.transfer.bytes < partial.size {
+			r.removePartialFile(r.logger().With("file", name), partial.path, partial.created)
+		}
+	}
+	r.partials = nil
+}
+
+// Remove a file whose transfer was interrupted, unless it existed before
+func (r *Receiver) removePartialFile(logger *log.Logger, path string, created bool) {
+	if !created {
+		logger.Warning("the transfer was interrupted, the existing file is partially overwritten\n")
+		return
+	}
+
+	if err := os.Remove(path); err != nil {
+		logger.Errorf("failed to remove the partial file: %s\n", err.Error())
+		return
+	}
+	logger.Info("removed the partial file\n")
+}
+
+// Read the chunks of a file without writing them anywhere
+func (r *Receiver) skipFile(conn *session, header *protocol.FileHeader) error {
+	for i := 0; header.IsStream() || i < int(header.Reps); i++ {
+		chunk, _, err := r.getChunk(conn)
+		if err != nil {
+			return err
+		}
+
+		if chunk.IsHeartbeat() {
+			continue
+		}
+		if chunk.IsFailure() || header.IsStream() && chunk.DataLength == 0 {
+			break
+		}
+	}
+
+	return nil
+}
+
+// Check that the path can be represented on the receiving filesystem
+func checkDestPath(dir, filename string) error {
+	for _, name := range strings.Split(filepath.ToSlash(filename), "/") {
+		if len(name) > config.MAX_NAME_LENGTH {
+			return fmt.Errorf("%s: the name %q is %d bytes long, the limit is %d bytes: %w", filename, name, len(name), config.MAX_NAME_LENGTH, lnkerrors.PathNotRepresentable)
+		}
+	}
+
+	path := filepath.Join(dir, filename)
+	if len(path) >= config.MAX_FILENAME_LENGTH {
+		return fmt.Errorf("%s: the destination path is %d bytes long, the limit is %d bytes: %w", filename, len(path), config.MAX_FILENAME_LENGTH-1, lnkerrors.PathNotRepresentable)
+	}
+
 	return nil
 }
 
-func (r *Receiver) createDestFile(dir, filename string) (*os.File, error) {
+func (r *Receiver) createDestFile(dir, filename string) (*os.File, bool, error) {
+	if err := checkDestPath(dir, filename); err != nil {
+		return nil, false, err
+	}
+
 	path := filepath.Join(dir, filepath.Dir(filename))
 
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		err = os.MkdirAll(path, 0755)
+		if errors.Is(err, syscall.ENAMETOOLONG) {
+			return nil, false, fmt.Errorf("%s: %w: %w", filename, lnkerrors.PathNotRepresentable, err)
+		}
 		if err != nil {
-			return nil, fmt.Errorf("failed to create directory: %w\n", err)
+			return nil, false, fmt.Errorf("failed to create directory: %w", err)
 		}
 	}
 
 	var file *os.File
+	created := false
 	filePath := filepath.Join(path, filepath.Base(filename))
 
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		file, err = os.Create(filePath)
+		if errors.Is(err, syscall.ENAMETOOLONG) {
+			return nil, false, fmt.Errorf("%s: %w: %w", filename, lnkerrors.PathNotRepresentable, err)
+		}
 		if err != nil {
-			return nil, fmt.Errorf("failed to create %s: %w\n", filePath, err)
+			return nil, false, fmt.Errorf("failed to create %s: %w", filePath, err)
 		}
+		created = true
 	} else {
 		file, err = os.OpenFile(filePath, os.O_WRONLY, 0755) // 0755 is the file permission in octal
 		if err != nil {
-			return nil, fmt.Errorf("failed to open file: %w\n", err)
+			return nil, false, fmt.Errorf("failed to open file: %w", err)
 		}
 	}
 
-	return file, nil
+	return file, created, nil
 }
 
-func (r *Receiver) receiveFileByChunks(conn net.Conn, file *os.File, header *protocol.FileHeader) error {
+func (r *Receiver) receiveFileByChunks(conn *session, sessionBar *progress.SessionBar, file io.Writer, header *protocol.FileHeader, transfer *fileTransfer) error {
+	// The first chunk follows the header, not an acknowledgment
+	conn.lastAck = time.Time{}
+
+	if header.IsStream() {
+		return r.receiveStream(conn, sessionBar, file, header, transfer)
+	}
+
 	unit, denom := util.ByteDecodeUnit(header.FileSize)
 
 	bar := progress.NewProgressBar(header.FileSize, '=', denom, header.FileName, unit)
-	bar.Render()
+	sessionBar.StartFile(bar)
+	if transfer.bytes > 0 {
+		bar.AppendUpdate(transfer.bytes)
+	}
 
-	for i := 0; i < int(header.Reps); i++ {
-		chunk, n, err := r.getChunk(conn, header.ChunkSize)
+	for i := int(header.FirstChunk(transfer.bytes)); i < int(header.Reps); i++ {
+		chunk, n, err := r.getChunk(conn)
 		if err != nil {
 			return err
 		}
+		if chunk.IsFailure() {
+			sessionBar.SkipFile(header.FileSize - transfer.bytes)
+			return fmt.Errorf("%w: %s", lnkerrors.SenderFailed, chunk.Data)
+		}
 
 		bar.AppendUpdate(uint64(n))
+		transfer.add(chunk.Data)
 		_, err = file.Write(chunk.Data)
 		if err != nil {
-			return fmt.Errorf("failed to write the data to the file: %w\n", err)
+			return fmt.Errorf("failed to write the data to the file: %w", err)
 		}
 	}
 	bar.Finish()
-	fmt.Println()
+	transfer.done()
 
 	return nil
 }
 
-func (r *Receiver) getTransferHeader(conn net.Conn) (*protocol.TransferHeader, error) {
-	headerBuffer := make([]byte, config.FILE_HEADER_MAX_SIZE)
+// Receive chunks until the empty chunk marking the end of the stream
+func (r *Receiver) receiveStream(conn *session, sessionBar *progress.SessionBar, file io.Writer, header *protocol.FileHeader, transfer *fileTransfer) error {
+	bar := progress.NewStreamProgressBar(header.FileName)
+	sessionBar.StartFile(bar)
 
-	_, err := conn.Read(headerBuffer)
+	for {
+		chunk, _, err := r.getChunk(conn)
+		if err != nil {
+			return err
+		}
+
+		if chunk.IsHeartbeat() {
+			continue
+		}
+		if chunk.IsFailure() {
+			sessionBar.SkipFile(0)
+			return fmt.Errorf("%w: %s", lnkerrors.SenderFailed, chunk.Data)
+		}
+		if chunk.DataLength == 0 {
+			break
+		}
+
+		bar.AppendUpdate(chunk.DataLength)
+		transfer.add(chunk.Data)
+		_, err = file.Write(chunk.Data)
+		if err != nil {
+			return fmt.Errorf("failed to write the data to the file: %w", err)
+		}
+	}
+	bar.Finish()
+	transfer.done()
+
+	return nil
+}
+
+func (r *Receiver) getTransferHeader(conn *session) (*protocol.TransferHeader, error) {
+	headerBuffer := make([]byte, config.TRANSFER_HEADER_SIZE)
+
+	// The sender keeps us waiting with heartbeats, as when it asks the user about us
+	for {
+		if _, err := io.ReadFull(conn, headerBuffer[:1]); err != nil {
+			return nil, fmt.Errorf("failed to read header: %w", err)
+		}
+
+		if headerBuffer[0] != config.HEARTBEAT {
+			break
+		}
+		conn.logger.Debug("received a heartbeat, waiting for the sender")
+	}
+
+	_, err := io.ReadFull(conn, headerBuffer[1:])
 	if err != nil {
-		return nil, fmt.Errorf("failed to read header: %w\n", err)
+		return nil, fmt.Errorf("failed to read header: %w", err)
 	}
 
 	header, err := protocol.DeserializeTransferHeader(headerBuffer)
 	if err != nil {
-		return nil, fmt.Errorf("failed to deserialize header: %w\n", err)
+		return nil, fmt.Errorf("failed to deserialize header: %w", lnkerrors.Wrap(lnkerrors.Protocol, err))
 	}
+	conn.trace("received", header)
 
-	if _, err := conn.Write([]byte{1}); err != nil {
+	if header.Status == config.SHARE_CLOSED {
+		return nil, fmt.Errorf("%s: %w", r.Addr, lnkerrors.ShareClosed)
+	}
+
+	// Never go above the largest chunk size we accept, whatever the sender proposes
+	ack := &protocol.TransferAck{
+		ChunkSize: protocol.NegotiateChunkSize(header.ChunkSize, r.ChunkSize),
+	}
+
+	ackBuffer, err := ack.Serialize()
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize acknowledgment: %w", err)
+	}
+
+	if _, err := conn.Write(ackBuffer); err != nil {
 		return nil, fmt.Errorf("failed to send acknowledgment: %w", err)
 	}
+	conn.trace("sent", ack)
+	conn.setChunkSize(ack.ChunkSize)
 
 	return header, nil
 }
 
-func (r *Receiver) getDirHeader(conn net.Conn) (*protocol.DirHeader, error) {
-	headerBuffer := make([]byte, config.DIR_HEADER_SIZE)
+func (r *Receiver) getEntryHeader(conn *session) (*protocol.EntryHeader, error) {
+	headerBuffer := make([]byte, config.ENTRY_HEADER_SIZE)
 
-	_, err := conn.Read(headerBuffer)
+	_, err := io.ReadFull(conn, headerBuffer)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read header: %w\n", err)
+		return nil, fmt.Errorf("failed to read header: %w", err)
 	}
 
-	header, err := protocol.DeserializeDirHeader(headerBuffer)
+	header, err := protocol.DeserializeEntryHeader(headerBuffer)
 	if err != nil {
-		return nil, fmt.Errorf("failed to deserialize header: %w\n", err)
+		return nil, fmt.Errorf("failed to deserialize header: %w", lnkerrors.Wrap(lnkerrors.Protocol, err))
 	}
+	conn.trace("received", header)
 
 	if _, err := conn.Write([]byte{1}); err != nil {
 		return nil, fmt.Errorf("failed to send acknowledgment: %w", err)
@@ -194,18 +742,66 @@ func (r *Receiver) getDirHeader(conn net.Conn) (*protocol.DirHeader, error) {
 	return header, nil
 }
 
-func (r *Receiver) getFileHeader(conn net.Conn) (*protocol.FileHeader, error) {
+func (r *Receiver) getFileHeader(conn *session) (*protocol.FileHeader, error) {
 	headerBuffer := make([]byte, config.FILE_HEADER_MAX_SIZE)
 
-	_, err := conn.Read(headerBuffer)
+	// Read the fixed-size part first to know the length of the filename,
+	// long paths may not arrive in a single read
+	_, err := io.ReadFull(conn, headerBuffer[:config.FILE_HEADER_MIN_SIZE])
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	size, err := protocol.FileHeaderSize(headerBuffer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to deserialize header: %w", lnkerrors.Wrap(lnkerrors.Protocol, err))
+	}
+
+	_, err = io.ReadFull(conn, headerBuffer[config.FILE_HEADER_MIN_SIZE:size])
 	if err != nil {
-		return nil, fmt.Errorf("failed to read header: %w\n", err)
+		return nil, fmt.Errorf("failed to read header: %w", err)
 	}
 
-	header, err := protocol.DeserializeHeader(headerBuffer)
+	header, err := protocol.DeserializeHeader(headerBuffer[:size])
 	if err != nil {
-		return nil, fmt.Errorf("failed to deserialize header: %w\n", err)
+		return nil, fmt.Errorf("failed to deserialize header: %w", lnkerrors.Wrap(lnkerrors.Protocol, err))
 	}
+	conn.trace("received", header)
+
+	if header.ChunkSize != conn.chunkSize {
+		return nil, fmt.Errorf("%s: got chunk size %d instead of the negotiated %d: %w", header.FileName, header.ChunkSize, conn.chunkSize, lnkerrors.InvalidChunkSize)
+	}
+	if err := header.CheckReps(); err != nil {
+		return nil, err
+	}
+
+	return header, nil
+}
+
+func (r *Receiver) getSkipHeader(conn *session) (*protocol.SkipHeader, error) {
+	headerBuffer := make([]byte, config.SKIP_HEADER_MIN_SIZE+config.MAX_FILENAME_LENGTH+config.MAX_REASON_LENGTH)
+
+	// Read the fixed-size part first to know the length of the name and the reason
+	_, err := io.ReadFull(conn, headerBuffer[:config.SKIP_HEADER_MIN_SIZE])
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	size, err := protocol.SkipHeaderSize(headerBuffer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to deserialize header: %w", lnkerrors.Wrap(lnkerrors.Protocol, err))
+	}
+
+	_, err = io.ReadFull(conn, headerBuffer[config.SKIP_HEADER_MIN_SIZE:size])
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	header, err := protocol.DeserializeSkipHeader(headerBuffer[:size])
+	if err != nil {
+		return nil, fmt.Errorf("failed to deserialize header: %w", lnkerrors.Wrap(lnkerrors.Protocol, err))
+	}
+	conn.trace("received", header)
 
 	if _, err := conn.Write([]byte{1}); err != nil {
 		return nil, fmt.Errorf("failed to send acknowledgment: %w", err)
@@ -214,21 +810,44 @@ func (r *Receiver) getFileHeader(conn net.Conn) (*protocol.FileHeader, error) {
 	return header, nil
 }
 
-func (r *Receiver) getChunk(conn net.Conn, size uint32) (*protocol.Chunk, int, error) {
-	chunkBuffer := make([]byte, size)
+// Answer a file header with the offset to start the file from
+func (r *Receiver) acceptFile(conn *session, offset uint64) error {
+	ack := protocol.PrepareFileAck(offset)
+
+	ackBuffer, err := ack.Serialize()
+	if err != nil {
+		return fmt.Errorf("failed to serialize acknowledgment: %w", err)
+	}
+
+	if _, err := conn.Write(ackBuffer); err != nil {
+		return fmt.Errorf("failed to send acknowledgment: %w", err)
+	}
+	conn.trace("sent", ack)
+
+	return nil
+}
+
+func (r *Receiver) getChunk(conn *session) (*protocol.Chunk, int, error) {
+	// The buffer is allocated once with the negotiated size
+	chunkBuffer := conn.chunkBuffer
 	n, err := io.ReadFull(conn, chunkBuffer)
-	if err != nil && errors.Is(err, io.EOF) {
-		return nil, 0, fmt.Errorf("failed to read data chunk: %w\n", err)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read data chunk: %w", err)
+	}
+	if r.OnChunk != nil && !conn.lastAck.IsZero() {
+		r.OnChunk(time.Since(conn.lastAck))
 	}
 
 	chunk, err := protocol.DeserializeChunk(chunkBuffer[:n])
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to deserialize chunk: %w\n", err)
+		return nil, 0, fmt.Errorf("failed to deserialize chunk: %w", lnkerrors.Wrap(lnkerrors.Protocol, err))
 	}
+	conn.trace("received", chunk)
 
 	if _, err := conn.Write([]byte{1}); err != nil {
 		return nil, 0, fmt.Errorf("failed to send acknowledgment: %w", err)
 	}
+	conn.lastAck = time.Now()
 
 	return chunk, n, nil
 }
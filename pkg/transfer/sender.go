@@ -1,6 +1,9 @@
 package transfer
 
 import (
+	"bufio"
+	"context"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
@@ -8,17 +11,58 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/LxrdShadow/linker/internal/config"
+	lnkerrors "github.com/LxrdShadow/linker/internal/errors"
 	"github.com/LxrdShadow/linker/internal/protocol"
 	"github.com/LxrdShadow/linker/pkg/color"
+	"github.com/LxrdShadow/linker/pkg/event"
 	"github.com/LxrdShadow/linker/pkg/log"
 	"github.com/LxrdShadow/linker/pkg/util"
 )
 
+// Time given to the files in progress when shutting down, before closing the connections
+const SHUTDOWN_TIMEOUT = 10 * time.Second
+
 type Sender struct {
 	*Connection
-	Entries []string
+	Entries      []string
+	MaxDownloads int
+	Expire       time.Duration
+	StreamName   string
+	Stdin        io.Reader
+	ChunkSize    uint32
+	Events       event.Sink
+
+	// Optional, called with the address of each receiver before the transfer starts.
+	// Refused receivers are told that the share is closed
+	Approve func(peer string) bool
+
+	// Optional, called with the address the sender listens on (useful with port 0)
+	OnListen func(addr string)
+
+	// Optional, called with the address of each receiver turned away, refused by Approve
+	// or arriving once the share is closed
+	OnReject func(peer string)
+
+	// Optional, called with the round trip of each chunk: from its sending to its acknowledgment
+	OnChunk func(rtt time.Duration)
+
+	// Destination of the messages, the logger of the log package when nil
+	Logger *log.Logger
+
+	mu         sync.Mutex
+	listener   net.Listener
+	downloads  int
+	incomplete int // Receivers that didn't get every file
+	closed     bool
+	full       bool                // Closed by the download limit, an interrupted download reopens it
+	stopping   bool                // Shutting down, the receivers get an abort instead of their next file
+	inFlight   int                 // Downloads admitted and not done yet
+	conns      map[string]net.Conn // Receivers being served, by address
 }
 
 // Creates a new sender object
@@ -29,102 +73,614 @@ func NewSender(config *util.FlagConfig) *Sender {
 			Port:    config.Port,
 			Network: config.Network,
 			Addr:    config.Addr,
+
+			HandshakeTimeout: config.HandshakeTimeout,
+			IdleTimeout:      config.IdleTimeout,
+			KeepAlive:        config.KeepAlive,
+			Faults:           config.Faults,
 		},
-		Entries: config.Entries,
+		Entries:      config.Entries,
+		MaxDownloads: config.MaxDownloads,
+		Expire:       config.Expire,
+		StreamName:   config.StreamName,
+		Stdin:        os.Stdin,
+		ChunkSize:    config.ChunkSize,
 	}
 
 	return sender
 }
 
-// Listens on the sender's host IP and port
+// Listens on the sender's host IP and port until the share is closed
 func (s *Sender) Listen() error {
-	listener, err := net.Listen(s.Network, s.Addr)
+	return s.ListenContext(context.Background())
+}
+
+// Same as Listen, the share is closed and the transfers are stopped when the context is canceled
+func (s *Sender) ListenContext(ctx context.Context) error {
+	listenConfig := net.ListenConfig{KeepAlive: s.keepAlive()}
+	listener, err := listenConfig.Listen(ctx, s.Network, s.Addr)
 	if err != nil {
 		return fmt.Errorf("failed to listen on %s: %w", color.Sprint(color.RED, s.Addr), err)
 	}
 
-	fmt.Printf("Listening on: %s\n", color.Sprint(color.BLUE, s.Addr))
+	s.mu.Lock()
+	s.listener = listener
+	if s.closed {
+		// Closed before listening
+		listener.Close()
+	}
+	s.mu.Unlock()
+
+	stop := context.AfterFunc(ctx, s.abort)
+	defer stop()
+
+	fmt.Fprintf(s.logger().Writer(), "Listening on: %s\n", color.Sprint(color.BLUE, s.Addr))
+	if s.OnListen != nil {
+		s.OnListen(listener.Addr().String())
+	}
+
+	if s.Expire > 0 {
+		timer := time.AfterFunc(s.Expire, func() {
+			s.logger().Info("the share has expired, no longer accepting downloads\n")
+			s.Close()
+		})
+		defer timer.Stop()
+	}
 
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
-			log.Errorf("failed to accept connection: %s", err.Error())
+			// Closed once no download is in flight
+			if errors.Is(err, net.ErrClosed) {
+				break
+			}
+			s.logger().Errorf("failed to accept connection: %s\n", err.Error())
+			continue
+		}
+		conn = s.Faults.Wrap(conn)
+
+		if !s.admit() {
+			go s.rejectConnection(conn)
 			continue
 		}
 
-		go s.handleConnection(conn)
+		go func() {
+			defer s.done()
+
+			if s.isStopping() || !s.approve(conn) {
+				s.rejectConnection(conn)
+				return
+			}
+			started, err := s.handleConnection(conn)
+			if connectionLost(err) && s.refund() {
+				// The receiver can come back to resume its transfer
+				return
+			}
+			if started && err != nil {
+				s.mu.Lock()
+				s.incomplete++
+				s.mu.Unlock()
+			}
+		}()
+	}
+
+	fmt.Fprintln(s.logger().Writer(), "Share closed on", color.Sprint(color.BLUE, s.Addr))
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if s.incomplete > 0 {
+		return fmt.Errorf("%d receiver(s) didn't get every file: %w", s.incomplete, lnkerrors.TransferIncomplete)
+	}
+
+	return nil
+}
+
+// Ask Approve about a receiver, while heartbeats keep it waiting
+func (s *Sender) approve(conn net.Conn) bool {
+	if s.Approve == nil {
+		return true
+	}
+
+	stop := s.heartbeat(conn)
+	defer stop()
+
+	return s.Approve(conn.RemoteAddr().String())
+}
+
+// Send heartbeats until the returned function is called, so that a receiver
+// waiting for the transfer header doesn't time out
+func (s *Sender) heartbeat(conn net.Conn) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(config.HEARTBEAT_INTERVAL)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if s.HandshakeTimeout > 0 {
+					conn.SetWriteDeadline(time.Now().Add(s.HandshakeTimeout))
+				}
+				if _, err := conn.Write([]byte{config.HEARTBEAT}); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// Register a new download, closing the share once the download limit is reached
+func (s *Sender) admit() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+
+	s.downloads++
+	s.inFlight++
+
+	if s.MaxDownloads > 0 && s.downloads >= s.MaxDownloads {
+		s.logger().Infof("download limit of %d reached, no longer accepting downloads\n", s.MaxDownloads)
+		s.closeLocked()
+		s.full = true
+	}
+
+	return true
+}
+
+// Give back the download of a receiver whose connection was lost, so that it can come back
+// and resume its transfer. A share closed by the download limit is reopened
+func (s *Sender) refund() bool {
+	// The data of stdin can't be read again
+	if slices.Contains(s.Entries, config.STDIN_ENTRY) {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The transfers stopped by a shutdown won't be resumed
+	if s.stopping {
+		return false
+	}
+
+	s.downloads--
+	if s.full {
+		s.full = false
+		s.closed = false
+		s.logger().Info("a download was interrupted, accepting a receiver again\n")
+	}
+
+	return true
+}
+
+// End a download admitted earlier, the last one closes the listener of a closed share
+func (s *Sender) done() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.inFlight--
+	if s.inFlight == 0 && s.closed && s.listener != nil {
+		s.listener.Close()
 	}
 }
 
-func (s *Sender) handleConnection(conn net.Conn) error {
-	fmt.Println("Connected with", color.Sprint(color.YELLOW, conn.RemoteAddr().String()))
-	fmt.Println()
+// Stop accepting new downloads, Listen returns once the in-flight transfers are done
+func (s *Sender) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.full = false
+	s.closeLocked()
+}
+
+func (s *Sender) closeLocked() {
+	if s.closed {
+		return
+	}
+	s.closed = true
+
+	// Keep answering late receivers until the in-flight transfers finish, the last one
+	// closes the listener unless one of them was interrupted and reopened the share
+	if s.inFlight == 0 && s.listener != nil {
+		s.listener.Close()
+	}
+}
+
+// Tell a late receiver that the share is closed
+func (s *Sender) rejectConnection(conn net.Conn) {
 	defer conn.Close()
 
-	transferHeader, err := protocol.PrepareTransferHeader(s.Entries)
+	s.logger().With("peer", conn.RemoteAddr().String()).Warning("rejected a receiver: the share is closed\n")
+	if s.OnReject != nil {
+		s.OnReject(conn.RemoteAddr().String())
+	}
+
+	packetBuffer, err := protocol.PrepareClosedTransferHeader().Serialize()
 	if err != nil {
-		return fmt.Errorf("failed to prepare transfer header: %w", err)
+		s.logger().Errorf("failed to serialize packet: %s\n", err.Error())
+		return
 	}
 
-	// TODO: Send the transfer header instead of the number of entries
-	err = s.sendPacket(conn, transferHeader)
+	conn.Write(packetBuffer)
+}
 
-	for i, entry := range s.Entries {
-		if transferHeader.IsDir[i] {
-			err = s.sendDirectory(conn, entry)
-		} else {
-			err = s.sendSingleFile(conn, entry, "")
+// Close the share and tell the receivers that the transfer is aborted once their current file is sent.
+// The connections still open after the timeout are closed, Listen returns when they are all done
+func (s *Sender) Shutdown(timeout time.Duration) {
+	s.mu.Lock()
+	s.stopping = true
+	s.full = false
+	s.closeLocked()
+	s.mu.Unlock()
+
+	time.AfterFunc(timeout, func() {
+		s.mu.Lock()
+		late := len(s.conns)
+		s.mu.Unlock()
+
+		if late > 0 {
+			s.logger().Warningf("the files in progress didn't finish within %s, closing %d connection(s)\n", timeout, late)
 		}
+		s.abort()
+	})
+}
 
-		if err != nil {
-			log.Errorf("failed to send %s: %s", err.Error())
+// Close the share and stop every transfer in progress
+func (s *Sender) abort() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.full = false
+	s.closeLocked()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+}
+
+func (s *Sender) logger() *log.Logger {
+	if s.Logger != nil {
+		return s.Logger
+	}
+
+	return log.Default()
+}
+
+// Stop the transfer to a receiver by closing its connection
+func (s *Sender) Disconnect(peer string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if conn, ok := s.conns[peer]; ok {
+		conn.Close()
+	}
+}
+
+func (s *Sender) track(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conns == nil {
+		s.conns = make(map[string]net.Conn)
+	}
+	s.conns[conn.RemoteAddr().String()] = conn
+}
+
+func (s *Sender) untrack(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.conns, conn.RemoteAddr().String())
+}
+
+func (s *Sender) isStopping() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.stopping
+}
+
+// Send the abort entry when shutting down, the returned error ends the session
+func (s *Sender) checkStopping(conn *session) error {
+	if !s.isStopping() {
+		return nil
+	}
+
+	if err := s.sendPacket(conn, protocol.PrepareAbortEntryHeader()); err != nil {
+		return fmt.Errorf("failed to send abort: %w", err)
+	}
+
+	return fmt.Errorf("shutting down: %w", lnkerrors.TransferAborted)
+}
+
+func (s *Sender) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.closed
+}
+
+// Serve a receiver, reports if the session got past the handshake
+func (s *Sender) handleConnection(netConn net.Conn) (bool, error) {
+	fmt.Fprintln(s.logger().Writer(), "Connected with", color.Sprint(color.YELLOW, netConn.RemoteAddr().String()))
+	fmt.Fprintln(s.logger().Writer())
+	defer netConn.Close()
+
+	s.track(netConn)
+	defer s.untrack(netConn)
+
+	conn := newSession(netConn, event.SENDER, s.Events, s.logger())
+	conn.setTimeout(s.HandshakeTimeout)
+	totalFiles, totalBytes := s.countEntries()
+	err := s.openSession(conn, totalFiles, totalBytes)
+	if err != nil {
+		conn.logger.Errorf("%s\n", err.Error())
+		conn.fail("", err)
+		return false, err
+	}
+	conn.setTimeout(s.IdleTimeout)
+	conn.started()
+	conn.logger.Debugf("negotiated a chunk size of %d bytes", conn.chunkSize)
+	conn.manifest(s.Entries, totalFiles, totalBytes)
+	defer conn.summary()
+
+	// The manifest is streamed, each file is announced right before being sent
+	for _, entry := range s.Entries {
+		if err := s.checkStopping(conn); err != nil {
+			conn.logger.Warningf("%s\n", err.Error())
+			conn.fail("", err)
+			return true, err
+		}
+
+		if err := s.sendEntry(conn, entry); err != nil {
+			if errors.Is(err, lnkerrors.TransferAborted) {
+				conn.logger.Warningf("%s\n", err.Error())
+				conn.fail("", err)
+				return true, err
+			}
+
+			// The receiver knows the entry by its name, not by the local path
+			name := s.StreamName
+			if entry != config.STDIN_ENTRY {
+				name = entryName(entry, "")
+			}
+			conn.logger.With("file", name).Errorf("%s\n", err.Error())
+			conn.fail(name, err)
+			if connectionLost(err) {
+				return true, err
+			}
 			continue
 		}
 	}
 
-	response := make([]byte, 50)
-	_, err = conn.Read(response)
-	if err != nil && errors.Is(err, io.EOF) {
-		log.Errorf("failed to read response: %s\n", err.Error())
+	err = s.sendPacket(conn, protocol.PrepareEndEntryHeader())
+	if err != nil {
+		err = fmt.Errorf("failed to send end of manifest: %w", err)
+		conn.fail("", err)
+		return true, err
 	}
 
-	log.Successf("%s\n", string(response))
-	fmt.Println()
-	fmt.Println("Closing connection with with", color.Sprint(color.YELLOW, conn.RemoteAddr().String()))
-	fmt.Printf("Listening on: %s\n", color.Sprint(color.GREEN, s.Addr))
+	receipt, err := s.getReceipt(conn)
+	if err != nil {
+		conn.logger.Errorf("%s\n", err.Error())
+		conn.fail("", err)
+		return true, err
+	}
+	sent := s.checkReceipt(conn, receipt)
 
-	return nil
+	if conn.failed > 0 {
+		conn.logger.Warningf("the receiver got %d of %d file(s)\n", sent-int(conn.failed), sent)
+	} else {
+		conn.logger.Successf("the receiver got and verified %d file(s)\n", sent)
+	}
+	fmt.Fprintln(s.logger().Writer())
+	fmt.Fprintln(s.logger().Writer(), "Closing connection with", color.Sprint(color.YELLOW, conn.RemoteAddr().String()))
+	if !s.isClosed() {
+		fmt.Fprintf(s.logger().Writer(), "Listening on: %s\n", color.Sprint(color.GREEN, s.Addr))
+	}
+
+	if conn.failed > 0 {
+		return true, fmt.Errorf("%s: %d file(s) not delivered: %w", conn.RemoteAddr().String(), conn.failed, lnkerrors.TransferIncomplete)
+	}
+
+	return true, nil
 }
 
-// Send the single file specified in the app's flags
-func (s *Sender) sendDirectory(conn net.Conn, dir string) error {
-	baseDir := filepath.Dir(filepath.Clean(dir))
-	var reps int
+// Read the receipt the receiver sends once the manifest is over, by file name
+func (s *Sender) getReceipt(conn *session) (map[string]protocol.ReceiptEntry, error) {
+	reader := bufio.NewReader(conn)
+	received := make(map[string]protocol.ReceiptEntry)
 
-	err := filepath.Walk(dir, func(path string, info fs.FileInfo, err error) error {
-		if info.IsDir() {
-			return nil
+	entryBuffer := make([]byte, config.RECEIPT_ENTRY_MIN_SIZE+config.MAX_FILENAME_LENGTH+config.MAX_REASON_LENGTH)
+	for {
+		if _, err := io.ReadFull(reader, entryBuffer[:config.RECEIPT_ENTRY_MIN_SIZE]); err != nil {
+			return nil, fmt.Errorf("failed to read the receipt: %w", err)
 		}
-		reps++
 
-		return nil
-	})
+		size, err := protocol.ReceiptEntrySize(entryBuffer)
+		if err != nil {
+			return nil, fmt.Errorf("invalid receipt: %w", lnkerrors.Wrap(lnkerrors.Protocol, err))
+		}
+
+		if _, err := io.ReadFull(reader, entryBuffer[config.RECEIPT_ENTRY_MIN_SIZE:size]); err != nil {
+			return nil, fmt.Errorf("failed to read the receipt: %w", err)
+		}
+
+		entry, err := protocol.DeserializeReceiptEntry(entryBuffer[:size])
+		if err != nil {
+			return nil, fmt.Errorf("invalid receipt: %w", lnkerrors.Wrap(lnkerrors.Protocol, err))
+		}
+		conn.trace("received", entry)
+
+		if entry.IsEnd() {
+			return received, nil
+		}
+		received[entry.Name] = *entry
+	}
+}
+
+// Compare the receipt with the files sent, the ones the receiver didn't get intact fail.
+// Returns the number of files the session was about
+func (s *Sender) checkReceipt(conn *session, received map[string]protocol.ReceiptEntry) int {
+	// Failing a file adds to the outcomes
+	outcomes := slices.Clone(conn.outcomes)
+	for _, sent := range outcomes {
+		if sent.Status != config.RECEIPT_OK {
+			continue
+		}
+
+		var err error
+		entry, ok := received[sent.Name]
+		switch {
+		case !ok:
+			err = fmt.Errorf("missing from the receipt")
+		case entry.Status == config.RECEIPT_SKIPPED:
+			err = fmt.Errorf("skipped by the receiver: %s", entry.Reason)
+		case entry.Status == config.RECEIPT_FAILED:
+			err = fmt.Errorf("failed on the receiver: %s", entry.Reason)
+		case entry.Hash != sent.Hash || entry.Bytes != sent.Bytes:
+			err = fmt.Errorf("%w: the receiver got %d bytes with SHA-256 %x", lnkerrors.VerificationFailed, entry.Bytes, entry.Hash)
+		}
+
+		if err != nil {
+			conn.logger.With("file", sent.Name).Errorf("%s\n", err.Error())
+			conn.fail(sent.Name, err)
+		}
+	}
+
+	return len(outcomes)
+}
+
+// Count the files of the entries and their total size, without keeping the list in memory.
+// Unreadable files are counted anyway, they will be reported as failed when sent
+func (s *Sender) countEntries() (uint64, uint64) {
+	var files, bytes uint64
+
+	for _, entry := range s.Entries {
+		if entry == config.STDIN_ENTRY {
+			files++
+			bytes = config.UNKNOWN_SIZE
+			continue
+		}
+
+		filepath.WalkDir(entry, func(path string, d fs.DirEntry, err error) error {
+			// An unreadable directory is announced as a skipped entry
+			if err != nil {
+				files++
+				return nil
+			}
+			if d.IsDir() {
+				return nil
+			}
+
+			files++
+			if info, err := d.Info(); err == nil && bytes != config.UNKNOWN_SIZE {
+				bytes += uint64(info.Size())
+			}
+
+			return nil
+		})
+	}
+
+	return files, bytes
+}
+
+// Send the transfer header and agree on the chunk size with the receiver
+func (s *Sender) openSession(conn *session, totalFiles, totalBytes uint64) error {
+	header := protocol.PrepareTransferHeader(s.ChunkSize, totalFiles, totalBytes)
+
+	packetBuffer, err := header.Serialize()
 	if err != nil {
-		return fmt.Errorf("failed to send directory: %s: %w", dir, err)
+		return fmt.Errorf("failed to serialize transfer header: %w", err)
+	}
+
+	if _, err := conn.Write(packetBuffer); err != nil {
+		return fmt.Errorf("failed to send transfer header: %w", err)
+	}
+	conn.trace("sent", header)
+
+	ackBuffer := make([]byte, config.TRANSFER_ACK_SIZE)
+	if _, err := io.ReadFull(conn, ackBuffer); err != nil {
+		return fmt.Errorf("failed to receive acknowledgment: %w", err)
+	}
+
+	ack, err := protocol.DeserializeTransferAck(ackBuffer)
+	if err != nil {
+		return fmt.Errorf("failed to negotiate the chunk size: %w", lnkerrors.Wrap(lnkerrors.Protocol, err))
+	}
+	conn.trace("received", ack)
+	conn.setChunkSize(ack.ChunkSize)
+
+	return nil
+}
+
+// Send a file or a directory specified in the app's arguments
+func (s *Sender) sendEntry(conn *session, entry string) error {
+	if entry == config.STDIN_ENTRY {
+		return s.sendStream(conn, s.Stdin, s.StreamName)
 	}
 
-	header := protocol.PrepareDirHeader(reps)
-	err = s.sendPacket(conn, header)
+	info, err := os.Stat(entry)
+	if err != nil {
+		return s.skipEntry(conn, entry, "", err)
+	}
+
+	if info.IsDir() {
+		return s.sendDirectory(conn, entry)
+	}
+
+	return s.sendSingleFile(conn, entry, "")
+}
+
+// Send every file inside a directory, one entry at a time
+func (s *Sender) sendDirectory(conn *session, dir string) error {
+	baseDir := filepath.Dir(filepath.Clean(dir))
 
-	err = filepath.Walk(dir, func(path string, info fs.FileInfo, err error) error {
-		if info.IsDir() {
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.IsDir() {
 			return nil
 		}
 
-		s.sendSingleFile(conn, path, baseDir)
+		if err := s.checkStopping(conn); err != nil {
+			return err
+		}
+
+		// An unreadable directory is skipped like a file, the rest of the walk goes on
+		if err != nil {
+			err = s.skipEntry(conn, path, baseDir, err)
+		} else {
+			err = s.sendSingleFile(conn, path, baseDir)
+		}
+
+		if err != nil {
+			// The rest of the directory can't be sent either
+			if connectionLost(err) {
+				return err
+			}
+			name := entryName(path, baseDir)
+			conn.logger.With("file", name).Errorf("%s\n", err.Error())
+			conn.fail(name, err)
+		}
 
 		return nil
 	})
+	if errors.Is(err, lnkerrors.TransferAborted) {
+		return err
+	}
 	if err != nil {
 		return fmt.Errorf("failed to send directory: %s: %w", dir, err)
 	}
@@ -133,24 +689,29 @@ func (s *Sender) sendDirectory(conn net.Conn, dir string) error {
 }
 
 // Send one file specified as argument
-func (s *Sender) sendSingleFile(conn net.Conn, filepath, baseDir string) error {
+func (s *Sender) sendSingleFile(conn *session, filepath, baseDir string) error {
 	file, err := os.Open(filepath)
 	if err != nil {
-		return fmt.Errorf("failed to open file: %w\n", err)
+		return s.skipEntry(conn, filepath, baseDir, fmt.Errorf("failed to open file: %w", err))
 	}
 	defer file.Close()
 
-	header, err := protocol.PrepareFileHeader(file, baseDir)
+	header, err := protocol.PrepareFileHeader(file, baseDir, conn.chunkSize)
+	if err != nil {
+		return s.skipEntry(conn, filepath, baseDir, fmt.Errorf("failed to get file header: %w", err))
+	}
+
+	err = s.sendPacket(conn, protocol.PrepareFileEntryHeader())
 	if err != nil {
-		return fmt.Errorf("failed to get file header: %w", err)
+		return fmt.Errorf("failed to send entry header: %w", err)
 	}
 
-	err = s.sendPacket(conn, header)
+	ack, err := s.sendFileHeader(conn, header)
 	if err != nil {
 		return fmt.Errorf("failed to send header: %w", err)
 	}
 
-	err = s.sendFileByChunks(conn, file, header)
+	err = s.sendFileByChunks(conn, file, header, ack.Offset)
 	if err != nil {
 		return fmt.Errorf("failed to send file: %w", err)
 	}
@@ -158,40 +719,230 @@ func (s *Sender) sendSingleFile(conn net.Conn, filepath, baseDir string) error {
 	return nil
 }
 
-func (s *Sender) sendFileByChunks(conn net.Conn, file *os.File, header *protocol.FileHeader) error {
+// Send the chunks of a file, starting with the one holding the offset the receiver asked for
+func (s *Sender) sendFileByChunks(conn *session, file *os.File, header *protocol.FileHeader, offset uint64) error {
 	chunk := new(protocol.Chunk)
-	dataBuffer := make([]byte, config.DATA_MAX_SIZE)
+	dataBuffer := make([]byte, conn.chunkSize-config.CHUNK_MIN_SIZE)
+
+	first := header.FirstChunk(offset)
+	skipped := min(uint64(first)*uint64(len(dataBuffer)), header.FileSize)
+
+	// The hash covers the whole file, including what the receiver already has
+	hash := sha256.New()
+	if _, err := io.Copy(hash, io.NewSectionReader(file, 0, int64(skipped))); err != nil {
+		return fmt.Errorf("failed to read the start of the file: %w", err)
+	}
+	if skipped > 0 {
+		conn.logger.With("file", header.FileName).Infof("resuming at %d of %d bytes\n", skipped, header.FileSize)
+	}
+	transfer := conn.resumeFile(header, hash, skipped)
 
-	for i := 0; i < int(header.Reps); i++ {
-		n, _ := file.ReadAt(dataBuffer, int64(i*len(dataBuffer)))
+	for i := int(first); i < int(header.Reps); i++ {
+		n, err := file.ReadAt(dataBuffer, int64(i)*int64(len(dataBuffer)))
+		if err != nil && err != io.EOF {
+			return s.failFile(conn, fmt.Errorf("failed to read the file: %w", err))
+		}
 
 		chunk.SequenceNumber = uint32(i)
 		chunk.DataLength = uint64(n)
 		chunk.Data = dataBuffer
 
-		s.sendPacket(conn, chunk)
+		sent := time.Now()
+		if err := s.sendPacket(conn, chunk); err != nil {
+			return err
+		}
+		s.chunkAcked(sent)
+		transfer.add(dataBuffer[:n])
 	}
+	transfer.done()
 
 	return nil
 }
 
+// Send data of unknown length, the end of the stream is marked by an empty chunk
+func (s *Sender) sendStream(conn *session, reader io.Reader, name string) error {
+	header := protocol.PrepareStreamHeader(name, conn.chunkSize)
+	if err := header.CheckName(); err != nil {
+		return s.skipEntry(conn, name, "", err)
+	}
+
+	err := s.sendPacket(conn, protocol.PrepareFileEntryHeader())
+	if err != nil {
+		return fmt.Errorf("failed to send entry header: %w", err)
+	}
+
+	// Streams always start from the beginning
+	if _, err := s.sendFileHeader(conn, header); err != nil {
+		return fmt.Errorf("failed to send header: %w", err)
+	}
+
+	chunk := new(protocol.Chunk)
+	dataBuffer := make([]byte, conn.chunkSize-config.CHUNK_MIN_SIZE)
+	transfer := conn.startFile(header)
+
+	for i := 0; ; i++ {
+		n, readErr, err := s.readStream(conn, reader, dataBuffer)
+		if err != nil {
+			return fmt.Errorf("failed to send stream: %w", err)
+		}
+		if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+			return s.failFile(conn, fmt.Errorf("failed to read %s: %w", name, readErr))
+		}
+
+		chunk.SequenceNumber = uint32(i)
+		chunk.DataLength = uint64(n)
+		chunk.Data = dataBuffer
+
+		sent := time.Now()
+		if err := s.sendPacket(conn, chunk); err != nil {
+			return fmt.Errorf("failed to send stream: %w", err)
+		}
+		s.chunkAcked(sent)
+		transfer.add(dataBuffer[:n])
+
+		// The empty chunk tells the receiver that the stream has ended
+		if n == 0 {
+			transfer.done()
+			return nil
+		}
+	}
+}
+
+// Fill the buffer from the stream, sending heartbeats to the receiver while the stream is quiet.
+// Returns the error of the stream and the one of the connection
+func (s *Sender) readStream(conn *session, reader io.Reader, buffer []byte) (int, error, error) {
+	type result struct {
+		n   int
+		err error
+	}
+
+	results := make(chan result, 1)
+	go func() {
+		n, err := io.ReadFull(reader, buffer)
+		results <- result{n, err}
+	}()
+
+	ticker := time.NewTicker(config.HEARTBEAT_INTERVAL)
+	defer ticker.Stop()
+
+	var heartbeat *protocol.Chunk
+	for {
+		select {
+		case res := <-results:
+			return res.n, res.err, nil
+		case <-ticker.C:
+			if heartbeat == nil {
+				heartbeat = protocol.PrepareHeartbeatChunk(conn.chunkSize)
+			}
+			if err := s.sendPacket(conn, heartbeat); err != nil {
+				return 0, nil, err
+			}
+		}
+	}
+}
+
+// Tell the receiver that an entry can't be sent, both sides go on with the next one.
+// Returns the reason, or the error of the connection
+func (s *Sender) skipEntry(conn *session, path, baseDir string, reason error) error {
+	name := entryName(path, baseDir)
+
+	// The receiver counted the file in the size of the transfer
+	var size uint64
+	if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+		size = uint64(info.Size())
+	}
+
+	// The receiver waits for the skip header once the entry is announced, so it has to be sendable
+	header := protocol.PrepareSkipHeader(name, size, reason.Error())
+	if _, err := header.Serialize(); err != nil {
+		return fmt.Errorf("failed to prepare skip header: %w", err)
+	}
+
+	if err := s.sendPacket(conn, protocol.PrepareSkipEntryHeader()); err != nil {
+		return fmt.Errorf("failed to send entry header: %w", err)
+	}
+
+	if err := s.sendPacket(conn, header); err != nil {
+		return fmt.Errorf("failed to send skip header: %w", err)
+	}
+
+	return reason
+}
+
+// Get the name the receiver knows a file by, relative to the directory sent or its base name
+func entryName(path, baseDir string) string {
+	if baseDir != "" {
+		if rel, err := filepath.Rel(baseDir, path); err == nil {
+			return rel
+		}
+	}
+
+	return filepath.Base(path)
+}
+
+// Tell the receiver that the rest of a file won't come.
+// Returns the reason, or the error of the connection
+func (s *Sender) failFile(conn *session, reason error) error {
+	chunk := protocol.PrepareFailureChunk(conn.chunkSize, reason.Error())
+	if err := s.sendPacket(conn, chunk); err != nil {
+		return err
+	}
+
+	return reason
+}
+
+// Send a file header, the receiver answers with the offset to start from
+func (s *Sender) sendFileHeader(conn *session, header *protocol.FileHeader) (*protocol.FileAck, error) {
+	packetBuffer, err := header.Serialize()
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize packet: %w", err)
+	}
+
+	if _, err := conn.Write(packetBuffer); err != nil {
+		return nil, fmt.Errorf("failed to send packet: %w", err)
+	}
+	conn.trace("sent", header)
+
+	ackBuffer := make([]byte, config.FILE_ACK_SIZE)
+	if _, err := io.ReadFull(conn, ackBuffer); err != nil {
+		return nil, fmt.Errorf("failed to receive acknowledgment: %w", err)
+	}
+
+	ack, err := protocol.DeserializeFileAck(ackBuffer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid acknowledgment received: %w", lnkerrors.Wrap(lnkerrors.Protocol, err))
+	}
+	conn.trace("received", ack)
+
+	return ack, nil
+}
+
+// Report the round trip of a chunk sent at the given time, once it is acknowledged
+func (s *Sender) chunkAcked(sent time.Time) {
+	if s.OnChunk != nil {
+		s.OnChunk(time.Since(sent))
+	}
+}
+
 // Send a packet (it could be a header or a chunk of data)
-func (s *Sender) sendPacket(conn net.Conn, packet protocol.Packet) error {
+func (s *Sender) sendPacket(conn *session, packet protocol.Packet) error {
 	packetBuffer, err := packet.Serialize()
 	if err != nil {
 		return fmt.Errorf("failed to serialize packet: %w", err)
 	}
 
-	conn.Write(packetBuffer)
+	if _, err := conn.Write(packetBuffer); err != nil {
+		return fmt.Errorf("failed to send packet: %w", err)
+	}
+	conn.trace("sent", packet)
 
 	ack := make([]byte, 1)
-	_, err = conn.Read(ack)
-	if err != nil && errors.Is(err, io.EOF) {
+	if _, err := io.ReadFull(conn, ack); err != nil {
 		return fmt.Errorf("failed to receive acknowledgment: %w", err)
 	}
 
 	if ack[0] != 1 {
-		return fmt.Errorf("invalid acknowledgment received")
+		return fmt.Errorf("invalid acknowledgment received: %w", lnkerrors.Malformed)
 	}
 
 	return nil
@@ -0,0 +1,717 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/LxrdShadow/linker/internal/config"
+	lnkerrors "github.com/LxrdShadow/linker/internal/errors"
+	"github.com/LxrdShadow/linker/internal/protocol"
+	"github.com/LxrdShadow/linker/pkg/event"
+	"github.com/LxrdShadow/linker/pkg/fault"
+	"github.com/LxrdShadow/linker/pkg/log"
+)
+
+// Longest wait of the tests for the other side, a stuck transfer fails instead of hanging
+const TEST_TIMEOUT = 10 * time.Second
+
+func testConnection() *Connection {
+	return &Connection{
+		Network:          "tcp",
+		Addr:             "127.0.0.1:0",
+		HandshakeTimeout: TEST_TIMEOUT,
+		IdleTimeout:      TEST_TIMEOUT,
+	}
+}
+
+// A sender sharing the entries with small chunks, so that most files take several of them
+func newTestSender(entries ...string) *Sender {
+	return &Sender{
+		Connection: testConnection(),
+		Entries:    entries,
+		ChunkSize:  config.CHUNK_SIZE_LOWER_BOUND,
+		StreamName: config.STREAM_NAME,
+		Logger:     log.New(io.Discard, io.Discard),
+	}
+}
+
+// Share in the background over the loopback interface, returns the address of the share
+// and the outcome of Listen. The share is closed at the end of the test
+func startSender(t *testing.T, sender *Sender) (string, <-chan error) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	listening := make(chan string, 1)
+	sender.OnListen = func(addr string) { listening <- addr }
+
+	result := make(chan error, 1)
+	finished := make(chan struct{})
+	go func() {
+		result <- sender.ListenContext(ctx)
+		close(finished)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-finished
+	})
+
+	select {
+	case addr := <-listening:
+		return addr, result
+	case <-finished:
+		t.Fatalf("failed to start the share: %v", <-result)
+	case <-time.After(TEST_TIMEOUT):
+		t.Fatal("the share didn't start in time")
+	}
+
+	return "", nil
+}
+
+// Wait for a share limited in downloads to close by itself
+func waitSender(t *testing.T, result <-chan error) error {
+	t.Helper()
+
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(TEST_TIMEOUT):
+		t.Fatal("the share didn't close in time")
+	}
+
+	return nil
+}
+
+func newTestReceiver(addr, dir string) *Receiver {
+	conn := testConnection()
+	conn.Addr = addr
+
+	return &Receiver{
+		Connection: conn,
+		ReceiveDir: dir,
+		ChunkSize:  config.CHUNK_SIZE_UPPER_BOUND,
+		Logger:     log.New(io.Discard, io.Discard),
+	}
+}
+
+// Create the files under dir, the keys are slash-separated paths
+func writeTree(t *testing.T, dir string, files map[string][]byte) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Read every regular file under dir, keyed by slash-separated path
+func readTree(t *testing.T, dir string) map[string][]byte {
+	t.Helper()
+
+	files := make(map[string][]byte)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		files[filepath.ToSlash(rel)] = content
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return files
+}
+
+// Compare the files under dir with the expected ones, reporting each difference
+func assertTree(t *testing.T, dir string, want map[string][]byte) {
+	t.Helper()
+
+	got := readTree(t, dir)
+	for name, content := range want {
+		received, ok := got[name]
+		switch {
+		case !ok:
+			t.Errorf("%s: missing", name)
+		case !bytes.Equal(received, content):
+			t.Errorf("%s: got %d bytes that differ from the %d sent", name, len(received), len(content))
+		}
+	}
+
+	for name := range got {
+		if _, ok := want[name]; !ok {
+			t.Errorf("%s: not expected", name)
+		}
+	}
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+
+	data := make([]byte, n)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+// Prefix the names of a tree with a directory
+func underDir(dir string, files map[string][]byte) map[string][]byte {
+	prefixed := make(map[string][]byte, len(files))
+	for name, content := range files {
+		prefixed[dir+"/"+name] = content
+	}
+
+	return prefixed
+}
+
+func TestTransferDirectory(t *testing.T) {
+	src, dest := t.TempDir(), t.TempDir()
+
+	tree := map[string][]byte{
+		"a.txt":               []byte("first file"),
+		"empty":               {},
+		"sub/b.txt":           []byte("second file"),
+		"sub/deeper/c.bin":    randomBytes(t, 10000),
+		"sub/with space.txt":  []byte("spaces are kept"),
+		"other/nested/d.json": []byte(`{"ok": true}`),
+	}
+	writeTree(t, filepath.Join(src, "project"), tree)
+	writeTree(t, src, map[string][]byte{"notes.txt": []byte("a single file")})
+
+	sender := newTestSender(filepath.Join(src, "project"), filepath.Join(src, "notes.txt"))
+	sender.MaxDownloads = 1
+	addr, result := startSender(t, sender)
+
+	if err := newTestReceiver(addr, dest).Connect(); err != nil {
+		t.Fatalf("failed to receive: %v", err)
+	}
+	if err := waitSender(t, result); err != nil {
+		t.Fatalf("the share failed: %v", err)
+	}
+
+	want := underDir("project", tree)
+	want["notes.txt"] = []byte("a single file")
+	assertTree(t, dest, want)
+}
+
+func TestTransferChunkBoundaries(t *testing.T) {
+	src, dest := t.TempDir(), t.TempDir()
+
+	// The data of a chunk is its size without the sequence number and the length
+	dataSize := config.CHUNK_SIZE_LOWER_BOUND - config.CHUNK_MIN_SIZE
+	tree := make(map[string][]byte)
+	for _, size := range []int{1, dataSize - 1, dataSize, dataSize + 1, 3 * dataSize, 3<<20 + 7} {
+		tree["file-"+strconv.Itoa(size)] = randomBytes(t, size)
+	}
+	writeTree(t, filepath.Join(src, "sizes"), tree)
+
+	sender := newTestSender(filepath.Join(src, "sizes"))
+	sender.MaxDownloads = 1
+	var sent, received atomic.Int64
+	sender.OnChunk = func(time.Duration) { sent.Add(1) }
+	addr, result := startSender(t, sender)
+
+	receiver := newTestReceiver(addr, dest)
+	receiver.OnChunk = func(time.Duration) { received.Add(1) }
+	if err := receiver.Connect(); err != nil {
+		t.Fatalf("failed to receive: %v", err)
+	}
+	if err := waitSender(t, result); err != nil {
+		t.Fatalf("the share failed: %v", err)
+	}
+
+	assertTree(t, dest, underDir("sizes", tree))
+
+	// Every chunk has a round trip on the sender, the first of each file has none on the receiver
+	if sent.Load() < int64(len(tree)) || received.Load() != sent.Load()-int64(len(tree)) {
+		t.Errorf("got %d round trips on the sender and %d on the receiver for %d files", sent.Load(), received.Load(), len(tree))
+	}
+}
+
+func TestTransferStream(t *testing.T) {
+	content := randomBytes(t, 1<<20+3)
+
+	sender := newTestSender(config.STDIN_ENTRY)
+	sender.Stdin = bytes.NewReader(content)
+	sender.StreamName = "backup.tar"
+	sender.MaxDownloads = 1
+	addr, result := startSender(t, sender)
+
+	var out bytes.Buffer
+	receiver := newTestReceiver(addr, t.TempDir())
+	receiver.Stdout = &out
+	if err := receiver.Connect(); err != nil {
+		t.Fatalf("failed to receive: %v", err)
+	}
+	if err := waitSender(t, result); err != nil {
+		t.Fatalf("the share failed: %v", err)
+	}
+
+	if !bytes.Equal(out.Bytes(), content) {
+		t.Errorf("got %d bytes that differ from the %d sent", out.Len(), len(content))
+	}
+}
+
+func TestTransferOverwritesExistingFile(t *testing.T) {
+	src, dest := t.TempDir(), t.TempDir()
+
+	writeTree(t, src, map[string][]byte{"notes.txt": []byte("short")})
+	writeTree(t, dest, map[string][]byte{"notes.txt": []byte("a much longer file that was already there")})
+
+	sender := newTestSender(filepath.Join(src, "notes.txt"))
+	sender.MaxDownloads = 1
+	addr, result := startSender(t, sender)
+
+	if err := newTestReceiver(addr, dest).Connect(); err != nil {
+		t.Fatalf("failed to receive: %v", err)
+	}
+	if err := waitSender(t, result); err != nil {
+		t.Fatalf("the share failed: %v", err)
+	}
+
+	// Nothing of the old content is left behind
+	assertTree(t, dest, map[string][]byte{"notes.txt": []byte("short")})
+}
+
+func TestTransferDirectoryInTheWay(t *testing.T) {
+	src, dest := t.TempDir(), t.TempDir()
+
+	writeTree(t, src, map[string][]byte{"notes.txt": []byte("can't be written")})
+	if err := os.Mkdir(filepath.Join(dest, "notes.txt"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	sender := newTestSender(filepath.Join(src, "notes.txt"))
+	sender.MaxDownloads = 1
+	addr, _ := startSender(t, sender)
+
+	// The receiver gives up, the sender takes the lost connection back and stays open
+	err := newTestReceiver(addr, dest).Connect()
+	if lnkerrors.KindOf(err) != lnkerrors.Filesystem {
+		t.Errorf("got %v, want a filesystem error", err)
+	}
+
+	if info, err := os.Stat(filepath.Join(dest, "notes.txt")); err != nil || !info.IsDir() {
+		t.Errorf("the directory in the way should be left alone: %v", err)
+	}
+}
+
+func TestTransferSkipsMissingEntries(t *testing.T) {
+	src, dest := t.TempDir(), t.TempDir()
+
+	tree := map[string][]byte{"a.txt": []byte("first"), "z.txt": []byte("last")}
+	writeTree(t, src, tree)
+
+	sender := newTestSender(filepath.Join(src, "a.txt"), filepath.Join(src, "missing.txt"), filepath.Join(src, "z.txt"))
+	sender.MaxDownloads = 1
+	addr, result := startSender(t, sender)
+
+	err := newTestReceiver(addr, dest).Connect()
+	if !errors.Is(err, lnkerrors.TransferIncomplete) {
+		t.Errorf("got %v, want %v", err, lnkerrors.TransferIncomplete)
+	}
+	if err := waitSender(t, result); !errors.Is(err, lnkerrors.TransferIncomplete) {
+		t.Errorf("got %v, want %v", err, lnkerrors.TransferIncomplete)
+	}
+
+	// Both sides went on with the entries after the missing one
+	assertTree(t, dest, tree)
+}
+
+func TestTransferSkipsPathsTooLong(t *testing.T) {
+	src, dest := t.TempDir(), t.TempDir()
+
+	tree := map[string][]byte{"a.txt": []byte("first"), "z.txt": []byte("last")}
+	writeTree(t, src, tree)
+
+	// A tree deeper than PATH_MAX, nested one directory at a time so that none of the
+	// paths used to build it is too long
+	name := strings.Repeat("d", config.MAX_NAME_LENGTH-15)
+	deep, nest := filepath.Join(src, name), filepath.Join(src, "nest")
+	writeTree(t, deep, map[string][]byte{"deep.txt": []byte("too deep")})
+	for range 17 {
+		if err := os.Mkdir(nest, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(deep, filepath.Join(nest, name)); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(nest, deep); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sender := newTestSender(src)
+	sender.MaxDownloads = 1
+	addr, result := startSender(t, sender)
+
+	// The receiver is told about the path instead of waiting for it
+	err := newTestReceiver(addr, dest).Connect()
+	if !errors.Is(err, lnkerrors.TransferIncomplete) {
+		t.Errorf("got %v, want %v", err, lnkerrors.TransferIncomplete)
+	}
+	if err := waitSender(t, result); !errors.Is(err, lnkerrors.TransferIncomplete) {
+		t.Errorf("got %v, want %v", err, lnkerrors.TransferIncomplete)
+	}
+
+	got := readTree(t, filepath.Join(dest, filepath.Base(src)))
+	for name, content := range tree {
+		if !bytes.Equal(got[name], content) {
+			t.Errorf("%s: got %q, want %q", name, got[name], content)
+		}
+	}
+}
+
+func TestTransferShareClosed(t *testing.T) {
+	src := t.TempDir()
+	writeTree(t, src, map[string][]byte{"a.txt": []byte("only once")})
+
+	sender := newTestSender(filepath.Join(src, "a.txt"))
+	sender.MaxDownloads = 1
+	addr, result := startSender(t, sender)
+
+	if err := newTestReceiver(addr, t.TempDir()).Connect(); err != nil {
+		t.Fatalf("failed to receive: %v", err)
+	}
+	if err := waitSender(t, result); err != nil {
+		t.Fatalf("the share failed: %v", err)
+	}
+
+	// The listener is gone once the share is closed
+	err := newTestReceiver(addr, t.TempDir()).Connect()
+	if lnkerrors.KindOf(err) != lnkerrors.Network {
+		t.Errorf("got %v, want a network error", err)
+	}
+}
+
+func TestTransferRefused(t *testing.T) {
+	src, dest := t.TempDir(), t.TempDir()
+	writeTree(t, src, map[string][]byte{"a.txt": []byte("not for you")})
+
+	sender := newTestSender(filepath.Join(src, "a.txt"))
+	sender.Approve = func(peer string) bool { return false }
+	rejected := make(chan string, 1)
+	sender.OnReject = func(peer string) { rejected <- peer }
+	addr, _ := startSender(t, sender)
+
+	err := newTestReceiver(addr, dest).Connect()
+	if !errors.Is(err, lnkerrors.ShareClosed) || lnkerrors.ExitCode(err) != lnkerrors.EXIT_AUTH {
+		t.Errorf("got %v, want %v", err, lnkerrors.ShareClosed)
+	}
+	select {
+	case <-rejected:
+	default:
+		t.Error("OnReject wasn't called")
+	}
+	assertTree(t, dest, map[string][]byte{})
+}
+
+func TestTransferResumesAfterDisconnections(t *testing.T) {
+	src, dest := t.TempDir(), t.TempDir()
+
+	tree := map[string][]byte{"large.bin": randomBytes(t, 1<<20), "small.txt": []byte("after the large one")}
+	writeTree(t, src, tree)
+
+	sender := newTestSender(filepath.Join(src, "large.bin"), filepath.Join(src, "small.txt"))
+	sender.MaxDownloads = 1
+	addr, result := startSender(t, sender)
+
+	// Every connection is dropped after 300KB, split in uneven reads
+	receiver := newTestReceiver(addr, dest)
+	receiver.Faults = &fault.Schedule{Seed: 1, Short: 0.3, Disconnect: 300 << 10}
+	receiver.Retries = 10
+	receiver.RetryDelay = 10 * time.Millisecond
+	receiver.RetryMaxDelay = 10 * time.Millisecond
+
+	if err := receiver.Connect(); err != nil {
+		t.Fatalf("failed to receive: %v", err)
+	}
+	if err := waitSender(t, result); err != nil {
+		t.Fatalf("the share failed: %v", err)
+	}
+
+	assertTree(t, dest, tree)
+}
+
+func TestTransferDetectsCorruption(t *testing.T) {
+	src, dest := t.TempDir(), t.TempDir()
+	writeTree(t, src, map[string][]byte{"large.bin": randomBytes(t, 1<<20)})
+
+	sender := newTestSender(filepath.Join(src, "large.bin"))
+	sender.MaxDownloads = 1
+	addr, result := startSender(t, sender)
+
+	// A few bits flipped in the data, the headers are left intact with this seed
+	receiver := newTestReceiver(addr, dest)
+	receiver.Faults = &fault.Schedule{Seed: 3, Corrupt: 0.00001}
+	receiver.Connect()
+
+	// The sender finds out from the hash in the receipt
+	if err := waitSender(t, result); !errors.Is(err, lnkerrors.TransferIncomplete) {
+		t.Errorf("got %v, want %v", err, lnkerrors.TransferIncomplete)
+	}
+}
+
+func TestReceiptOfManyFiles(t *testing.T) {
+	senderConn, receiverConn := net.Pipe()
+	defer senderConn.Close()
+	defer receiverConn.Close()
+
+	logger := log.New(io.Discard, io.Discard)
+	receiving := newSession(receiverConn, event.RECEIVER, nil, logger)
+
+	// More than the 64MB a receipt sent as a single message could hold
+	prefix := strings.Repeat("d", config.MAX_NAME_LENGTH) + "/"
+	prefix = strings.Repeat(prefix, config.MAX_FILENAME_LENGTH/len(prefix)-1)
+	for i := range 20_000 {
+		receiving.outcomes = append(receiving.outcomes, protocol.ReceiptEntry{
+			Status: config.RECEIPT_OK,
+			Bytes:  uint64(i),
+			Name:   prefix + strconv.Itoa(i),
+		})
+	}
+
+	sent := make(chan error, 1)
+	go func() {
+		sent <- (&Receiver{}).sendReceipt(receiving)
+	}()
+
+	received, err := (&Sender{}).getReceipt(newSession(senderConn, event.SENDER, nil, logger))
+	if err != nil {
+		t.Fatalf("failed to get the receipt: %v", err)
+	}
+	if err := <-sent; err != nil {
+		t.Fatalf("failed to send the receipt: %v", err)
+	}
+
+	if len(received) != len(receiving.outcomes) {
+		t.Fatalf("got %d files, want %d", len(received), len(receiving.outcomes))
+	}
+	if entry := received[prefix+"19999"]; entry.Bytes != 19999 {
+		t.Errorf("got %+v for the last file", entry)
+	}
+}
+
+func TestPreviewListsTheManifest(t *testing.T) {
+	src := t.TempDir()
+	tree := map[string][]byte{
+		"a.txt":     []byte("first file"),
+		"sub/b.txt": []byte("second file"),
+	}
+	writeTree(t, filepath.Join(src, "project"), tree)
+	writeTree(t, src, map[string][]byte{"notes.txt": []byte("a single file")})
+
+	sender := newTestSender(filepath.Join(src, "project"), filepath.Join(src, "notes.txt"))
+	sender.MaxDownloads = 1
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go sender.ServePreview(listener)
+
+	receiver := newTestReceiver("", t.TempDir())
+	manifest, err := receiver.Preview(context.Background(), listener.Addr().String(), 10)
+	if err != nil {
+		t.Fatalf("failed to preview: %v", err)
+	}
+
+	want := []protocol.ListingEntry{
+		{Size: 10, Name: filepath.Join("project", "a.txt")},
+		{Size: 11, Name: filepath.Join("project", "sub", "b.txt")},
+		{Size: 13, Name: "notes.txt"},
+	}
+	if manifest.TotalFiles != 3 || manifest.TotalBytes != 34 || manifest.Truncated {
+		t.Errorf("unexpected manifest: %+v", manifest)
+	}
+	if len(manifest.Files) != len(want) {
+		t.Fatalf("got %d files, want %d: %+v", len(manifest.Files), len(want), manifest.Files)
+	}
+	for i, file := range want {
+		if manifest.Files[i] != file {
+			t.Errorf("file %d: got %+v, want %+v", i, manifest.Files[i], file)
+		}
+	}
+
+	// The receiver hangs up once it listed enough files
+	manifest, err = receiver.Preview(context.Background(), listener.Addr().String(), 1)
+	if err != nil {
+		t.Fatalf("failed to preview: %v", err)
+	}
+	if len(manifest.Files) != 1 || !manifest.Truncated || manifest.TotalFiles != 3 {
+		t.Errorf("unexpected manifest: %+v", manifest)
+	}
+
+	// The previews aren't downloads
+	addr, result := startSender(t, sender)
+	if err := newTestReceiver(addr, t.TempDir()).Connect(); err != nil {
+		t.Fatalf("failed to receive: %v", err)
+	}
+	if err := waitSender(t, result); err != nil {
+		t.Fatalf("the share failed: %v", err)
+	}
+
+	// Nor are they for a closed share
+	_, err = receiver.Preview(context.Background(), listener.Addr().String(), 10)
+	if !errors.Is(err, lnkerrors.ShareClosed) {
+		t.Errorf("got %v, want the share closed", err)
+	}
+}
+
+func TestTransferReportsFailuresByEntryName(t *testing.T) {
+	src, dest := t.TempDir(), t.TempDir()
+	writeTree(t, filepath.Join(src, "project"), map[string][]byte{"a.txt": []byte("first")})
+	if err := os.Symlink(filepath.Join(src, "nowhere"), filepath.Join(src, "project", "broken")); err != nil {
+		t.Skipf("symbolic links unavailable: %v", err)
+	}
+
+	logs := new(bytes.Buffer)
+	var failed []string
+	sender := newTestSender(filepath.Join(src, "missing.txt"), filepath.Join(src, "project"))
+	sender.MaxDownloads = 1
+	sender.Logger = log.New(logs, logs)
+	sender.Events = event.SinkFunc(func(ev event.Event) {
+		if ev.Type == event.ERROR {
+			failed = append(failed, ev.File)
+		}
+	})
+	addr, result := startSender(t, sender)
+
+	newTestReceiver(addr, dest).Connect()
+	if err := waitSender(t, result); !errors.Is(err, lnkerrors.TransferIncomplete) {
+		t.Errorf("got %v, want %v", err, lnkerrors.TransferIncomplete)
+	}
+
+	// As the receiver names them, without the local directories
+	want := []string{"missing.txt", filepath.Join("project", "broken")}
+	if len(failed) != len(want) || failed[0] != want[0] || failed[1] != want[1] {
+		t.Errorf("got failures of %q, want %q", failed, want)
+	}
+	if strings.Contains(logs.String(), "failed to send failed") {
+		t.Errorf("the reason is prefixed twice: %s", logs.String())
+	}
+}
+
+func TestResumeStartingOverTruncatesTheLongerFile(t *testing.T) {
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+
+	conn := newSession(local, event.RECEIVER, nil, log.New(io.Discard, io.Discard))
+	conn.setChunkSize(config.CHUNK_SIZE_LOWER_BOUND)
+	header := &protocol.FileHeader{FileName: "notes.txt", FileSize: 5}
+
+	cases := []struct {
+		name    string
+		partial *partialFile
+	}{
+		{"first attempt", nil},
+		// The file changed on the sender since the attempt that was interrupted
+		{"changed since the last attempt", &partialFile{size: 50, transfer: conn.startFile(header)}},
+	}
+
+	for _, test := range cases {
+		path := filepath.Join(t.TempDir(), "notes.txt")
+		if err := os.WriteFile(path, []byte("a much longer file that was already there"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		file, err := os.OpenFile(path, os.O_RDWR, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		receiver := newTestReceiver("", t.TempDir())
+		receiver.partials = map[string]*partialFile{}
+		if test.partial != nil {
+			receiver.partials[header.FileName] = test.partial
+		}
+
+		transfer, err := receiver.resume(conn, header, file)
+		if err != nil {
+			t.Fatalf("%s: failed to resume: %v", test.name, err)
+		}
+		info, _ := file.Stat()
+		file.Close()
+
+		// Whatever the file held is received again from the start
+		if transfer.bytes != 0 || info.Size() != 0 {
+			t.Errorf("%s: starting at %d bytes of a file of %d", test.name, transfer.bytes, info.Size())
+		}
+	}
+}
+
+func TestShareClosesOnceTheLastDownloadIsDone(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	sender := newTestSender("a.txt")
+	sender.MaxDownloads = 1
+	sender.listener = listener
+
+	// Reach the limit, lose the connection and resume, several times over
+	for i := 0; i < 3; i++ {
+		if !sender.admit() {
+			t.Fatalf("attempt %d: the share should be open", i)
+		}
+		if !sender.isClosed() {
+			t.Fatalf("attempt %d: the limit should close the share", i)
+		}
+		if !sender.refund() {
+			t.Fatalf("attempt %d: the download should be given back", i)
+		}
+		sender.done()
+	}
+
+	// Reopened each time, the listener is still there
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("the listener was closed: %v", err)
+	}
+	conn.Close()
+	if conn, err := listener.Accept(); err == nil {
+		conn.Close()
+	}
+
+	// The listener stays open while the last download is in flight
+	if !sender.admit() {
+		t.Fatal("the share should be open")
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		sender.done()
+	}()
+
+	listener.(*net.TCPListener).SetDeadline(time.Now().Add(TEST_TIMEOUT))
+	if _, err := listener.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("got %v, want the listener closed", err)
+	}
+}
@@ -0,0 +1,613 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/LxrdShadow/linker/internal/config"
+	"github.com/LxrdShadow/linker/pkg/discovery"
+	"github.com/LxrdShadow/linker/pkg/event"
+	"github.com/LxrdShadow/linker/pkg/log"
+	"github.com/LxrdShadow/linker/pkg/progress"
+	"github.com/LxrdShadow/linker/pkg/term"
+	"github.com/LxrdShadow/linker/pkg/transfer"
+	"github.com/LxrdShadow/linker/pkg/util"
+)
+
+type view int
+
+const (
+	FILES_VIEW view = iota
+	SHARE_VIEW
+	RECEIVE_VIEW
+)
+
+var viewNames = []string{"Files", "Share", "Receive"}
+
+const (
+	REDRAW_INTERVAL = 200 * time.Millisecond // The screen is redrawn at most that often
+	LOG_LINES       = 3                      // Latest log messages shown at the bottom
+	LOG_HISTORY     = 100
+)
+
+// The files being shared and the receivers that connected
+type share struct {
+	sender    *transfer.Sender
+	entries   []string
+	receivers []*transferState
+	cursor    int
+	closed    bool // No longer accepting receivers
+	ended     bool // Every transfer is over
+}
+
+// The senders found on the network, the address typed by the user and the transfer from that sender
+type receive struct {
+	input   string
+	editing bool
+
+	peers      []discovery.Peer
+	cursor     int
+	previewing string             // Sender whose manifest is being listed
+	manifest   *transfer.Manifest // Of the previewed sender, nil until listed
+	previewed  discovery.Peer
+
+	receiver *transfer.Receiver
+	state    *transferState
+	scroll   int // Rows hidden below the last visible one
+	running  bool
+}
+
+// Interactive interface to share local files and receive files from a sender
+type App struct {
+	conf    *util.FlagConfig
+	history event.Sink // Also receives the events of the transfers, nil without history
+
+	mu      sync.Mutex
+	view    view
+	browser *browser
+	share   *share
+	receive *receive
+	message string // Result of the last action
+
+	// Senders announced on the network, nil when discovery is unavailable
+	discovery    *discovery.Browser
+	discoveryErr error
+
+	logMu sync.Mutex
+	logs  []string
+
+	changed chan struct{}
+}
+
+func newApp(conf *util.FlagConfig, history event.Sink) *App {
+	return &App{
+		conf:    conf,
+		history: history,
+		browser: newBrowser("."),
+		receive: &receive{},
+		changed: make(chan struct{}, 1),
+	}
+}
+
+// Run the interface until the user quits, the events of the transfers also go to history when not nil
+func Run(conf *util.FlagConfig, history event.Sink) error {
+	in, out := os.Stdin, os.Stdout
+	if !term.IsTerminal(in) || !term.IsTerminal(out) {
+		return fmt.Errorf("'%s' has to be run in a terminal", util.TUI_COMMAND)
+	}
+
+	state, err := term.MakeRaw(in)
+	if err != nil {
+		return fmt.Errorf("failed to put the terminal in raw mode: %w", err)
+	}
+	defer term.Restore(in, state)
+
+	fmt.Fprint(out, ENTER_ALTERNATE_SCREEN)
+	defer fmt.Fprint(out, LEAVE_ALTERNATE_SCREEN)
+
+	app := newApp(conf, history)
+	app.discovery, app.discoveryErr = discovery.Browse(config.DISCOVERY_ADDR, config.DISCOVERY_TTL, app.refreshPeers)
+	if app.discovery != nil {
+		defer app.discovery.Close()
+	}
+
+	// The logs are shown at the bottom of the interface, which also replaces the progress bars
+	log.SetOutput(app.logWriter())
+	log.SetErrorOutput(app.logWriter())
+	progress.SetOutput(io.Discard)
+	defer func() {
+		log.SetOutput(os.Stdout)
+		log.SetErrorOutput(os.Stderr)
+		progress.SetOutput(os.Stdout)
+	}()
+
+	// Ctrl-C is a key in raw mode, the signals sent by other processes quit the same way
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	app.loop(in, out, signals)
+
+	return nil
+}
+
+func (a *App) loop(in, out *os.File, signals <-chan os.Signal) {
+	keys := make(chan []key)
+	go readKeys(in, keys)
+
+	ticker := time.NewTicker(REDRAW_INTERVAL)
+	defer ticker.Stop()
+
+	a.draw(out)
+	dirty := false
+	width, height := term.Size(out)
+
+	for {
+		select {
+		case pressed, ok := <-keys:
+			if !ok {
+				a.stop()
+				return
+			}
+
+			for _, k := range pressed {
+				if !a.handleKey(k) {
+					a.stop()
+					return
+				}
+			}
+			a.draw(out)
+			dirty = false
+
+		case <-signals:
+			a.stop()
+			return
+
+		case <-a.changed:
+			dirty = true
+
+		case <-ticker.C:
+			if newWidth, newHeight := term.Size(out); newWidth != width || newHeight != height {
+				width, height = newWidth, newHeight
+				dirty = true
+			}
+
+			if dirty {
+				a.draw(out)
+				dirty = false
+			}
+		}
+	}
+}
+
+func readKeys(in *os.File, keys chan<- []key) {
+	buf := make([]byte, 64)
+
+	for {
+		n, err := in.Read(buf)
+		if err != nil {
+			close(keys)
+			return
+		}
+
+		keys <- parseKeys(buf[:n])
+	}
+}
+
+// Ask for a redraw
+func (a *App) redraw() {
+	select {
+	case a.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Handle a key, returns false when the user quits
+func (a *App) handleKey(k key) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.message = ""
+
+	switch {
+	case k.code == KEY_CTRL_C:
+		return false
+	case k.code == KEY_TAB:
+		a.view = (a.view + 1) % view(len(viewNames))
+		return true
+	case k.code == KEY_RUNE && k.r == 'q' && !(a.view == RECEIVE_VIEW && a.receive.editing):
+		return false
+	}
+
+	switch a.view {
+	case FILES_VIEW:
+		a.handleFilesKey(k)
+	case SHARE_VIEW:
+		a.handleShareKey(k)
+	case RECEIVE_VIEW:
+		a.handleReceiveKey(k)
+	}
+
+	return true
+}
+
+func (a *App) handleFilesKey(k key) {
+	switch {
+	case k.code == KEY_UP || k.r == 'k':
+		a.browser.move(-1)
+	case k.code == KEY_DOWN || k.r == 'j':
+		a.browser.move(1)
+	case k.code == KEY_RIGHT || k.code == KEY_ENTER || k.r == 'l':
+		a.browser.open()
+	case k.code == KEY_LEFT || k.code == KEY_BACKSPACE || k.r == 'h':
+		a.browser.parent()
+	case k.r == ' ':
+		a.browser.toggle()
+		a.browser.move(1)
+	case k.r == 's':
+		a.startShare()
+	}
+}
+
+func (a *App) handleShareKey(k key) {
+	if a.share == nil {
+		return
+	}
+
+	var selected *transferState
+	if a.share.cursor < len(a.share.receivers) {
+		selected = a.share.receivers[a.share.cursor]
+	}
+
+	switch {
+	case k.code == KEY_UP || k.r == 'k':
+		a.share.cursor = max(0, a.share.cursor-1)
+	case k.code == KEY_DOWN || k.r == 'j':
+		a.share.cursor = max(0, min(len(a.share.receivers)-1, a.share.cursor+1))
+	case k.r == 'a' && selected != nil && selected.decision != nil:
+		selected.decision <- true
+		selected.decision = nil
+	case k.r == 'd' && selected != nil && selected.decision != nil:
+		selected.decision <- false
+		selected.decision = nil
+	case k.r == 'c' && selected != nil && selected.status == STATUS_TRANSFERRING:
+		selected.status = STATUS_CANCELED
+		a.share.sender.Disconnect(selected.peer)
+	case k.r == 'x' && !a.share.closed:
+		a.share.closed = true
+		a.share.sender.Close()
+		a.message = "no longer accepting receivers, the transfers in progress go on"
+	}
+}
+
+func (a *App) handleReceiveKey(k key) {
+	r := a.receive
+
+	if r.editing {
+		switch k.code {
+		case KEY_RUNE:
+			r.input += string(k.r)
+		case KEY_BACKSPACE:
+			if runes := []rune(r.input); len(runes) > 0 {
+				r.input = string(runes[:len(runes)-1])
+			}
+		case KEY_ENTER:
+			a.startReceive()
+		case KEY_ESCAPE:
+			r.editing = false
+		}
+		return
+	}
+
+	switch {
+	case k.r == 'e' && !r.running:
+		r.editing = true
+	case k.r == 'c' && r.running:
+		r.state.status = STATUS_CANCELED
+		r.receiver.Cancel()
+	case k.code == KEY_ESCAPE && !r.running:
+		// Back to the list of the senders
+		if r.manifest == nil {
+			r.state = nil
+		}
+		r.manifest = nil
+		r.scroll = 0
+
+	case r.state != nil:
+		switch {
+		case k.code == KEY_ENTER && !r.running:
+			a.startReceive()
+		case k.code == KEY_UP || k.r == 'k':
+			r.scroll = min(max(0, len(r.state.files)-1), r.scroll+1)
+		case k.code == KEY_DOWN || k.r == 'j':
+			r.scroll = max(0, r.scroll-1)
+		}
+
+	case r.manifest != nil:
+		switch {
+		case k.code == KEY_ENTER:
+			r.input = r.previewed.Addr
+			a.startReceive()
+		case k.code == KEY_UP || k.r == 'k':
+			r.scroll = max(0, r.scroll-1)
+		case k.code == KEY_DOWN || k.r == 'j':
+			r.scroll = min(max(0, len(r.manifest.Files)-1), r.scroll+1)
+		}
+
+	default:
+		switch {
+		case k.code == KEY_ENTER && r.cursor < len(r.peers):
+			a.startPreview(r.peers[r.cursor])
+		case k.code == KEY_ENTER:
+			a.startReceive()
+		case k.code == KEY_UP || k.r == 'k':
+			r.cursor = max(0, r.cursor-1)
+		case k.code == KEY_DOWN || k.r == 'j':
+			r.cursor = max(0, min(len(r.peers)-1, r.cursor+1))
+		}
+	}
+}
+
+// Keep the senders found on the network, called by the browser when they change
+func (a *App) refreshPeers() {
+	peers := a.discovery.Peers()
+
+	a.mu.Lock()
+	r := a.receive
+	// The cursor stays on the same sender when the others come and go
+	selected := ""
+	if r.cursor < len(r.peers) {
+		selected = r.peers[r.cursor].Addr
+	}
+	r.peers = peers
+	r.cursor = max(0, min(len(peers)-1, r.cursor))
+	for i, peer := range peers {
+		if peer.Addr == selected {
+			r.cursor = i
+		}
+	}
+	a.mu.Unlock()
+	a.redraw()
+}
+
+// List the files of a sender found on the network, before downloading them
+func (a *App) startPreview(peer discovery.Peer) {
+	r := a.receive
+	if r.previewing != "" {
+		return
+	}
+	r.previewing = peer.Addr
+
+	receiver := transfer.NewReceiver(a.conf)
+	go func() {
+		manifest, err := receiver.Preview(context.Background(), peer.PreviewAddr, config.PREVIEW_MAX_FILES)
+
+		a.mu.Lock()
+		r.previewing = ""
+		switch {
+		case err != nil:
+			a.message = err.Error()
+		case r.cursor < len(r.peers) && r.peers[r.cursor].Addr == peer.Addr && r.state == nil:
+			// Unless the user moved on
+			r.manifest = manifest
+			r.previewed = peer
+			r.scroll = 0
+		}
+		a.mu.Unlock()
+		a.redraw()
+	}()
+}
+
+// Share the selected files, the receivers have to be accepted in the share view
+func (a *App) startShare() {
+	if a.share != nil && !a.share.ended {
+		a.message = "already sharing, stop the share first (x in the Share view)"
+		return
+	}
+
+	entries := a.browser.selection()
+	if len(entries) == 0 {
+		a.message = "nothing to share in this directory"
+		return
+	}
+
+	sender := transfer.NewSender(a.conf)
+	sender.Entries = entries
+	sender.Events = event.Tee(a, a.history)
+	sender.Approve = a.approve
+
+	// The receivers find the share on the network and can preview it
+	ctx, stopAnnouncing := context.WithCancel(context.Background())
+	sender.OnListen = func(addr string) {
+		go func() {
+			if err := discovery.Share(ctx, sender, addr, config.DISCOVERY_ADDR); err != nil {
+				log.Warningf("the share can't be discovered: %s\n", err.Error())
+			}
+		}()
+	}
+
+	sh := &share{sender: sender, entries: entries}
+	a.share = sh
+	a.view = SHARE_VIEW
+
+	go func() {
+		err := sender.Listen()
+		stopAnnouncing()
+
+		a.mu.Lock()
+		sh.ended = true
+		sh.closed = true
+		if err != nil {
+			a.message = err.Error()
+		}
+		a.mu.Unlock()
+		a.redraw()
+	}()
+}
+
+// Connect to the address typed by the user
+func (a *App) startReceive() {
+	r := a.receive
+
+	addr := strings.TrimSpace(r.input)
+	host, port, err := util.GetHostPortFromAddr(addr)
+	if err != nil {
+		a.message = err.Error()
+		return
+	}
+
+	receiver := transfer.NewReceiver(a.conf)
+	receiver.Addr, receiver.Host, receiver.Port = addr, host, port
+	receiver.ChunkSize = config.CHUNK_SIZE_UPPER_BOUND
+	receiver.Events = event.Tee(a, a.history)
+	receiver.Progress = nil
+
+	state := newTransferState(addr, STATUS_CONNECTING)
+	r.receiver = receiver
+	r.state = state
+	r.manifest = nil
+	r.scroll = 0
+	r.editing = false
+	r.running = true
+
+	go func() {
+		err := receiver.Connect()
+
+		a.mu.Lock()
+		r.running = false
+		if err != nil && state.status != STATUS_CANCELED {
+			state.status = STATUS_FAILED
+			state.err = err.Error()
+		}
+		a.mu.Unlock()
+		a.redraw()
+	}()
+}
+
+// Called by the sender for each receiver, waits for the user to accept or deny it
+func (a *App) approve(peer string) bool {
+	decision := make(chan bool, 1)
+
+	a.mu.Lock()
+	state := newTransferState(peer, STATUS_WAITING)
+	state.decision = decision
+	sh := a.share
+	sh.receivers = append(sh.receivers, state)
+	a.mu.Unlock()
+	a.redraw()
+
+	accepted := <-decision
+
+	a.mu.Lock()
+	if accepted {
+		state.status = STATUS_CONNECTING
+	} else {
+		state.status = STATUS_DENIED
+	}
+	a.mu.Unlock()
+	a.redraw()
+
+	return accepted
+}
+
+// Receive the events of the transfers, from their goroutines
+func (a *App) Emit(ev event.Event) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var state *transferState
+
+	switch ev.Role {
+	case event.SENDER:
+		if a.share == nil {
+			return
+		}
+		for _, receiver := range a.share.receivers {
+			if receiver.peer == ev.Peer {
+				state = receiver
+			}
+		}
+	case event.RECEIVER:
+		state = a.receive.state
+	}
+
+	if state != nil {
+		state.handle(ev)
+		a.redraw()
+	}
+}
+
+// Stop everything before quitting, without waiting for the transfers
+func (a *App) stop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if sh := a.share; sh != nil && !sh.ended {
+		sh.sender.Close()
+		for _, receiver := range sh.receivers {
+			if receiver.decision != nil {
+				receiver.decision <- false
+				receiver.decision = nil
+			}
+			sh.sender.Disconnect(receiver.peer)
+		}
+	}
+
+	if a.receive.running {
+		a.receive.receiver.Cancel()
+	}
+}
+
+// Writer keeping the latest lines of the logs
+func (a *App) logWriter() io.Writer {
+	return logWriter{a}
+}
+
+type logWriter struct {
+	app *App
+}
+
+func (w logWriter) Write(p []byte) (int, error) {
+	a := w.app
+
+	a.logMu.Lock()
+	for _, line := range strings.Split(stripColors(string(p)), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			a.logs = append(a.logs, line)
+		}
+	}
+	if len(a.logs) > LOG_HISTORY {
+		a.logs = a.logs[len(a.logs)-LOG_HISTORY:]
+	}
+	a.logMu.Unlock()
+	a.redraw()
+
+	return len(p), nil
+}
+
+// Remove the color escape sequences of a text
+func stripColors(text string) string {
+	var builder strings.Builder
+
+	for {
+		start := strings.Index(text, "\x1b[")
+		if start < 0 {
+			builder.WriteString(text)
+			return builder.String()
+		}
+		builder.WriteString(text[:start])
+
+		end := strings.IndexByte(text[start:], 'm')
+		if end < 0 {
+			return builder.String()
+		}
+		text = text[start+end+1:]
+	}
+}
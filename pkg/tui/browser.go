@@ -0,0 +1,132 @@
+package tui
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Lists the local files and keeps the ones selected to be shared
+type browser struct {
+	dir      string
+	entries  []os.DirEntry
+	cursor   int
+	offset   int
+	selected map[string]bool // Absolute paths
+	err      error
+}
+
+func newBrowser(dir string) *browser {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+
+	b := &browser{
+		dir:      dir,
+		selected: make(map[string]bool),
+	}
+	b.load()
+
+	return b
+}
+
+// Read the current directory, the directories come first
+func (b *browser) load() {
+	entries, err := os.ReadDir(b.dir)
+	b.err = err
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].IsDir() != entries[j].IsDir() {
+			return entries[i].IsDir()
+		}
+		return strings.ToLower(entries[i].Name()) < strings.ToLower(entries[j].Name())
+	})
+
+	b.entries = entries
+	b.cursor = 0
+	b.offset = 0
+}
+
+func (b *browser) move(delta int) {
+	b.cursor = max(0, min(len(b.entries)-1, b.cursor+delta))
+}
+
+// Path of the entry under the cursor, empty when the directory is empty
+func (b *browser) current() string {
+	if b.cursor >= len(b.entries) {
+		return ""
+	}
+
+	return filepath.Join(b.dir, b.entries[b.cursor].Name())
+}
+
+// Open the directory under the cursor
+func (b *browser) open() {
+	if b.cursor >= len(b.entries) || !b.entries[b.cursor].IsDir() {
+		return
+	}
+
+	b.dir = b.current()
+	b.load()
+}
+
+// Go to the parent directory, with the cursor on the one we come from
+func (b *browser) parent() {
+	child := filepath.Base(b.dir)
+	parent := filepath.Dir(b.dir)
+	if parent == b.dir {
+		return
+	}
+
+	b.dir = parent
+	b.load()
+
+	for i, entry := range b.entries {
+		if entry.Name() == child {
+			b.cursor = i
+		}
+	}
+}
+
+// Select or unselect the entry under the cursor
+func (b *browser) toggle() {
+	path := b.current()
+	if path == "" {
+		return
+	}
+
+	if b.selected[path] {
+		delete(b.selected, path)
+	} else {
+		b.selected[path] = true
+	}
+}
+
+// Entries to share: the selected ones, or the one under the cursor
+func (b *browser) selection() []string {
+	if len(b.selected) == 0 {
+		if path := b.current(); path != "" {
+			return []string{path}
+		}
+		return nil
+	}
+
+	paths := make([]string, 0, len(b.selected))
+	for path := range b.selected {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+
+	return paths
+}
+
+// Keep the cursor within the visible lines
+func (b *browser) scroll(height int) {
+	if b.cursor < b.offset {
+		b.offset = b.cursor
+	} else if b.cursor >= b.offset+height {
+		b.offset = b.cursor - height + 1
+	}
+}
@@ -0,0 +1,265 @@
+package tui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/LxrdShadow/linker/internal/config"
+	"github.com/LxrdShadow/linker/pkg/color"
+	"github.com/LxrdShadow/linker/pkg/term"
+)
+
+// Keys of each view, shown at the bottom
+var viewHelp = map[view]string{
+	FILES_VIEW:   "↑/↓ move  →/enter open  ←/backspace back  space select  s share  tab next view  q quit",
+	SHARE_VIEW:   "↑/↓ move  a accept  d deny  c cancel the transfer  x stop sharing  tab next view  q quit",
+	RECEIVE_VIEW: "↑/↓ select  enter preview, then download  esc back  e type an address  c cancel  tab next view  q quit",
+}
+
+const EDITING_HELP = "type the address of the sender (host:port)  enter connect  esc done  tab next view"
+
+func (a *App) draw(out *os.File) {
+	width, height := term.Size(out)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	f := &frame{width: width}
+
+	// Tabs, the current one in reverse video
+	tabs := " lnkr "
+	for i, name := range viewNames {
+		if view(i) == a.view {
+			tabs += " " + REVERSE + " " + name + " " + RESET
+		} else {
+			tabs += "  " + name + " "
+		}
+	}
+	f.lines = append(f.lines, tabs)
+	f.add("")
+
+	// Header, logs, message and help take the other lines
+	bodyHeight := max(1, height-2-(LOG_LINES+1)-2)
+
+	switch a.view {
+	case FILES_VIEW:
+		a.drawFiles(f, bodyHeight)
+	case SHARE_VIEW:
+		a.drawShare(f, bodyHeight)
+	case RECEIVE_VIEW:
+		a.drawReceive(f, bodyHeight)
+	}
+	f.lines = f.lines[:min(len(f.lines), 2+bodyHeight)]
+	f.pad(2 + bodyHeight)
+
+	f.add(strings.Repeat("─", width))
+	a.logMu.Lock()
+	logs := a.logs[max(0, len(a.logs)-LOG_LINES):]
+	for _, line := range logs {
+		f.addColored(color.GRAY, line)
+	}
+	a.logMu.Unlock()
+	f.pad(2 + bodyHeight + 1 + LOG_LINES)
+
+	f.addColored(color.YELLOW, a.message)
+	help := viewHelp[a.view]
+	if a.view == RECEIVE_VIEW && a.receive.editing {
+		help = EDITING_HELP
+	}
+	f.addReversed(help)
+
+	fmt.Fprint(out, f.String())
+}
+
+func (a *App) drawFiles(f *frame, height int) {
+	b := a.browser
+
+	f.add(fmt.Sprintf("%s  (%d selected)", b.dir, len(b.selected)))
+	height--
+
+	if b.err != nil {
+		f.addColored(color.RED, b.err.Error())
+		return
+	}
+	if len(b.entries) == 0 {
+		f.add("  (empty directory)")
+		return
+	}
+
+	b.scroll(height)
+	for i := b.offset; i < len(b.entries) && i < b.offset+height; i++ {
+		entry := b.entries[i]
+
+		mark := "[ ]"
+		if b.selected[filepath.Join(b.dir, entry.Name())] {
+			mark = "[x]"
+		}
+
+		name := entry.Name()
+		if entry.IsDir() {
+			name += "/"
+		}
+
+		line := fmt.Sprintf(" %s %s", mark, name)
+		if i == b.cursor {
+			f.addReversed(line)
+		} else {
+			f.add(line)
+		}
+	}
+}
+
+func (a *App) drawShare(f *frame, height int) {
+	sh := a.share
+	if sh == nil {
+		f.add("Nothing is shared yet: select files in the Files view and press s.")
+		return
+	}
+
+	status := "accepting receivers"
+	if sh.ended {
+		status = "stopped"
+	} else if sh.closed {
+		status = "closed, finishing the transfers in progress"
+	}
+	f.add(fmt.Sprintf("Sharing on %s (%s)", sh.sender.Addr, status))
+
+	names := make([]string, len(sh.entries))
+	for i, entry := range sh.entries {
+		names[i] = filepath.Base(entry)
+	}
+	f.add("Files: " + strings.Join(names, ", "))
+	f.add("")
+
+	if len(sh.receivers) == 0 {
+		f.add("No receiver yet, they can connect with:")
+		f.add(fmt.Sprintf("  lnkr receive -addr %s", sh.sender.Addr))
+		return
+	}
+
+	f.add("Receivers:")
+	for i, receiver := range sh.receivers {
+		line := fmt.Sprintf(" %-21s %s", receiver.peer, receiver.describe())
+		if i == sh.cursor {
+			f.addReversed(line)
+		} else {
+			f.addColored(statusColor(receiver.status), line)
+		}
+
+		if row := receiver.current(); row != nil {
+			f.add(fmt.Sprintf("   %s %s", formatProgress(row), row.name))
+		}
+	}
+}
+
+func (a *App) drawReceive(f *frame, height int) {
+	r := a.receive
+
+	cursor := ""
+	if r.editing {
+		cursor = "█"
+	}
+	f.add("Sender address: " + r.input + cursor)
+	f.add(fmt.Sprintf("Files are saved to %s", a.conf.ReceiveDir))
+	f.add("")
+	height -= 3
+
+	state := r.state
+	if state == nil && r.manifest != nil {
+		a.drawManifest(f, height)
+		return
+	}
+	if state == nil {
+		a.drawPeers(f, height)
+		return
+	}
+
+	f.addColored(statusColor(state.status), fmt.Sprintf("%s: %s", state.peer, state.describe()))
+	height--
+	if state.err != "" {
+		f.addColored(color.RED, state.err)
+		height--
+	}
+
+	// The latest files are shown, unless the user scrolled up
+	end := max(0, min(len(state.files), len(state.files)-r.scroll))
+	start := max(0, end-height)
+	for _, row := range state.files[start:max(start, end)] {
+		progress := row.status
+		if row.status == STATUS_TRANSFERRING {
+			progress = formatProgress(row)
+		}
+
+		f.addColored(statusColor(row.status), fmt.Sprintf(" %-30s %s", progress, row.name))
+	}
+}
+
+// The senders found on the network
+func (a *App) drawPeers(f *frame, height int) {
+	r := a.receive
+
+	if a.discoveryErr != nil {
+		f.addColored(color.RED, "Discovery unavailable: "+a.discoveryErr.Error())
+		f.add("Press e and type the address shown by the sender, as in 192.168.1.10:9090.")
+		return
+	}
+	if len(r.peers) == 0 {
+		f.add("Looking for senders on the network...")
+		f.add("Press e to type the address shown by the sender instead, as in 192.168.1.10:9090.")
+		return
+	}
+
+	f.add("Senders on the network:")
+	height--
+
+	offset := max(0, r.cursor-height+1)
+	for i := offset; i < len(r.peers) && i < offset+height; i++ {
+		peer := r.peers[i]
+
+		line := fmt.Sprintf(" %-24s %-21s %s", peer.Name, peer.Addr, describeFiles(peer.Files, peer.Bytes))
+		if peer.Addr == r.previewing {
+			line += "  listing the files..."
+		}
+		if i == r.cursor {
+			f.addReversed(line)
+		} else {
+			f.add(line)
+		}
+	}
+}
+
+// The files of the selected sender, before downloading them
+func (a *App) drawManifest(f *frame, height int) {
+	r := a.receive
+	m := r.manifest
+
+	f.add(fmt.Sprintf("Files of %s (%s): %s", r.previewed.Name, r.previewed.Addr, describeFiles(m.TotalFiles, m.TotalBytes)))
+	height--
+
+	if m.Truncated {
+		height--
+	}
+	end := min(len(m.Files), r.scroll+height)
+	for _, file := range m.Files[min(r.scroll, end):end] {
+		size := formatBytes(file.Size)
+		if file.Size == config.UNKNOWN_SIZE {
+			size = "stream"
+		}
+
+		f.add(fmt.Sprintf(" %12s  %s", size, file.Name))
+	}
+	if m.Truncated {
+		f.addColored(color.GRAY, fmt.Sprintf(" only the first %d files are listed", len(m.Files)))
+	}
+}
+
+// Number of files and their size, as announced by a sender
+func describeFiles(files, bytes uint64) string {
+	if bytes == config.UNKNOWN_SIZE {
+		return fmt.Sprintf("%d files, with a stream", files)
+	}
+
+	return fmt.Sprintf("%d files, %s", files, formatBytes(bytes))
+}
@@ -0,0 +1,91 @@
+package tui
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+type keyCode int
+
+const (
+	KEY_RUNE keyCode = iota
+	KEY_UP
+	KEY_DOWN
+	KEY_LEFT
+	KEY_RIGHT
+	KEY_ENTER
+	KEY_BACKSPACE
+	KEY_TAB
+	KEY_ESCAPE
+	KEY_CTRL_C
+)
+
+// A key pressed by the user, r is only set for KEY_RUNE
+type key struct {
+	code keyCode
+	r    rune
+}
+
+// Escape sequences of the arrows, in normal and application cursor mode
+var arrows = map[string]keyCode{
+	"\x1b[A": KEY_UP,
+	"\x1b[B": KEY_DOWN,
+	"\x1b[C": KEY_RIGHT,
+	"\x1b[D": KEY_LEFT,
+	"\x1bOA": KEY_UP,
+	"\x1bOB": KEY_DOWN,
+	"\x1bOC": KEY_RIGHT,
+	"\x1bOD": KEY_LEFT,
+}
+
+// Split the bytes read from a terminal in raw mode into keys, unknown sequences are dropped
+func parseKeys(buf []byte) []key {
+	var keys []key
+
+	for len(buf) > 0 {
+		if buf[0] == 0x1b {
+			if len(buf) >= 3 {
+				if code, ok := arrows[string(buf[:3])]; ok {
+					keys = append(keys, key{code: code})
+					buf = buf[3:]
+					continue
+				}
+			}
+
+			if len(buf) == 1 || (buf[1] != '[' && buf[1] != 'O') {
+				keys = append(keys, key{code: KEY_ESCAPE})
+				buf = buf[1:]
+				continue
+			}
+
+			// Skip the other sequences, they end with a byte between '@' and '~'
+			end := bytes.IndexFunc(buf[2:], func(r rune) bool { return r >= '@' && r <= '~' })
+			if end < 0 {
+				return keys
+			}
+			buf = buf[2+end+1:]
+			continue
+		}
+
+		switch buf[0] {
+		case '\r', '\n':
+			keys = append(keys, key{code: KEY_ENTER})
+		case 0x7f, 0x08:
+			keys = append(keys, key{code: KEY_BACKSPACE})
+		case '\t':
+			keys = append(keys, key{code: KEY_TAB})
+		case 0x03:
+			keys = append(keys, key{code: KEY_CTRL_C})
+		default:
+			r, size := utf8.DecodeRune(buf)
+			if r >= ' ' && r != utf8.RuneError {
+				keys = append(keys, key{code: KEY_RUNE, r: r})
+			}
+			buf = buf[size:]
+			continue
+		}
+		buf = buf[1:]
+	}
+
+	return keys
+}
@@ -0,0 +1,107 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/LxrdShadow/linker/pkg/color"
+	"github.com/LxrdShadow/linker/pkg/util"
+)
+
+const (
+	ENTER_ALTERNATE_SCREEN = "\x1b[?1049h\x1b[?25l" // Also hides the cursor
+	LEAVE_ALTERNATE_SCREEN = "\x1b[?25h\x1b[?1049l"
+	CURSOR_HOME            = "\x1b[H"
+	CLEAR_TO_END           = "\x1b[J"
+	REVERSE                = "\x1b[7m"
+	RESET                  = "\x1b[0m"
+)
+
+// Lines of the screen being built, each one fits in the width
+type frame struct {
+	width int
+	lines []string
+}
+
+// Add a line, cut or padded to the width
+func (f *frame) add(text string) {
+	f.lines = append(f.lines, fit(text, f.width))
+}
+
+// Add a line in reverse video, to show the cursor or the current tab
+func (f *frame) addReversed(text string) {
+	f.lines = append(f.lines, REVERSE+fit(text, f.width)+RESET)
+}
+
+// Add a line with a color, when colors are enabled
+func (f *frame) addColored(colorCode int, text string) {
+	if colorCode == 0 {
+		f.add(text)
+		return
+	}
+	f.lines = append(f.lines, color.Sprint(colorCode, fit(text, f.width)))
+}
+
+// Fill the frame with empty lines up to the height
+func (f *frame) pad(height int) {
+	for len(f.lines) < height {
+		f.add("")
+	}
+}
+
+// Get the whole screen, drawn from the top left corner.
+// The terminal is in raw mode, the lines end with "\r\n"
+func (f *frame) String() string {
+	return CURSOR_HOME + strings.Join(f.lines, "\r\n") + CLEAR_TO_END
+}
+
+// Cut or pad a text to the width
+func fit(text string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+
+	length := utf8.RuneCountInString(text)
+	if length > width {
+		runes := []rune(text)
+		return string(runes[:max(0, width-1)]) + "…"
+	}
+
+	return text + strings.Repeat(" ", width-length)
+}
+
+func formatBytes(bytes uint64) string {
+	unit, denom := util.ByteDecodeUnit(bytes)
+	return fmt.Sprintf("%.2f%s", float64(bytes)/float64(denom), unit)
+}
+
+// Small progress bar followed by the percentage, or the bytes of a stream
+func formatProgress(row *fileRow) string {
+	if row.stream {
+		return formatBytes(row.bytes)
+	}
+
+	percent := 100
+	if row.size > 0 {
+		percent = int(row.bytes * 100 / row.size)
+	}
+
+	const width = 20
+	filled := percent * width / 100
+	return fmt.Sprintf("[%s%s] %3d%%", strings.Repeat("=", filled), strings.Repeat(" ", width-filled), percent)
+}
+
+// Color of a status, 0 for the default color
+func statusColor(status string) int {
+	switch status {
+	case STATUS_DONE:
+		return color.GREEN
+	case STATUS_FAILED, STATUS_DENIED, STATUS_CANCELED:
+		return color.RED
+	case STATUS_WAITING:
+		return color.YELLOW
+	}
+
+	return 0
+}
@@ -0,0 +1,139 @@
+package tui
+
+import (
+	"fmt"
+
+	"github.com/LxrdShadow/linker/pkg/event"
+)
+
+// Status of a transfer, as shown in the interface
+const (
+	STATUS_WAITING      = "waiting for approval"
+	STATUS_CONNECTING   = "connecting"
+	STATUS_TRANSFERRING = "transferring"
+	STATUS_DONE         = "done"
+	STATUS_FAILED       = "failed"
+	STATUS_DENIED       = "denied"
+	STATUS_CANCELED     = "canceled"
+)
+
+// A file announced during a transfer
+type fileRow struct {
+	name   string
+	size   uint64
+	bytes  uint64
+	stream bool
+	status string
+}
+
+// Progress of a session with a peer, built from its events
+type transferState struct {
+	peer       string
+	status     string
+	totalFiles uint64
+	totalBytes uint64 // 0 when unknown, as when a stream is shared
+	done       uint64
+	failed     uint64
+	bytes      uint64 // Of the files done
+	err        string
+	files      []*fileRow
+
+	// Set while waiting for the user to accept or deny the receiver
+	decision chan bool
+}
+
+func newTransferState(peer, status string) *transferState {
+	return &transferState{peer: peer, status: status}
+}
+
+// File being transferred, nil between two files
+func (t *transferState) current() *fileRow {
+	if len(t.files) == 0 {
+		return nil
+	}
+
+	if row := t.files[len(t.files)-1]; row.status == STATUS_TRANSFERRING {
+		return row
+	}
+
+	return nil
+}
+
+func (t *transferState) handle(ev event.Event) {
+	switch ev.Type {
+	case event.SESSION_START:
+		t.status = STATUS_TRANSFERRING
+
+	case event.MANIFEST:
+		t.totalFiles = ev.Files
+		t.totalBytes = ev.Size
+
+	case event.FILE_START:
+		t.files = append(t.files, &fileRow{
+			name:   ev.File,
+			size:   ev.Size,
+			stream: ev.Stream,
+			status: STATUS_TRANSFERRING,
+		})
+
+	case event.PROGRESS:
+		if row := t.current(); row != nil {
+			row.bytes = ev.Bytes
+		}
+
+	case event.FILE_DONE:
+		t.done++
+		t.bytes += ev.Bytes
+		if row := t.current(); row != nil {
+			row.bytes = ev.Bytes
+			row.status = STATUS_DONE
+		}
+
+	case event.ERROR:
+		t.failed++
+		t.err = ev.Error
+
+		if row := t.current(); row != nil && row.name == ev.File {
+			row.status = STATUS_FAILED
+		} else if ev.File != "" {
+			t.files = append(t.files, &fileRow{name: ev.File, status: STATUS_FAILED})
+		} else if t.status != STATUS_CANCELED {
+			// The whole session failed
+			t.status = STATUS_FAILED
+		}
+
+	case event.SUMMARY:
+		if t.status == STATUS_TRANSFERRING {
+			t.status = STATUS_DONE
+		}
+	}
+}
+
+// Bytes transferred so far, including the current file
+func (t *transferState) transferred() uint64 {
+	bytes := t.bytes
+	if row := t.current(); row != nil {
+		bytes += row.bytes
+	}
+
+	return bytes
+}
+
+// Short description of the state: status, files and bytes
+func (t *transferState) describe() string {
+	text := t.status
+	if t.failed > 0 {
+		text += fmt.Sprintf(", %d failed", t.failed)
+	}
+
+	if t.totalFiles == 0 {
+		return text
+	}
+
+	text += fmt.Sprintf(" - %d/%d files - %s", t.done, t.totalFiles, formatBytes(t.transferred()))
+	if t.totalBytes > 0 {
+		text += " / " + formatBytes(t.totalBytes)
+	}
+
+	return text
+}
@@ -0,0 +1,208 @@
+package tui
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/LxrdShadow/linker/pkg/discovery"
+	"github.com/LxrdShadow/linker/pkg/event"
+	"github.com/LxrdShadow/linker/pkg/log"
+	"github.com/LxrdShadow/linker/pkg/transfer"
+	"github.com/LxrdShadow/linker/pkg/util"
+)
+
+func TestParseKeys(t *testing.T) {
+	cases := []struct {
+		input string
+		want  []key
+	}{
+		{"a", []key{{code: KEY_RUNE, r: 'a'}}},
+		{"é", []key{{code: KEY_RUNE, r: 'é'}}},
+		{"\x1b[A\x1b[B", []key{{code: KEY_UP}, {code: KEY_DOWN}}},
+		{"\x1bOC", []key{{code: KEY_RIGHT}}},
+		{"\x1b", []key{{code: KEY_ESCAPE}}},
+		{"\r\t\x7f\x03", []key{{code: KEY_ENTER}, {code: KEY_TAB}, {code: KEY_BACKSPACE}, {code: KEY_CTRL_C}}},
+		{"\x1b[3~x", []key{{code: KEY_RUNE, r: 'x'}}}, // Delete is not used
+	}
+
+	for _, test := range cases {
+		if got := parseKeys([]byte(test.input)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %v want %v", test.input, got, test.want)
+		}
+	}
+}
+
+func TestBrowser(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "sub"), 0755)
+	os.WriteFile(filepath.Join(dir, "b.txt"), nil, 0644)
+	os.WriteFile(filepath.Join(dir, "A.txt"), nil, 0644)
+	os.WriteFile(filepath.Join(dir, "sub", "c.txt"), nil, 0644)
+
+	b := newBrowser(dir)
+	names := []string{}
+	for _, entry := range b.entries {
+		names = append(names, entry.Name())
+	}
+	if want := []string{"sub", "A.txt", "b.txt"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("got %v want %v", names, want)
+	}
+
+	// Nothing selected: the entry under the cursor is shared
+	if got, want := b.selection(), []string{filepath.Join(dir, "sub")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+
+	b.move(2)
+	b.toggle()
+	b.open() // Not a directory
+	b.move(-2)
+	b.open()
+	b.toggle()
+	b.parent()
+
+	want := []string{filepath.Join(dir, "b.txt"), filepath.Join(dir, "sub", "c.txt")}
+	if got := b.selection(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+	if b.cursor != 0 {
+		t.Errorf("the cursor should be back on the directory, got %d", b.cursor)
+	}
+}
+
+func TestTransferState(t *testing.T) {
+	state := newTransferState("127.0.0.1:9090", STATUS_CONNECTING)
+
+	for _, ev := range []event.Event{
+		{Type: event.SESSION_START},
+		{Type: event.MANIFEST, Files: 3, Size: 300},
+		{Type: event.FILE_START, File: "a", Size: 100},
+		{Type: event.PROGRESS, File: "a", Bytes: 40},
+	} {
+		state.handle(ev)
+	}
+
+	if row := state.current(); row == nil || row.bytes != 40 {
+		t.Fatalf("expected a at 40 bytes, got %+v", row)
+	}
+	if got, want := state.describe(), "transferring - 0/3 files - 40.00B / 300.00B"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+
+	for _, ev := range []event.Event{
+		{Type: event.FILE_DONE, File: "a", Bytes: 100},
+		{Type: event.ERROR, File: "b", Error: "permission denied"},
+		{Type: event.SUMMARY},
+	} {
+		state.handle(ev)
+	}
+
+	if got, want := state.describe(), "done, 1 failed - 1/3 files - 100.00B / 300.00B"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if len(state.files) != 2 || state.files[1].status != STATUS_FAILED {
+		t.Errorf("expected b to be failed, got %+v", state.files)
+	}
+}
+
+func TestReceiveViewPreviewsThenDownloads(t *testing.T) {
+	src, dest := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "a.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := &util.FlagConfig{Network: "tcp", Addr: "127.0.0.1:0", ReceiveDir: dest, HandshakeTimeout: 10 * time.Second}
+	sender := transfer.NewSender(conf)
+	sender.Entries = []string{filepath.Join(src, "a.txt")}
+	sender.Logger = log.New(io.Discard, io.Discard)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	listening := make(chan string, 1)
+	sender.OnListen = func(addr string) { listening <- addr }
+	go sender.ListenContext(ctx)
+
+	previews, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer previews.Close()
+	go sender.ServePreview(previews)
+
+	app := newApp(conf, nil)
+	app.view = RECEIVE_VIEW
+	app.receive.peers = []discovery.Peer{
+		{Addr: "127.0.0.1:1", Name: "gone"},
+		{Addr: <-listening, PreviewAddr: previews.Addr().String(), Name: "laptop", Files: 1, Bytes: 5},
+	}
+
+	// Wait until the state of the view is as expected
+	wait := func(what string, done func(r *receive) bool) {
+		t.Helper()
+
+		deadline := time.Now().Add(10 * time.Second)
+		for time.Now().Before(deadline) {
+			app.mu.Lock()
+			ok := done(app.receive)
+			app.mu.Unlock()
+			if ok {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("timed out waiting for %s", what)
+	}
+
+	app.handleKey(key{code: KEY_DOWN})
+	app.handleKey(key{code: KEY_ENTER})
+	wait("the manifest", func(r *receive) bool { return r.manifest != nil })
+
+	if files := app.receive.manifest.Files; len(files) != 1 || files[0].Name != "a.txt" {
+		t.Fatalf("unexpected manifest: %+v", app.receive.manifest)
+	}
+
+	// Back to the senders, and to the manifest again
+	app.handleKey(key{code: KEY_ESCAPE})
+	if app.receive.manifest != nil || app.receive.cursor != 1 {
+		t.Fatalf("expected the list of the senders, got %+v", app.receive)
+	}
+	app.handleKey(key{code: KEY_ENTER})
+	wait("the manifest", func(r *receive) bool { return r.manifest != nil })
+
+	app.handleKey(key{code: KEY_ENTER})
+	wait("the download", func(r *receive) bool { return r.state != nil && !r.running })
+
+	if app.receive.state.status != STATUS_DONE {
+		t.Errorf("got %s: %s", app.receive.state.status, app.receive.state.err)
+	}
+	if content, err := os.ReadFile(filepath.Join(dest, "a.txt")); err != nil || string(content) != "hello" {
+		t.Errorf("got %q, %v", content, err)
+	}
+}
+
+func TestScrollingAnEmptyReceiveView(t *testing.T) {
+	out, err := os.Create(filepath.Join(t.TempDir(), "screen"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	app := newApp(&util.FlagConfig{}, nil)
+	app.view = RECEIVE_VIEW
+	app.receive.state = newTransferState("127.0.0.1:9090", STATUS_CONNECTING)
+
+	// No file was announced yet
+	for _, k := range []key{{code: KEY_DOWN}, {code: KEY_UP}, {code: KEY_DOWN}} {
+		app.handleKey(k)
+		if app.receive.scroll != 0 {
+			t.Fatalf("scrolled to %d without any file", app.receive.scroll)
+		}
+		app.draw(out)
+	}
+}
@@ -0,0 +1,218 @@
+package util
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	CONFIG_ENV_VAR = "LNKR_CONFIG" // Overrides the path of the configuration file
+	ENV_VAR_PREFIX = "LNKR_"       // Prefix of the environment variables giving flag values
+	PROFILE_PREFIX = "@"           // Prefix of a profile name, as in `lnkr receive @buildbox`
+)
+
+// Options of the configuration file by section:
+// "" for every command, "send", "receive" or "tui" for one command and "@name" for a profile
+type configSections map[string]map[string]string
+
+// Get the path of the configuration file ($XDG_CONFIG_HOME/lnkr/config on Linux)
+func ConfigFilePath() (string, error) {
+	if path := os.Getenv(CONFIG_ENV_VAR); path != "" {
+		return path, nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the configuration directory: %w", err)
+	}
+
+	return filepath.Join(dir, "lnkr", "config"), nil
+}
+
+// Separate the profile (@name) from the rest of the command arguments
+func getProfile(args []string) ([]string, string) {
+	if len(args) > 0 && strings.HasPrefix(args[0], PROFILE_PREFIX) {
+		return args[1:], strings.TrimPrefix(args[0], PROFILE_PREFIX)
+	}
+
+	return args, ""
+}
+
+// Fill the flags that were not given on the command line.
+// Precedence: flags > environment variables > profile > command section > global section
+func applyConfigFile(cmd *flag.FlagSet, known func(string) bool, profile string) error {
+	sections, err := loadConfigFile(known)
+	if err != nil {
+		return err
+	}
+
+	layers := []map[string]string{sections[""], sections[cmd.Name()]}
+
+	if profile != "" {
+		options, ok := sections[PROFILE_PREFIX+profile]
+		if !ok {
+			return fmt.Errorf("%s: no such profile in the configuration file", profile)
+		}
+		layers = append(layers, options)
+	}
+
+	layers = append(layers, getEnvOptions(cmd))
+
+	options := make(map[string]string)
+	for _, layer := range layers {
+		mergeOptions(options, layer)
+	}
+
+	given := make(map[string]bool)
+	cmd.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	for name, value := range options {
+		if cmd.Lookup(name) == nil || given[name] || overriddenAddress(name, given) {
+			continue
+		}
+
+		if err := cmd.Set(name, expandHome(value)); err != nil {
+			return fmt.Errorf("invalid value %q for '%s' in the configuration: %w", value, name, err)
+		}
+	}
+
+	return nil
+}
+
+// Read the configuration file, a missing file is the same as an empty one
+func loadConfigFile(known func(string) bool) (configSections, error) {
+	path, err := ConfigFilePath()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return configSections{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the configuration file: %w", err)
+	}
+	defer file.Close()
+
+	sections, err := parseConfigFile(file, known)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return sections, nil
+}
+
+// Parse the "key = value" lines of a configuration file grouped by [section]
+func parseConfigFile(r io.Reader, known func(string) bool) (configSections, error) {
+	sections := configSections{"": {}}
+	section := ""
+	scanner := bufio.NewScanner(r)
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			if section != HOST_COMMAND && section != CONNECT_COMMAND && section != TUI_COMMAND && section != HISTORY_COMMAND && section != BENCH_COMMAND &&
+				!strings.HasPrefix(section, PROFILE_PREFIX) {
+				return nil, fmt.Errorf("line %d: unknown section [%s], expected [%s], [%s], [%s], [%s], [%s] or [@profile]", lineNumber, section, HOST_COMMAND, CONNECT_COMMAND, TUI_COMMAND, HISTORY_COMMAND, BENCH_COMMAND)
+			}
+
+			if _, ok := sections[section]; !ok {
+				sections[section] = make(map[string]string)
+			}
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("line %d: expected 'option = value'", lineNumber)
+		}
+
+		key = strings.TrimPrefix(strings.TrimSpace(key), "-")
+		if !known(key) {
+			return nil, fmt.Errorf("line %d: unknown option '%s'", lineNumber, key)
+		}
+
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
+			value = value[1 : len(value)-1]
+		}
+
+		sections[section][key] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read the configuration file: %w", err)
+	}
+
+	return sections, nil
+}
+
+// Get the flag values given as environment variables (LNKR_RECEIVE_DIR for -receive-dir)
+func getEnvOptions(cmd *flag.FlagSet) map[string]string {
+	options := make(map[string]string)
+
+	cmd.VisitAll(func(f *flag.Flag) {
+		name := ENV_VAR_PREFIX + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		if value, ok := os.LookupEnv(name); ok {
+			options[f.Name] = value
+		}
+	})
+
+	return options
+}
+
+// Add a layer of options on top of the previous ones.
+// 'addr' and 'host'/'port' can't be used together so the latest layer wins
+func mergeOptions(options, layer map[string]string) {
+	for name, value := range layer {
+		switch name {
+		case "addr":
+			delete(options, "host")
+			delete(options, "port")
+		case "host", "port":
+			delete(options, "addr")
+		}
+
+		options[name] = value
+	}
+}
+
+// Check if the address given on the command line overrides this option
+func overriddenAddress(name string, given map[string]bool) bool {
+	switch name {
+	case "addr":
+		return given["host"] || given["port"]
+	case "host", "port":
+		return given["addr"]
+	}
+
+	return false
+}
+
+// Replace a leading ~ with the home directory
+func expandHome(value string) string {
+	if value != "~" && !strings.HasPrefix(value, "~/") {
+		return value
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return value
+	}
+
+	return filepath.Join(home, strings.TrimPrefix(value, "~"))
+}
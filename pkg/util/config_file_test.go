@@ -0,0 +1,126 @@
+package util
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testConfig = `
+# defaults for every command
+port = 9090
+chunk-size = 1MB
+
+[receive]
+receive-dir = /tmp/received
+
+[@buildbox]
+addr = 10.0.0.5:7070
+receive-dir = "/tmp/builds"
+`
+
+func newTestReceiveCmd() *flag.FlagSet {
+	cmd := flag.NewFlagSet(CONNECT_COMMAND, flag.ContinueOnError)
+	cmd.String("addr", "", "")
+	cmd.String("host", "", "")
+	cmd.String("port", "", "")
+	cmd.String("receive-dir", "", "")
+	cmd.String("chunk-size", "16MB", "")
+
+	return cmd
+}
+
+func writeTestConfig(t *testing.T, content string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(CONFIG_ENV_VAR, path)
+}
+
+func TestApplyConfigFile(t *testing.T) {
+	cases := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "file defaults",
+			want: map[string]string{"port": "9090", "chunk-size": "1MB", "receive-dir": "/tmp/received", "addr": ""},
+		},
+		{
+			name: "profile over file defaults",
+			args: []string{"@buildbox"},
+			want: map[string]string{"addr": "10.0.0.5:7070", "port": "", "receive-dir": "/tmp/builds"},
+		},
+		{
+			name: "environment over profile",
+			args: []string{"@buildbox"},
+			env:  map[string]string{"LNKR_RECEIVE_DIR": "/tmp/env"},
+			want: map[string]string{"addr": "10.0.0.5:7070", "receive-dir": "/tmp/env"},
+		},
+		{
+			name: "flags over everything",
+			args: []string{"@buildbox", "-receive-dir", "/tmp/flag", "-addr", "127.0.0.1:8080"},
+			env:  map[string]string{"LNKR_RECEIVE_DIR": "/tmp/env"},
+			want: map[string]string{"addr": "127.0.0.1:8080", "port": "", "receive-dir": "/tmp/flag"},
+		},
+		{
+			name: "host on the command line replaces the address",
+			args: []string{"@buildbox", "-host", "127.0.0.1", "-port", "8080"},
+			want: map[string]string{"addr": "", "host": "127.0.0.1", "port": "8080"},
+		},
+		{
+			name:    "unknown profile",
+			args:    []string{"@nowhere"},
+			wantErr: true,
+		},
+	}
+
+	writeTestConfig(t, testConfig)
+	known := func(name string) bool { return newTestReceiveCmd().Lookup(name) != nil }
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			for key, value := range test.env {
+				t.Setenv(key, value)
+			}
+
+			cmd := newTestReceiveCmd()
+			args, profile := getProfile(test.args)
+			cmd.Parse(args)
+
+			err := applyConfigFile(cmd, known, profile)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for name, want := range test.want {
+				if got := cmd.Lookup(name).Value.String(); got != want {
+					t.Errorf("%s mismatch: got %q want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseConfigFileErrors(t *testing.T) {
+	known := func(name string) bool { return name == "port" }
+
+	for _, content := range []string{"colour = red", "[elsewhere]", "port 9090"} {
+		if _, err := parseConfigFile(strings.NewReader(content), known); err == nil {
+			t.Errorf("expected an error for %q", content)
+		}
+	}
+}
@@ -7,25 +7,67 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/LxrdShadow/linker/internal/config"
+	"github.com/LxrdShadow/linker/pkg/color"
+	"github.com/LxrdShadow/linker/pkg/event"
+	"github.com/LxrdShadow/linker/pkg/fault"
 )
 
 type FlagConfig struct {
 	Mode, Addr, Host, Port, Network, ReceiveDir string
 	Entries                                     []string
+	MaxDownloads                                int
+	Expire                                      time.Duration
+	StreamName                                  string
+	Stdout                                      bool
+	FileProgress                                bool
+	ChunkSize                                   uint32
+	JSON                                        bool
+	EventsFD                                    int
+	Verbose, Quiet                              bool
+	LogFile                                     string
+	Color                                       string
+	HandshakeTimeout, IdleTimeout, KeepAlive    time.Duration
+	Retries                                     int
+	RetryDelay, RetryMaxDelay                   time.Duration
+	NoHistory                                   bool
+	Faults                                      *fault.Schedule
+	MetricsAddr                                 string
+
+	// Query of the history command
+	HistorySession, HistoryPeer, HistoryFile string
+	HistoryRole                              string
+	HistorySince, HistoryUntil               time.Time
+	HistoryLimit                             int
+
+	// Settings of the bench command
+	BenchServe      bool
+	BenchDisk       bool
+	BenchSize       uint64
+	BenchFiles      int
+	BenchChunkSizes []uint32
 }
 
 const (
 	HOST_COMMAND    = "send"
 	CONNECT_COMMAND = "receive"
+	TUI_COMMAND     = "tui"
+	HISTORY_COMMAND = "history"
+	BENCH_COMMAND   = "bench"
 )
 
+// Flags left out of the help, they are meant for debugging
+const DEBUG_FAULTS_FLAG = "debug-faults"
+
 // Parse the flags given by the user
 func ParseFlags(args []string) (*FlagConfig, error) {
 	if len(args) < 2 {
-		return nil, fmt.Errorf("expected '%s' or '%s' subcommands\n", HOST_COMMAND, CONNECT_COMMAND)
+		return nil, fmt.Errorf("expected '%s', '%s', '%s', '%s' or '%s' subcommands", HOST_COMMAND, CONNECT_COMMAND, TUI_COMMAND, HISTORY_COMMAND, BENCH_COMMAND)
 	}
 
 	flag.Usage = appUsage
@@ -36,24 +78,231 @@ func ParseFlags(args []string) (*FlagConfig, error) {
 	sendAddr := sendCmd.String("addr", "", "Address for the server (host:port)")
 	sendHost := sendCmd.String("host", "", "Host IP for the server")
 	sendPort := sendCmd.String("port", "", "Port for the server")
+	sendOnce := sendCmd.Bool("once", false, "Stop sharing after the first download")
+	sendMaxDownloads := sendCmd.Int("max-downloads", 0, "Stop sharing after N downloads (0 means unlimited)")
+	sendExpire := sendCmd.Duration("expire", 0, "Stop sharing after the given duration (e.g. 30m)")
+	sendName := sendCmd.String("name", config.STREAM_NAME, "Name given to the data read from stdin ('-')")
+	sendChunkSize := sendCmd.String("chunk-size", "64KB", "Chunk size proposed to the receivers (4KB to 16MB)")
+	sendJSON := sendCmd.Bool("json", false, "Print newline-delimited JSON events on stdout, logs go to stderr")
+	sendEventsFD := sendCmd.Int("events-fd", 0, "Write the JSON events to this file descriptor instead of stdout")
+	sendVerbose := sendCmd.Bool("v", false, "Print debug messages, including every protocol message")
+	sendQuiet := sendCmd.Bool("q", false, "Only print errors")
+	sendLogFile := sendCmd.String("log-file", "", "Also append the logs to this file")
+	sendColor := sendCmd.String("color", color.AUTO, "When to use colors: auto, always or never (auto respects NO_COLOR)")
+	sendHandshakeTimeout := sendCmd.Duration("handshake-timeout", config.HANDSHAKE_TIMEOUT, "Longest wait for the peer while connecting and setting up the session (0 waits forever)")
+	sendIdleTimeout := sendCmd.Duration("idle-timeout", config.IDLE_TIMEOUT, "Longest wait for the peer during the transfer (0 waits forever)")
+	sendKeepAlive := sendCmd.Duration("keepalive", config.KEEPALIVE_INTERVAL, "Interval of the TCP keepalive probes (0 disables them)")
+	sendNoHistory := sendCmd.Bool("no-history", false, "Don't keep the sessions in the history")
+	sendMetricsAddr := sendCmd.String("metrics-addr", "", "Serve Prometheus metrics on http://host:port/metrics")
+	sendFaults := sendCmd.String(DEBUG_FAULTS_FLAG, "", "Inject faults in the connections (e.g. seed=1,latency=50ms,disconnect=1MB)")
+	hideFlags(sendCmd, DEBUG_FAULTS_FLAG)
 
 	receiveCmd := flag.NewFlagSet(CONNECT_COMMAND, flag.ExitOnError)
 	receiveAddr := receiveCmd.String("addr", "", "Address of the server (host:port)")
 	receiveHost := receiveCmd.String("host", "", "Host IP of the server")
 	receivePort := receiveCmd.String("port", "", "Port of the server")
 	receiveDir := receiveCmd.String("receive-dir", config.RECEIVE_DIRECTORY, "Directory to store the received files")
+	receiveStdout := receiveCmd.Bool("stdout", false, "Write the received data to stdout instead of files")
+	receiveChunkSize := receiveCmd.String("chunk-size", "16MB", "Largest chunk size accepted from the sender (4KB to 16MB)")
+	receiveFileProgress := receiveCmd.Bool("file-progress", true, "Show the progress of the current file beneath the progress of the session")
+	receiveJSON := receiveCmd.Bool("json", false, "Print newline-delimited JSON events on stdout, logs go to stderr")
+	receiveEventsFD := receiveCmd.Int("events-fd", 0, "Write the JSON events to this file descriptor instead of stdout")
+	receiveVerbose := receiveCmd.Bool("v", false, "Print debug messages, including every protocol message")
+	receiveQuiet := receiveCmd.Bool("q", false, "Only print errors")
+	receiveLogFile := receiveCmd.String("log-file", "", "Also append the logs to this file")
+	receiveColor := receiveCmd.String("color", color.AUTO, "When to use colors: auto, always or never (auto respects NO_COLOR)")
+	receiveHandshakeTimeout := receiveCmd.Duration("handshake-timeout", config.HANDSHAKE_TIMEOUT, "Longest wait for the peer while connecting and setting up the session (0 waits forever)")
+	receiveIdleTimeout := receiveCmd.Duration("idle-timeout", config.IDLE_TIMEOUT, "Longest wait for the peer during the transfer (0 waits forever)")
+	receiveKeepAlive := receiveCmd.Duration("keepalive", config.KEEPALIVE_INTERVAL, "Interval of the TCP keepalive probes (0 disables them)")
+	receiveRetries := receiveCmd.Int("retries", config.RETRIES, "Reconnect that many times when the connection is lost, resuming the transfer (0 disables it)")
+	receiveRetryDelay := receiveCmd.Duration("retry-delay", config.RETRY_DELAY, "Wait before the first reconnection, doubled after each one")
+	receiveRetryMaxDelay := receiveCmd.Duration("retry-max-delay", config.RETRY_MAX_DELAY, "Longest wait between two reconnections")
+	receiveNoHistory := receiveCmd.Bool("no-history", false, "Don't keep the sessions in the history")
+	receiveMetricsAddr := receiveCmd.String("metrics-addr", "", "Serve Prometheus metrics on http://host:port/metrics")
+	receiveFaults := receiveCmd.String(DEBUG_FAULTS_FLAG, "", "Inject faults in the connections (e.g. seed=1,latency=50ms,disconnect=1MB)")
+	hideFlags(receiveCmd, DEBUG_FAULTS_FLAG)
+
+	tuiCmd := flag.NewFlagSet(TUI_COMMAND, flag.ExitOnError)
+	tuiAddr := tuiCmd.String("addr", "", "Address to share the files on (host:port)")
+	tuiHost := tuiCmd.String("host", "", "Host IP to share the files on")
+	tuiPort := tuiCmd.String("port", "", "Port to share the files on")
+	tuiDir := tuiCmd.String("receive-dir", config.RECEIVE_DIRECTORY, "Directory to store the received files")
+	tuiChunkSize := tuiCmd.String("chunk-size", "64KB", "Chunk size proposed to the receivers (4KB to 16MB)")
+	tuiVerbose := tuiCmd.Bool("v", false, "Show debug messages, including every protocol message")
+	tuiLogFile := tuiCmd.String("log-file", "", "Also append the logs to this file")
+	tuiColor := tuiCmd.String("color", color.AUTO, "When to use colors: auto, always or never (auto respects NO_COLOR)")
+	tuiHandshakeTimeout := tuiCmd.Duration("handshake-timeout", config.HANDSHAKE_TIMEOUT, "Longest wait for the peer while connecting and setting up the session (0 waits forever)")
+	tuiIdleTimeout := tuiCmd.Duration("idle-timeout", config.IDLE_TIMEOUT, "Longest wait for the peer during the transfer (0 waits forever)")
+	tuiKeepAlive := tuiCmd.Duration("keepalive", config.KEEPALIVE_INTERVAL, "Interval of the TCP keepalive probes (0 disables them)")
+	tuiRetries := tuiCmd.Int("retries", config.RETRIES, "Reconnect that many times when the connection is lost, resuming the transfer (0 disables it)")
+	tuiRetryDelay := tuiCmd.Duration("retry-delay", config.RETRY_DELAY, "Wait before the first reconnection, doubled after each one")
+	tuiRetryMaxDelay := tuiCmd.Duration("retry-max-delay", config.RETRY_MAX_DELAY, "Longest wait between two reconnections")
+	tuiNoHistory := tuiCmd.Bool("no-history", false, "Don't keep the sessions in the history")
+
+	historyCmd := flag.NewFlagSet(HISTORY_COMMAND, flag.ExitOnError)
+	historyPeer := historyCmd.String("peer", "", "Only the sessions with a peer whose address contains this")
+	historyFile := historyCmd.String("file", "", "Only the sessions with a file whose name contains this")
+	historySince := historyCmd.String("since", "", "Only the sessions since a date (2006-01-02, 2006-01-02 15:04) or for a duration (e.g. 48h)")
+	historyUntil := historyCmd.String("until", "", "Only the sessions before a date (the day is included) or a duration ago")
+	historyDirection := historyCmd.String("direction", "", "Only the files 'sent' or 'received'")
+	historyLimit := historyCmd.Int("n", 20, "Show that many of the most recent sessions (0 shows them all)")
+	historyJSON := historyCmd.Bool("json", false, "Print the sessions as newline-delimited JSON")
+	historyColor := historyCmd.String("color", color.AUTO, "When to use colors: auto, always or never (auto respects NO_COLOR)")
+
+	benchCmd := flag.NewFlagSet(BENCH_COMMAND, flag.ExitOnError)
+	benchAddr := benchCmd.String("addr", "", "Address of a peer running 'bench -serve' (host:port), both ends run here when empty")
+	benchServe := benchCmd.Bool("serve", false, "Share the synthetic data with the benchmarks of other peers, on -addr")
+	benchSize := benchCmd.String("size", "256MB", "Amount of synthetic data sent by each run")
+	benchFiles := benchCmd.Int("files", 1, "Number of files the data is split in, more than one needs -disk")
+	benchDisk := benchCmd.Bool("disk", false, "Read and write the data in a temporary directory instead of memory")
+	benchChunkSize := benchCmd.String("chunk-size", "64KB,1MB,16MB", "Chunk sizes to compare, separated by commas, one run each")
+	benchVerbose := benchCmd.Bool("v", false, "Print debug messages, including every protocol message")
+	benchColor := benchCmd.String("color", color.AUTO, "When to use colors: auto, always or never (auto respects NO_COLOR)")
+
+	// Options of the configuration file can belong to any of the commands
+	known := func(name string) bool {
+		return sendCmd.Lookup(name) != nil || receiveCmd.Lookup(name) != nil || tuiCmd.Lookup(name) != nil || historyCmd.Lookup(name) != nil ||
+			benchCmd.Lookup(name) != nil
+	}
 
 	var config *FlagConfig
 	var err error
 
 	switch args[1] {
 	case HOST_COMMAND:
-		sendCmd.Parse(args[2:])
+		flagArgs, profile := getProfile(args[2:])
+		sendCmd.Parse(flagArgs)
+		if err := applyConfigFile(sendCmd, known, profile); err != nil {
+			return nil, err
+		}
+
 		config, err = getSendConfig(sendCmd, sendAddr, sendHost, sendPort)
+		if err == nil {
+			config.StreamName = *sendName
+			err = setShareLifetime(config, *sendOnce, *sendMaxDownloads, *sendExpire)
+		}
+		if err == nil {
+			config.ChunkSize, err = getChunkSize(*sendChunkSize)
+		}
+		if err == nil {
+			err = setEventOutput(config, *sendJSON, *sendEventsFD)
+		}
+		if err == nil {
+			err = setVerbosity(config, *sendVerbose, *sendQuiet, *sendLogFile)
+		}
+		if err == nil {
+			err = setColorMode(config, *sendColor)
+		}
+		if err == nil {
+			err = setTimeouts(config, *sendHandshakeTimeout, *sendIdleTimeout, *sendKeepAlive)
+		}
+		if err == nil {
+			config.NoHistory = *sendNoHistory
+			config.Faults, err = getFaultSchedule(*sendFaults)
+		}
+		if err == nil {
+			err = setMetricsAddr(config, *sendMetricsAddr)
+		}
 
 	case CONNECT_COMMAND:
-		receiveCmd.Parse(args[2:])
+		flagArgs, profile := getProfile(args[2:])
+		receiveCmd.Parse(flagArgs)
+		if err := applyConfigFile(receiveCmd, known, profile); err != nil {
+			return nil, err
+		}
+
 		config, err = getReceiveConfig(receiveAddr, receiveHost, receivePort, receiveDir)
+		if err == nil {
+			config.Stdout = *receiveStdout
+			config.FileProgress = *receiveFileProgress
+			config.ChunkSize, err = getChunkSize(*receiveChunkSize)
+		}
+		if err == nil {
+			err = setEventOutput(config, *receiveJSON, *receiveEventsFD)
+		}
+		if err == nil {
+			err = setVerbosity(config, *receiveVerbose, *receiveQuiet, *receiveLogFile)
+		}
+		if err == nil {
+			err = setColorMode(config, *receiveColor)
+		}
+		if err == nil {
+			err = setTimeouts(config, *receiveHandshakeTimeout, *receiveIdleTimeout, *receiveKeepAlive)
+		}
+		if err == nil {
+			err = setRetries(config, *receiveRetries, *receiveRetryDelay, *receiveRetryMaxDelay)
+		}
+		if err == nil {
+			config.NoHistory = *receiveNoHistory
+			config.Faults, err = getFaultSchedule(*receiveFaults)
+		}
+		if err == nil {
+			err = setMetricsAddr(config, *receiveMetricsAddr)
+		}
+
+	case TUI_COMMAND:
+		flagArgs, profile := getProfile(args[2:])
+		tuiCmd.Parse(flagArgs)
+		if err := applyConfigFile(tuiCmd, known, profile); err != nil {
+			return nil, err
+		}
+
+		config, err = getTuiConfig(tuiAddr, tuiHost, tuiPort, tuiDir)
+		if err == nil {
+			config.ChunkSize, err = getChunkSize(*tuiChunkSize)
+		}
+		if err == nil {
+			err = setVerbosity(config, *tuiVerbose, false, *tuiLogFile)
+		}
+		if err == nil {
+			err = setColorMode(config, *tuiColor)
+		}
+		if err == nil {
+			err = setTimeouts(config, *tuiHandshakeTimeout, *tuiIdleTimeout, *tuiKeepAlive)
+		}
+		if err == nil {
+			err = setRetries(config, *tuiRetries, *tuiRetryDelay, *tuiRetryMaxDelay)
+		}
+		if err == nil {
+			config.NoHistory = *tuiNoHistory
+		}
+
+	case HISTORY_COMMAND:
+		flagArgs, profile := getProfile(args[2:])
+		historyCmd.Parse(flagArgs)
+		if err := applyConfigFile(historyCmd, known, profile); err != nil {
+			return nil, err
+		}
+
+		config, err = getHistoryConfig(historyCmd, *historyPeer, *historyFile, *historyDirection, *historyLimit)
+		if err == nil {
+			config.JSON = *historyJSON
+			err = setHistoryDates(config, *historySince, *historyUntil, time.Now())
+		}
+		if err == nil {
+			err = setColorMode(config, *historyColor)
+		}
+
+	case BENCH_COMMAND:
+		flagArgs, profile := getProfile(args[2:])
+		benchCmd.Parse(flagArgs)
+		if err := applyConfigFile(benchCmd, known, profile); err != nil {
+			return nil, err
+		}
+
+		config, err = getBenchConfig(*benchAddr, *benchServe, *benchSize, *benchFiles, *benchDisk, *benchChunkSize)
+		if err == nil {
+			err = setVerbosity(config, *benchVerbose, false, "")
+		}
+		if err == nil {
+			err = setColorMode(config, *benchColor)
+		}
+		if err == nil {
+			config.NoHistory = true
+		}
+
+	default:
+		return nil, fmt.Errorf("%s: unknown command, expected '%s', '%s', '%s', '%s' or '%s'", args[1], HOST_COMMAND, CONNECT_COMMAND, TUI_COMMAND, HISTORY_COMMAND, BENCH_COMMAND)
 	}
 
 	if err != nil {
@@ -68,27 +317,54 @@ func getSendConfig(sendCmd *flag.FlagSet, addr, host, port *string) (*FlagConfig
 	entries := sendCmd.Args()
 
 	if len(entries) == 0 {
-		return nil, fmt.Errorf("'%s' have to come with a file\n", HOST_COMMAND)
+		return nil, fmt.Errorf("'%s' have to come with a file", HOST_COMMAND)
 	}
 
+	streams := 0
 	for _, entry := range entries {
+		if entry == config.STDIN_ENTRY {
+			streams++
+			continue
+		}
+
 		if _, err := os.Stat(entry); os.IsNotExist(err) {
 			return nil, fmt.Errorf("%s: no such file or directory", entry)
 		}
 	}
 
+	if streams > 1 {
+		return nil, fmt.Errorf("'%s' (stdin) can only be given once", config.STDIN_ENTRY)
+	}
+
+	addrConf, hostConf, portConf, err := getListenAddress(addr, host, port)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FlagConfig{
+		Network: "tcp",
+		Mode:    HOST_COMMAND,
+		Entries: entries,
+		Addr:    addrConf,
+		Host:    hostConf,
+		Port:    portConf,
+	}, nil
+}
+
+// Get the address to listen on, a local address and a random port are used when they are not given
+func getListenAddress(addr, host, port *string) (string, string, string, error) {
 	var hostConf string
 	var portConf string
 	var addrConf string
 	var err error
 
 	if (!isEmptyString(*host) || !isEmptyString(*port)) && !isEmptyString(*addr) {
-		return nil, fmt.Errorf("'%s' have to only come with 'addr' (host:port) or 'host' and 'port' \n", CONNECT_COMMAND)
+		return "", "", "", fmt.Errorf("'addr' (host:port) can't be used with 'host' and 'port'")
 	} else if !isEmptyString(*addr) {
 		hostConf, portConf, err = GetHostPortFromAddr(*addr)
 		addrConf = *addr
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse address: %w", err)
+			return "", "", "", fmt.Errorf("failed to parse address: %w", err)
 		}
 	} else if isEmptyString(*addr) {
 		if *host != "" {
@@ -96,7 +372,7 @@ func getSendConfig(sendCmd *flag.FlagSet, addr, host, port *string) (*FlagConfig
 		} else {
 			conf, err := getLocalHostAddress()
 			if err != nil {
-				return nil, err
+				return "", "", "", err
 			}
 			hostConf = conf
 
@@ -111,14 +387,223 @@ func getSendConfig(sendCmd *flag.FlagSet, addr, host, port *string) (*FlagConfig
 		addrConf = GetAddrFromHostPort(hostConf, portConf)
 	}
 
-	return &FlagConfig{
-		Network: "tcp",
-		Mode:    HOST_COMMAND,
-		Entries: entries,
-		Addr:    addrConf,
-		Host:    hostConf,
-		Port:    portConf,
-	}, nil
+	return addrConf, hostConf, portConf, nil
+}
+
+// Set the limits after which the sender stops accepting new downloads
+func setShareLifetime(conf *FlagConfig, once bool, maxDownloads int, expire time.Duration) error {
+	if maxDownloads < 0 {
+		return fmt.Errorf("'-max-downloads' can't be negative")
+	}
+
+	if expire < 0 {
+		return fmt.Errorf("'-expire' can't be negative")
+	}
+
+	if once {
+		if maxDownloads > 1 {
+			return fmt.Errorf("'-once' can't be used with '-max-downloads %d'", maxDownloads)
+		}
+		maxDownloads = 1
+	}
+
+	// stdin can only be read by a single receiver
+	if slices.Contains(conf.Entries, config.STDIN_ENTRY) {
+		if maxDownloads > 1 {
+			return fmt.Errorf("sending stdin can't be used with '-max-downloads %d'", maxDownloads)
+		}
+		maxDownloads = 1
+	}
+
+	conf.MaxDownloads = maxDownloads
+	conf.Expire = expire
+
+	return nil
+}
+
+// Parse the chunk size and check that it can be negotiated
+func getChunkSize(size string) (uint32, error) {
+	chunkSize, err := ParseByteSize(size)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse chunk size: %w", err)
+	}
+
+	if chunkSize < config.CHUNK_SIZE_LOWER_BOUND || chunkSize > config.CHUNK_SIZE_UPPER_BOUND {
+		return 0, fmt.Errorf("'-chunk-size' has to be between 4KB and 16MB")
+	}
+
+	return uint32(chunkSize), nil
+}
+
+// Set where the JSON events are written, '-events-fd' alone also enables them
+func setEventOutput(conf *FlagConfig, json bool, eventsFD int) error {
+	if eventsFD < 0 || eventsFD == 1 && conf.Stdout {
+		return fmt.Errorf("'-events-fd %d' is not a valid file descriptor for the events", eventsFD)
+	}
+
+	if json && eventsFD == 0 && conf.Stdout {
+		return fmt.Errorf("'-json' and '-stdout' can't both use stdout, use '-events-fd' for the events")
+	}
+
+	conf.JSON = json || eventsFD > 0
+	conf.EventsFD = eventsFD
+	if conf.JSON && eventsFD == 0 {
+		conf.EventsFD = 1
+	}
+
+	return nil
+}
+
+// Set how much is logged and where
+func setVerbosity(conf *FlagConfig, verbose, quiet bool, logFile string) error {
+	if verbose && quiet {
+		return fmt.Errorf("'-v' and '-q' can't be used together")
+	}
+
+	conf.Verbose = verbose
+	conf.Quiet = quiet
+	conf.LogFile = logFile
+
+	return nil
+}
+
+// Check the value of -color, the colors are decided once the outputs are known
+func setColorMode(conf *FlagConfig, mode string) error {
+	if mode != color.AUTO && mode != color.ALWAYS && mode != color.NEVER {
+		return fmt.Errorf("%s: invalid value for '-color', it should be %s, %s or %s", mode, color.AUTO, color.ALWAYS, color.NEVER)
+	}
+
+	conf.Color = mode
+
+	return nil
+}
+
+// Check the timeouts, they have to leave room for the heartbeats of the peer
+func setTimeouts(conf *FlagConfig, handshake, idle, keepAlive time.Duration) error {
+	timeouts := []struct {
+		name  string
+		value time.Duration
+	}{{"handshake-timeout", handshake}, {"idle-timeout", idle}}
+
+	for _, timeout := range timeouts {
+		if timeout.value < 0 {
+			return fmt.Errorf("'-%s' can't be negative", timeout.name)
+		}
+		if timeout.value > 0 && timeout.value <= config.HEARTBEAT_INTERVAL {
+			return fmt.Errorf("'-%s' has to be longer than %s, the interval of the heartbeats", timeout.name, config.HEARTBEAT_INTERVAL)
+		}
+	}
+
+	if keepAlive < 0 {
+		return fmt.Errorf("'-keepalive' can't be negative")
+	}
+
+	conf.HandshakeTimeout = handshake
+	conf.IdleTimeout = idle
+	conf.KeepAlive = keepAlive
+
+	return nil
+}
+
+// Check the settings of the reconnections
+func setRetries(conf *FlagConfig, retries int, delay, maxDelay time.Duration) error {
+	if retries < 0 {
+		return fmt.Errorf("'-retries' can't be negative")
+	}
+	if delay < 0 {
+		return fmt.Errorf("'-retry-delay' can't be negative")
+	}
+	if maxDelay < delay {
+		return fmt.Errorf("'-retry-max-delay' can't be shorter than '-retry-delay'")
+	}
+
+	conf.Retries = retries
+	conf.RetryDelay = delay
+	conf.RetryMaxDelay = maxDelay
+
+	return nil
+}
+
+// Check the address the metrics are served on, empty when they are not
+func setMetricsAddr(conf *FlagConfig, addr string) error {
+	if addr != "" {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("'-metrics-addr': %w", err)
+		}
+	}
+
+	conf.MetricsAddr = addr
+
+	return nil
+}
+
+// Parse the faults given to -debug-faults as comma-separated key=value pairs, nil when there are none
+func getFaultSchedule(spec string) (*fault.Schedule, error) {
+	if spec == "" {
+		return nil, nil
+	}
+
+	schedule := &fault.Schedule{}
+	for _, pair := range strings.Split(spec, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+
+		var err error
+		switch key {
+		case "seed":
+			schedule.Seed, err = strconv.ParseInt(value, 10, 64)
+		case "latency":
+			schedule.Latency, err = time.ParseDuration(value)
+		case "jitter":
+			schedule.Jitter, err = time.ParseDuration(value)
+		case "bandwidth":
+			schedule.Bandwidth, err = ParseByteSize(value)
+		case "short":
+			schedule.Short, err = parseProbability(value)
+		case "corrupt":
+			schedule.Corrupt, err = parseProbability(value)
+		case "disconnect":
+			schedule.Disconnect, err = ParseByteSize(value)
+		default:
+			return nil, fmt.Errorf("%s: unknown fault for '-%s', it should be seed, latency, jitter, bandwidth, short, corrupt or disconnect", key, DEBUG_FAULTS_FLAG)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("'-%s': invalid %s: %w", DEBUG_FAULTS_FLAG, key, err)
+		}
+	}
+
+	if schedule.Latency < 0 || schedule.Jitter < 0 {
+		return nil, fmt.Errorf("'-%s': the latency and the jitter can't be negative", DEBUG_FAULTS_FLAG)
+	}
+
+	return schedule, nil
+}
+
+// Parse a probability, between 0 and 1
+func parseProbability(value string) (float64, error) {
+	probability, err := strconv.ParseFloat(value, 64)
+	if err != nil || probability < 0 || probability > 1 {
+		return 0, fmt.Errorf("%s: it should be a probability between 0 and 1", value)
+	}
+
+	return probability, nil
+}
+
+// Leave flags out of the help of a command
+func hideFlags(cmd *flag.FlagSet, names ...string) {
+	cmd.Usage = func() {
+		visible := flag.NewFlagSet(cmd.Name(), flag.ContinueOnError)
+		visible.SetOutput(cmd.Output())
+		cmd.VisitAll(func(f *flag.Flag) {
+			if !slices.Contains(names, f.Name) {
+				visible.Var(f.Value, f.Name, f.Usage)
+				visible.Lookup(f.Name).DefValue = f.DefValue
+			}
+		})
+
+		fmt.Fprintf(cmd.Output(), "Usage of %s:\n", cmd.Name())
+		visible.PrintDefaults()
+	}
 }
 
 // Get the configurations for a receive command
@@ -127,9 +612,9 @@ func getReceiveConfig(addr, host, port, receiveDir *string) (*FlagConfig, error)
 	var err error
 
 	if (isEmptyString(*host) || isEmptyString(*port)) && isEmptyString(*addr) {
-		return nil, fmt.Errorf("'%s' have to come with an address (-addr host:port)\n", CONNECT_COMMAND)
+		return nil, fmt.Errorf("'%s' have to come with an address (-addr host:port)", CONNECT_COMMAND)
 	} else if (!isEmptyString(*host) || !isEmptyString(*port)) && !isEmptyString(*addr) {
-		return nil, fmt.Errorf("'%s' have to only come with '-addr' (host:port) or '-host' and '-port' \n", CONNECT_COMMAND)
+		return nil, fmt.Errorf("'%s' have to only come with '-addr' (host:port) or '-host' and '-port' ", CONNECT_COMMAND)
 	} else if !isEmptyString(*addr) {
 		addrConf = *addr
 		hostConf, portConf, err = GetHostPortFromAddr(*addr)
@@ -152,11 +637,147 @@ func getReceiveConfig(addr, host, port, receiveDir *string) (*FlagConfig, error)
 	}, err
 }
 
+// Get the configurations for the interactive interface, the files are chosen in it
+func getTuiConfig(addr, host, port, receiveDir *string) (*FlagConfig, error) {
+	addrConf, hostConf, portConf, err := getListenAddress(addr, host, port)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FlagConfig{
+		Network:    "tcp",
+		Mode:       TUI_COMMAND,
+		Addr:       addrConf,
+		Host:       hostConf,
+		Port:       portConf,
+		ReceiveDir: filepath.Clean(*receiveDir),
+	}, nil
+}
+
+// Get the configurations for the history command, an optional argument gives the session to show
+func getHistoryConfig(historyCmd *flag.FlagSet, peer, file, direction string, limit int) (*FlagConfig, error) {
+	if historyCmd.NArg() > 1 {
+		return nil, fmt.Errorf("'%s' takes at most one session identifier", HISTORY_COMMAND)
+	}
+
+	roles := map[string]string{"": "", "sent": event.SENDER, "received": event.RECEIVER}
+	role, ok := roles[direction]
+	if !ok {
+		return nil, fmt.Errorf("%s: invalid direction, it should be 'sent' or 'received'", direction)
+	}
+
+	if limit < 0 {
+		return nil, fmt.Errorf("'-n' can't be negative")
+	}
+
+	return &FlagConfig{
+		Mode:           HISTORY_COMMAND,
+		HistorySession: historyCmd.Arg(0),
+		HistoryPeer:    peer,
+		HistoryFile:    file,
+		HistoryRole:    role,
+		HistoryLimit:   limit,
+	}, nil
+}
+
+// Get the configurations for the bench command
+func getBenchConfig(addr string, serve bool, size string, files int, disk bool, chunkSizes string) (*FlagConfig, error) {
+	if serve && addr == "" {
+		return nil, fmt.Errorf("'-serve' has to come with an address to listen on (-addr host:port)")
+	}
+
+	conf := &FlagConfig{
+		Network:    "tcp",
+		Mode:       BENCH_COMMAND,
+		Addr:       addr,
+		BenchServe: serve,
+		BenchDisk:  disk,
+		BenchFiles: files,
+	}
+
+	var err error
+	if addr != "" {
+		conf.Host, conf.Port, err = GetHostPortFromAddr(addr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse address: %w", err)
+		}
+	}
+
+	conf.BenchSize, err = ParseByteSize(size)
+	if err != nil {
+		return nil, fmt.Errorf("'-size': %w", err)
+	}
+	if conf.BenchSize == 0 {
+		return nil, fmt.Errorf("'-size' can't be 0")
+	}
+
+	if files < 1 {
+		return nil, fmt.Errorf("'-files' has to be at least 1")
+	}
+	if files > 1 && !disk {
+		return nil, fmt.Errorf("'-files %d' needs '-disk', the data in memory is a single stream", files)
+	}
+
+	for _, size := range strings.Split(chunkSizes, ",") {
+		chunkSize, err := getChunkSize(size)
+		if err != nil {
+			return nil, err
+		}
+		conf.BenchChunkSizes = append(conf.BenchChunkSizes, chunkSize)
+	}
+
+	return conf, nil
+}
+
+// Set the dates of the history query, relative to now
+func setHistoryDates(conf *FlagConfig, since, until string, now time.Time) error {
+	var err error
+
+	conf.HistorySince, err = parseDate(since, now, false)
+	if err != nil {
+		return fmt.Errorf("'-since': %w", err)
+	}
+
+	conf.HistoryUntil, err = parseDate(until, now, true)
+	if err != nil {
+		return fmt.Errorf("'-until': %w", err)
+	}
+
+	return nil
+}
+
+// Parse a local date, a date and time, or a duration back from now.
+// With endOfDay, a date alone stands for the end of that day
+func parseDate(value string, now time.Time, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+
+	if date, err := time.ParseInLocation(time.DateOnly, value, now.Location()); err == nil {
+		if endOfDay {
+			date = date.AddDate(0, 0, 1)
+		}
+		return date, nil
+	}
+
+	for _, layout := range []string{"2006-01-02 15:04", time.DateTime, time.RFC3339} {
+		if date, err := time.ParseInLocation(layout, value, now.Location()); err == nil {
+			return date, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("%s: invalid date, it should look like 2006-01-02, 2006-01-02 15:04 or 48h", value)
+}
+
 // Get the local interface address for the current computer
 func getLocalHostAddress() (string, error) {
 	addrs, err := net.InterfaceAddrs()
 	if err != nil {
-		return "", fmt.Errorf("failed to get host IP address: %w\n", err)
+		return "", fmt.Errorf("failed to get host IP address: %w", err)
 	}
 
 	for _, addr := range addrs {
@@ -179,7 +800,7 @@ func appUsage() {
 	intro := `lnkr (linker) is a simple file transfer program.
 
 Usage:
-	lnkr <command> [command flags] <FILES>`
+	lnkr <command> [@profile] [command flags] <FILES>`
 
 	fmt.Fprintln(os.Stderr, intro)
 	fmt.Fprintln(os.Stderr, "\nCommands:")
@@ -187,6 +808,18 @@ Usage:
 	fmt.Fprintln(os.Stderr, "\t\tcreates a server to send files")
 	fmt.Fprintf(os.Stderr, "\t%s\n", CONNECT_COMMAND)
 	fmt.Fprintln(os.Stderr, "\t\tjoin a send server to receive the files")
+	fmt.Fprintf(os.Stderr, "\t%s\n", TUI_COMMAND)
+	fmt.Fprintln(os.Stderr, "\t\tchoose the files to send and follow the transfers interactively")
+	fmt.Fprintf(os.Stderr, "\t%s\n", HISTORY_COMMAND)
+	fmt.Fprintln(os.Stderr, "\t\tlist the past transfers, or show the files of a session")
+	fmt.Fprintf(os.Stderr, "\t%s\n", BENCH_COMMAND)
+	fmt.Fprintln(os.Stderr, "\t\tmeasure the throughput of transfers of synthetic data")
+
+	if path, err := ConfigFilePath(); err == nil {
+		fmt.Fprintln(os.Stderr, "\nConfiguration:")
+		fmt.Fprintf(os.Stderr, "\tdefaults and @profiles are read from %s\n", path)
+		fmt.Fprintf(os.Stderr, "\tflags can also be given as environment variables (e.g. %sRECEIVE_DIR)\n", ENV_VAR_PREFIX)
+	}
 
 	// fmt.Fprintln(os.Stderr, "\nCommand Flags:")
 	// fmt.Fprintf(os.Stderr, "\t--file  -file\n")
@@ -0,0 +1,146 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSetTimeouts(t *testing.T) {
+	conf := &FlagConfig{}
+	if err := setTimeouts(conf, 10*time.Second, 0, 30*time.Second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if conf.HandshakeTimeout != 10*time.Second || conf.IdleTimeout != 0 || conf.KeepAlive != 30*time.Second {
+		t.Errorf("timeouts mismatch: got %+v", conf)
+	}
+
+	invalid := [][3]time.Duration{
+		{-time.Second, time.Minute, 0}, // Negative handshake timeout
+		{time.Minute, time.Second, 0},  // Idle timeout shorter than the heartbeats
+		{time.Minute, time.Minute, -1}, // Negative keepalive
+	}
+	for _, values := range invalid {
+		if err := setTimeouts(&FlagConfig{}, values[0], values[1], values[2]); err == nil {
+			t.Errorf("expected an error for %v", values)
+		}
+	}
+}
+
+func TestSetRetries(t *testing.T) {
+	conf := &FlagConfig{}
+	if err := setRetries(conf, 5, time.Second, time.Minute); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if conf.Retries != 5 || conf.RetryDelay != time.Second || conf.RetryMaxDelay != time.Minute {
+		t.Errorf("retries mismatch: got %+v", conf)
+	}
+
+	if err := setRetries(&FlagConfig{}, -1, time.Second, time.Minute); err == nil {
+		t.Error("expected an error for a negative number of retries")
+	}
+	if err := setRetries(&FlagConfig{}, 3, time.Minute, time.Second); err == nil {
+		t.Error("expected an error for a longest delay shorter than the first one")
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	now := time.Date(2026, 10, 19, 15, 30, 0, 0, time.UTC)
+
+	cases := []struct {
+		value     string
+		endOfDay  bool
+		want      time.Time
+		shouldErr bool
+	}{
+		{value: "", want: time.Time{}},
+		{value: "48h", want: now.Add(-48 * time.Hour)},
+		{value: "2026-10-01", want: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)},
+		{value: "2026-10-01", endOfDay: true, want: time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC)},
+		{value: "2026-10-01 08:15", endOfDay: true, want: time.Date(2026, 10, 1, 8, 15, 0, 0, time.UTC)},
+		{value: "yesterday", shouldErr: true},
+	}
+
+	for _, test := range cases {
+		got, err := parseDate(test.value, now, test.endOfDay)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("%q: expected an error", test.value)
+			}
+			continue
+		}
+
+		if err != nil || !got.Equal(test.want) {
+			t.Errorf("%q: got %v (%v) want %v", test.value, got, err, test.want)
+		}
+	}
+}
+
+func TestGetFaultSchedule(t *testing.T) {
+	schedule, err := getFaultSchedule("seed=7, latency=20ms,jitter=5ms,bandwidth=1MB,short=0.5,corrupt=0.001,disconnect=64KB")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if schedule.Seed != 7 || schedule.Latency != 20*time.Millisecond || schedule.Jitter != 5*time.Millisecond ||
+		schedule.Bandwidth != 1<<20 || schedule.Short != 0.5 || schedule.Corrupt != 0.001 || schedule.Disconnect != 64<<10 {
+		t.Errorf("schedule mismatch: got %+v", schedule)
+	}
+
+	if schedule, err := getFaultSchedule(""); schedule != nil || err != nil {
+		t.Errorf("got %+v and %v, want no faults", schedule, err)
+	}
+
+	for _, spec := range []string{"drop=1", "short=2", "corrupt=-0.1", "latency=fast", "latency=-1s", "seed"} {
+		if _, err := getFaultSchedule(spec); err == nil {
+			t.Errorf("expected an error for %q", spec)
+		}
+	}
+}
+
+func TestGetBenchConfig(t *testing.T) {
+	conf, err := getBenchConfig("", false, "64MB", 4, true, "4KB,1MB")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if conf.BenchSize != 64<<20 || conf.BenchFiles != 4 || !conf.BenchDisk || len(conf.BenchChunkSizes) != 2 ||
+		conf.BenchChunkSizes[0] != 4<<10 || conf.BenchChunkSizes[1] != 1<<20 {
+		t.Errorf("bench settings mismatch: got %+v", conf)
+	}
+
+	invalid := []struct {
+		addr       string
+		serve      bool
+		size       string
+		files      int
+		disk       bool
+		chunkSizes string
+	}{
+		{serve: true, size: "1MB", files: 1, chunkSizes: "64KB"},     // Serving without an address
+		{size: "0", files: 1, chunkSizes: "64KB"},                    // No data
+		{size: "1MB", files: 0, chunkSizes: "64KB"},                  // No file
+		{size: "1MB", files: 2, chunkSizes: "64KB"},                  // Several files in memory
+		{size: "1MB", files: 1, chunkSizes: "64KB,1KB"},              // Chunk size out of bounds
+		{addr: "no-port", size: "1MB", files: 1, chunkSizes: "64KB"}, // Invalid address
+	}
+	for _, c := range invalid {
+		if _, err := getBenchConfig(c.addr, c.serve, c.size, c.files, c.disk, c.chunkSizes); err == nil {
+			t.Errorf("expected an error for %+v", c)
+		}
+	}
+}
+
+func TestSetMetricsAddr(t *testing.T) {
+	for _, addr := range []string{"", ":9100", "127.0.0.1:9100"} {
+		conf := &FlagConfig{}
+		if err := setMetricsAddr(conf, addr); err != nil || conf.MetricsAddr != addr {
+			t.Errorf("%q: got %q and %v", addr, conf.MetricsAddr, err)
+		}
+	}
+
+	if err := setMetricsAddr(&FlagConfig{}, "9100"); err == nil {
+		t.Error("expected an error for an address without a port")
+	}
+}
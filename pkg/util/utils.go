@@ -2,6 +2,7 @@ package util
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -30,7 +31,7 @@ func GetAddrFromHostPort(host, port string) string {
 // Get the host and the port from an address (host:port)
 func GetHostPortFromAddr(addr string) (string, string, error) {
 	if len(strings.Split(addr, ":")) != 2 {
-		return "", "", fmt.Errorf("%s: wrong address format, it should be host:port\n", addr)
+		return "", "", fmt.Errorf("%s: wrong address format, it should be host:port", addr)
 	}
 
 	host := strings.Split(addr, ":")[0]
@@ -38,3 +39,26 @@ func GetHostPortFromAddr(addr string) (string, string, error) {
 
 	return host, port, nil
 }
+
+// Parse a size like "65536", "64KB" or "1MB" to a number of bytes (1 KB = 1024 bytes)
+func ParseByteSize(size string) (uint64, error) {
+	units := []string{"B", "KB", "MB", "GB"}
+	str := strings.ToUpper(strings.TrimSpace(size))
+	multiplier := uint64(1)
+
+	for i := len(units) - 1; i >= 0; i-- {
+		unit := units[i]
+		if strings.HasSuffix(str, unit) {
+			str = strings.TrimSpace(strings.TrimSuffix(str, unit))
+			multiplier = 1 << (10 * i)
+			break
+		}
+	}
+
+	num, err := strconv.ParseUint(str, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid size, it should look like 65536, 64KB or 1MB", size)
+	}
+
+	return num * multiplier, nil
+}
@@ -61,3 +61,31 @@ func TestByteDecodeUnit(t *testing.T) {
 		}
 	})
 }
+
+func TestParseByteSize(t *testing.T) {
+	cases := map[string]uint64{
+		"65536": 65536,
+		"512B":  512,
+		"64KB":  64 * 1024,
+		"64kb":  64 * 1024,
+		"1MB":   1024 * 1024,
+		"2 GB":  2 * 1024 * 1024 * 1024,
+	}
+
+	for size, want := range cases {
+		got, err := ParseByteSize(size)
+		if err != nil {
+			t.Errorf("unexpected error for %q: %v", size, err)
+		}
+
+		if got != want {
+			t.Errorf("size mismatch for %q: got %d want %d", size, got, want)
+		}
+	}
+
+	for _, size := range []string{"", "MB", "12XB", "-1KB"} {
+		if _, err := ParseByteSize(size); err == nil {
+			t.Errorf("expected an error for %q", size)
+		}
+	}
+}
@@ -25,7 +25,7 @@ const (
 // Parse the flags given by the user
 func ParseFlags(args []string) (*FlagConfig, error) {
 	if len(args) < 2 {
-		return nil, fmt.Errorf("expected '%s' or '%s' subcommands\n", HOST_COMMAND, CONNECT_COMMAND)
+		return nil, fmt.Errorf("expected '%s' or '%s' subcommands", HOST_COMMAND, CONNECT_COMMAND)
 	}
 
 	flag.Usage = appUsage
@@ -67,7 +67,7 @@ func getSendConfig(sendCmd *flag.FlagSet, addr, host, port *string) (*FlagConfig
 	entries := sendCmd.Args()
 
 	if len(entries) == 0 {
-		return nil, fmt.Errorf("'%s' have to come with a file\n", HOST_COMMAND)
+		return nil, fmt.Errorf("'%s' have to come with a file", HOST_COMMAND)
 	}
 
 	for _, entry := range entries {
@@ -82,7 +82,7 @@ func getSendConfig(sendCmd *flag.FlagSet, addr, host, port *string) (*FlagConfig
 	var err error
 
 	if (!isEmptyString(*host) || !isEmptyString(*port)) && !isEmptyString(*addr) {
-		return nil, fmt.Errorf("'%s' have to only come with 'addr' (host:port) or 'host' and 'port' \n", CONNECT_COMMAND)
+		return nil, fmt.Errorf("'%s' have to only come with 'addr' (host:port) or 'host' and 'port' ", CONNECT_COMMAND)
 	} else if !isEmptyString(*addr) {
 		hostConf, portConf, err = GetHostPortFromAddr(*addr)
 		addrConf = *addr
@@ -126,9 +126,9 @@ func getReceiveConfig(addr, host, port, receiveDir *string) (*FlagConfig, error)
 	var err error
 
 	if (isEmptyString(*host) || isEmptyString(*port)) && isEmptyString(*addr) {
-		return nil, fmt.Errorf("'%s' have to come with an address (-addr host:port)\n", CONNECT_COMMAND)
+		return nil, fmt.Errorf("'%s' have to come with an address (-addr host:port)", CONNECT_COMMAND)
 	} else if (!isEmptyString(*host) || !isEmptyString(*port)) && !isEmptyString(*addr) {
-		return nil, fmt.Errorf("'%s' have to only come with '-addr' (host:port) or '-host' and '-port' \n", CONNECT_COMMAND)
+		return nil, fmt.Errorf("'%s' have to only come with '-addr' (host:port) or '-host' and '-port' ", CONNECT_COMMAND)
 	} else if !isEmptyString(*addr) {
 		addrConf = *addr
 		hostConf, portConf, err = GetHostPortFromAddr(*addr)
@@ -155,7 +155,7 @@ func getReceiveConfig(addr, host, port, receiveDir *string) (*FlagConfig, error)
 func getLocalHostAddress() (string, error) {
 	addrs, err := net.InterfaceAddrs()
 	if err != nil {
-		return "", fmt.Errorf("failed to get host IP address: %w\n", err)
+		return "", fmt.Errorf("failed to get host IP address: %w", err)
 	}
 
 	for _, addr := range addrs {
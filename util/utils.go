@@ -30,7 +30,7 @@ func GetAddrFromHostPort(host, port string) string {
 // Get the host and the port from an address (host:port)
 func GetHostPortFromAddr(addr string) (string, string, error) {
 	if len(strings.Split(addr, ":")) != 2 {
-		return "", "", fmt.Errorf("%s: wrong address format, it should be host:port\n", addr)
+		return "", "", fmt.Errorf("%s: wrong address format, it should be host:port", addr)
 	}
 
 	host := strings.Split(addr, ":")[0]